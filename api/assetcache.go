@@ -0,0 +1,147 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// assetWrites are the chaincode functions whose first argument is the id
+// of an asset they change.
+var assetWrites = map[string]bool{
+	"CreateAsset":   true,
+	"UpdateAsset":   true,
+	"TransferAsset": true,
+	"DeleteAsset":   true,
+}
+
+// assetCache remembers ReadAsset results, so that dashboards polling the
+// same few assets do not evaluate them on a peer each time. It holds at
+// most size assets, evicting the least recently used, and each for at
+// most ttl. Entries are dropped when the API writes the asset or a
+// chaincode event reports a change to it. A zero ttl disables it.
+type assetCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *assetCacheEntry, most recently used first
+	entries map[string]*list.Element
+	// generation counts invalidations, so that a read that started before
+	// one does not store what may already be stale.
+	generation uint64
+}
+
+type assetCacheEntry struct {
+	key     string
+	payload []byte
+	expires time.Time
+}
+
+func newAssetCache(ttl time.Duration, size int) *assetCache {
+	return &assetCache{ttl: ttl, size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *assetCache) enabled() bool {
+	return c != nil && c.ttl > 0 && c.size > 0
+}
+
+// get returns the cached payload for key and the generation a read that
+// misses should pass to put.
+func (c *assetCache) get(key string) (payload []byte, generation uint64, ok bool) {
+	if !c.enabled() {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		entry := elem.Value.(*assetCacheEntry)
+		if time.Now().Before(entry.expires) {
+			c.order.MoveToFront(elem)
+			assetCacheLookups.WithLabelValues("hit").Inc()
+			return entry.payload, c.generation, true
+		}
+		c.remove(elem)
+	}
+	assetCacheLookups.WithLabelValues("miss").Inc()
+	return nil, c.generation, false
+}
+
+// put stores payload for key unless the cache was invalidated since
+// generation was handed out.
+func (c *assetCache) put(key string, payload []byte, generation uint64) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if elem, found := c.entries[key]; found {
+		c.remove(elem)
+	}
+	entry := &assetCacheEntry{key: key, payload: payload, expires: time.Now().Add(c.ttl)}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *assetCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, found := c.entries[key]; found {
+		c.remove(elem)
+	}
+}
+
+// remove drops elem. Callers hold c.mu.
+func (c *assetCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*assetCacheEntry).key)
+}
+
+// readLedgerAsset evaluates ReadAsset for id through the asset cache.
+func (wh *walletHandler) readLedgerAsset(ctx context.Context, id string) ([]byte, error) {
+	key := existsCacheKey(ctx, id)
+	payload, generation, ok := wh.assetCache.get(key)
+	if ok {
+		return payload, nil
+	}
+	payload, err := wh.evaluate(ctx, "ReadAsset", id)
+	if err != nil {
+		return nil, err
+	}
+	wh.assetCache.put(key, payload, generation)
+	return payload, nil
+}
+
+// wantsFresh reports whether req asked, with ?fresh=true, to bypass the
+// caches.
+func wantsFresh(req *http.Request) bool {
+	return req.URL.Query().Get("fresh") == "true"
+}
+
+// forgetAsset drops what the exists and asset caches know about id in
+// the request's channel and chaincode.
+func (wh *walletHandler) forgetAsset(ctx context.Context, id string) {
+	key := existsCacheKey(ctx, id)
+	wh.existsCache.invalidate(key)
+	wh.assetCache.invalidate(key)
+}
@@ -0,0 +1,734 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: asset.proto
+
+package assetpb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Asset struct {
+	AssetId              string   `protobuf:"bytes,1,opt,name=asset_id,json=assetId,proto3" json:"asset_id,omitempty"`
+	Colour               string   `protobuf:"bytes,2,opt,name=colour,proto3" json:"colour,omitempty"`
+	Size                 string   `protobuf:"bytes,3,opt,name=size,proto3" json:"size,omitempty"`
+	Owner                string   `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	AppraisedValue       string   `protobuf:"bytes,5,opt,name=appraised_value,json=appraisedValue,proto3" json:"appraised_value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Asset) Reset()         { *m = Asset{} }
+func (m *Asset) String() string { return proto.CompactTextString(m) }
+func (*Asset) ProtoMessage()    {}
+func (*Asset) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{0}
+}
+
+func (m *Asset) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Asset.Unmarshal(m, b)
+}
+func (m *Asset) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Asset.Marshal(b, m, deterministic)
+}
+func (m *Asset) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Asset.Merge(m, src)
+}
+func (m *Asset) XXX_Size() int {
+	return xxx_messageInfo_Asset.Size(m)
+}
+func (m *Asset) XXX_DiscardUnknown() {
+	xxx_messageInfo_Asset.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Asset proto.InternalMessageInfo
+
+func (m *Asset) GetAssetId() string {
+	if m != nil {
+		return m.AssetId
+	}
+	return ""
+}
+
+func (m *Asset) GetColour() string {
+	if m != nil {
+		return m.Colour
+	}
+	return ""
+}
+
+func (m *Asset) GetSize() string {
+	if m != nil {
+		return m.Size
+	}
+	return ""
+}
+
+func (m *Asset) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *Asset) GetAppraisedValue() string {
+	if m != nil {
+		return m.AppraisedValue
+	}
+	return ""
+}
+
+type CreateAssetRequest struct {
+	Asset                *Asset   `protobuf:"bytes,1,opt,name=asset,proto3" json:"asset,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CreateAssetRequest) Reset()         { *m = CreateAssetRequest{} }
+func (m *CreateAssetRequest) String() string { return proto.CompactTextString(m) }
+func (*CreateAssetRequest) ProtoMessage()    {}
+func (*CreateAssetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{1}
+}
+
+func (m *CreateAssetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CreateAssetRequest.Unmarshal(m, b)
+}
+func (m *CreateAssetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CreateAssetRequest.Marshal(b, m, deterministic)
+}
+func (m *CreateAssetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CreateAssetRequest.Merge(m, src)
+}
+func (m *CreateAssetRequest) XXX_Size() int {
+	return xxx_messageInfo_CreateAssetRequest.Size(m)
+}
+func (m *CreateAssetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CreateAssetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CreateAssetRequest proto.InternalMessageInfo
+
+func (m *CreateAssetRequest) GetAsset() *Asset {
+	if m != nil {
+		return m.Asset
+	}
+	return nil
+}
+
+type CreateAssetResponse struct {
+	TxId                 string   `protobuf:"bytes,1,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CreateAssetResponse) Reset()         { *m = CreateAssetResponse{} }
+func (m *CreateAssetResponse) String() string { return proto.CompactTextString(m) }
+func (*CreateAssetResponse) ProtoMessage()    {}
+func (*CreateAssetResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{2}
+}
+
+func (m *CreateAssetResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CreateAssetResponse.Unmarshal(m, b)
+}
+func (m *CreateAssetResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CreateAssetResponse.Marshal(b, m, deterministic)
+}
+func (m *CreateAssetResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CreateAssetResponse.Merge(m, src)
+}
+func (m *CreateAssetResponse) XXX_Size() int {
+	return xxx_messageInfo_CreateAssetResponse.Size(m)
+}
+func (m *CreateAssetResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CreateAssetResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CreateAssetResponse proto.InternalMessageInfo
+
+func (m *CreateAssetResponse) GetTxId() string {
+	if m != nil {
+		return m.TxId
+	}
+	return ""
+}
+
+type TransferAssetRequest struct {
+	AssetId              string   `protobuf:"bytes,1,opt,name=asset_id,json=assetId,proto3" json:"asset_id,omitempty"`
+	Owner                string   `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TransferAssetRequest) Reset()         { *m = TransferAssetRequest{} }
+func (m *TransferAssetRequest) String() string { return proto.CompactTextString(m) }
+func (*TransferAssetRequest) ProtoMessage()    {}
+func (*TransferAssetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{3}
+}
+
+func (m *TransferAssetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TransferAssetRequest.Unmarshal(m, b)
+}
+func (m *TransferAssetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TransferAssetRequest.Marshal(b, m, deterministic)
+}
+func (m *TransferAssetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TransferAssetRequest.Merge(m, src)
+}
+func (m *TransferAssetRequest) XXX_Size() int {
+	return xxx_messageInfo_TransferAssetRequest.Size(m)
+}
+func (m *TransferAssetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TransferAssetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TransferAssetRequest proto.InternalMessageInfo
+
+func (m *TransferAssetRequest) GetAssetId() string {
+	if m != nil {
+		return m.AssetId
+	}
+	return ""
+}
+
+func (m *TransferAssetRequest) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+type TransferAssetResponse struct {
+	TxId                 string   `protobuf:"bytes,1,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	PreviousOwner        string   `protobuf:"bytes,2,opt,name=previous_owner,json=previousOwner,proto3" json:"previous_owner,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TransferAssetResponse) Reset()         { *m = TransferAssetResponse{} }
+func (m *TransferAssetResponse) String() string { return proto.CompactTextString(m) }
+func (*TransferAssetResponse) ProtoMessage()    {}
+func (*TransferAssetResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{4}
+}
+
+func (m *TransferAssetResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TransferAssetResponse.Unmarshal(m, b)
+}
+func (m *TransferAssetResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TransferAssetResponse.Marshal(b, m, deterministic)
+}
+func (m *TransferAssetResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TransferAssetResponse.Merge(m, src)
+}
+func (m *TransferAssetResponse) XXX_Size() int {
+	return xxx_messageInfo_TransferAssetResponse.Size(m)
+}
+func (m *TransferAssetResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TransferAssetResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TransferAssetResponse proto.InternalMessageInfo
+
+func (m *TransferAssetResponse) GetTxId() string {
+	if m != nil {
+		return m.TxId
+	}
+	return ""
+}
+
+func (m *TransferAssetResponse) GetPreviousOwner() string {
+	if m != nil {
+		return m.PreviousOwner
+	}
+	return ""
+}
+
+type GetAssetRequest struct {
+	AssetId              string   `protobuf:"bytes,1,opt,name=asset_id,json=assetId,proto3" json:"asset_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetAssetRequest) Reset()         { *m = GetAssetRequest{} }
+func (m *GetAssetRequest) String() string { return proto.CompactTextString(m) }
+func (*GetAssetRequest) ProtoMessage()    {}
+func (*GetAssetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{5}
+}
+
+func (m *GetAssetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetAssetRequest.Unmarshal(m, b)
+}
+func (m *GetAssetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetAssetRequest.Marshal(b, m, deterministic)
+}
+func (m *GetAssetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetAssetRequest.Merge(m, src)
+}
+func (m *GetAssetRequest) XXX_Size() int {
+	return xxx_messageInfo_GetAssetRequest.Size(m)
+}
+func (m *GetAssetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetAssetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetAssetRequest proto.InternalMessageInfo
+
+func (m *GetAssetRequest) GetAssetId() string {
+	if m != nil {
+		return m.AssetId
+	}
+	return ""
+}
+
+type ListAssetsRequest struct {
+	Owner                string   `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListAssetsRequest) Reset()         { *m = ListAssetsRequest{} }
+func (m *ListAssetsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListAssetsRequest) ProtoMessage()    {}
+func (*ListAssetsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{6}
+}
+
+func (m *ListAssetsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListAssetsRequest.Unmarshal(m, b)
+}
+func (m *ListAssetsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListAssetsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListAssetsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListAssetsRequest.Merge(m, src)
+}
+func (m *ListAssetsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListAssetsRequest.Size(m)
+}
+func (m *ListAssetsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListAssetsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListAssetsRequest proto.InternalMessageInfo
+
+func (m *ListAssetsRequest) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+type ListAssetsResponse struct {
+	Assets               []*Asset `protobuf:"bytes,1,rep,name=assets,proto3" json:"assets,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListAssetsResponse) Reset()         { *m = ListAssetsResponse{} }
+func (m *ListAssetsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListAssetsResponse) ProtoMessage()    {}
+func (*ListAssetsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{7}
+}
+
+func (m *ListAssetsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListAssetsResponse.Unmarshal(m, b)
+}
+func (m *ListAssetsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListAssetsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListAssetsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListAssetsResponse.Merge(m, src)
+}
+func (m *ListAssetsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListAssetsResponse.Size(m)
+}
+func (m *ListAssetsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListAssetsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListAssetsResponse proto.InternalMessageInfo
+
+func (m *ListAssetsResponse) GetAssets() []*Asset {
+	if m != nil {
+		return m.Assets
+	}
+	return nil
+}
+
+type DeleteAssetRequest struct {
+	AssetId              string   `protobuf:"bytes,1,opt,name=asset_id,json=assetId,proto3" json:"asset_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteAssetRequest) Reset()         { *m = DeleteAssetRequest{} }
+func (m *DeleteAssetRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteAssetRequest) ProtoMessage()    {}
+func (*DeleteAssetRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{8}
+}
+
+func (m *DeleteAssetRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteAssetRequest.Unmarshal(m, b)
+}
+func (m *DeleteAssetRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteAssetRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteAssetRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteAssetRequest.Merge(m, src)
+}
+func (m *DeleteAssetRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteAssetRequest.Size(m)
+}
+func (m *DeleteAssetRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteAssetRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteAssetRequest proto.InternalMessageInfo
+
+func (m *DeleteAssetRequest) GetAssetId() string {
+	if m != nil {
+		return m.AssetId
+	}
+	return ""
+}
+
+type DeleteAssetResponse struct {
+	TxId                 string   `protobuf:"bytes,1,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteAssetResponse) Reset()         { *m = DeleteAssetResponse{} }
+func (m *DeleteAssetResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteAssetResponse) ProtoMessage()    {}
+func (*DeleteAssetResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4785e5163229d617, []int{9}
+}
+
+func (m *DeleteAssetResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteAssetResponse.Unmarshal(m, b)
+}
+func (m *DeleteAssetResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteAssetResponse.Marshal(b, m, deterministic)
+}
+func (m *DeleteAssetResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteAssetResponse.Merge(m, src)
+}
+func (m *DeleteAssetResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteAssetResponse.Size(m)
+}
+func (m *DeleteAssetResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteAssetResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteAssetResponse proto.InternalMessageInfo
+
+func (m *DeleteAssetResponse) GetTxId() string {
+	if m != nil {
+		return m.TxId
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*Asset)(nil), "assetpb.Asset")
+	proto.RegisterType((*CreateAssetRequest)(nil), "assetpb.CreateAssetRequest")
+	proto.RegisterType((*CreateAssetResponse)(nil), "assetpb.CreateAssetResponse")
+	proto.RegisterType((*TransferAssetRequest)(nil), "assetpb.TransferAssetRequest")
+	proto.RegisterType((*TransferAssetResponse)(nil), "assetpb.TransferAssetResponse")
+	proto.RegisterType((*GetAssetRequest)(nil), "assetpb.GetAssetRequest")
+	proto.RegisterType((*ListAssetsRequest)(nil), "assetpb.ListAssetsRequest")
+	proto.RegisterType((*ListAssetsResponse)(nil), "assetpb.ListAssetsResponse")
+	proto.RegisterType((*DeleteAssetRequest)(nil), "assetpb.DeleteAssetRequest")
+	proto.RegisterType((*DeleteAssetResponse)(nil), "assetpb.DeleteAssetResponse")
+}
+
+func init() { proto.RegisterFile("asset.proto", fileDescriptor_4785e5163229d617) }
+
+var fileDescriptor_4785e5163229d617 = []byte{
+	// 435 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0x5d, 0x8f, 0xd2, 0x40,
+	0x14, 0x4d, 0x59, 0x8a, 0xeb, 0xad, 0xcb, 0xc6, 0xcb, 0xaa, 0xdd, 0x2e, 0x1a, 0xd2, 0xf8, 0x49,
+	0x4c, 0x9b, 0xa0, 0x4f, 0xc6, 0x17, 0xbf, 0x02, 0x24, 0x46, 0x13, 0x30, 0x3e, 0xf8, 0x42, 0x0a,
+	0xbd, 0x6a, 0x13, 0x60, 0xea, 0xcc, 0xb4, 0x12, 0xff, 0x83, 0xbf, 0xd5, 0xbf, 0x60, 0x98, 0x0e,
+	0xa5, 0x85, 0x2e, 0xe1, 0xad, 0x73, 0xcf, 0x99, 0x7b, 0xcf, 0x3d, 0x67, 0x52, 0xb0, 0x02, 0x21,
+	0x48, 0x7a, 0x31, 0x67, 0x92, 0xe1, 0x0d, 0x75, 0x88, 0xa7, 0xee, 0x5f, 0x03, 0xcc, 0x37, 0xeb,
+	0x6f, 0xbc, 0x84, 0x53, 0x55, 0x9c, 0x44, 0xa1, 0x6d, 0x74, 0x8c, 0xa7, 0x37, 0x47, 0x19, 0x69,
+	0x18, 0xe2, 0x5d, 0x68, 0xcc, 0xd8, 0x9c, 0x25, 0xdc, 0xae, 0x29, 0x40, 0x9f, 0x10, 0xa1, 0x2e,
+	0xa2, 0x3f, 0x64, 0x9f, 0xa8, 0xaa, 0xfa, 0xc6, 0x0b, 0x30, 0xd9, 0xef, 0x25, 0x71, 0xbb, 0xae,
+	0x8a, 0xd9, 0x01, 0x9f, 0xc0, 0x79, 0x10, 0xc7, 0x3c, 0x88, 0x04, 0x85, 0x93, 0x34, 0x98, 0x27,
+	0x64, 0x9b, 0x0a, 0x6f, 0xe6, 0xe5, 0xaf, 0xeb, 0xaa, 0xfb, 0x0a, 0xf0, 0x1d, 0xa7, 0x40, 0x92,
+	0x12, 0x35, 0xa2, 0x5f, 0x09, 0x09, 0x89, 0x0f, 0xc1, 0x54, 0x5a, 0x94, 0x30, 0xab, 0xd7, 0xf4,
+	0xb4, 0x7c, 0x2f, 0x63, 0x65, 0xa0, 0xdb, 0x85, 0x56, 0xe9, 0xae, 0x88, 0xd9, 0x52, 0x10, 0xb6,
+	0xc0, 0x94, 0xab, 0xed, 0x56, 0x75, 0xb9, 0x1a, 0x86, 0x6e, 0x1f, 0x2e, 0xbe, 0xf0, 0x60, 0x29,
+	0xbe, 0x13, 0x2f, 0x4d, 0x3a, 0xe0, 0x42, 0xbe, 0x59, 0xad, 0xb0, 0x99, 0x3b, 0x86, 0x3b, 0x3b,
+	0x8d, 0x0e, 0x8c, 0xc5, 0x47, 0xd0, 0x8c, 0x39, 0xa5, 0x11, 0x4b, 0xc4, 0xa4, 0xd8, 0xec, 0x6c,
+	0x53, 0xfd, 0xac, 0x9a, 0x3e, 0x87, 0xf3, 0x3e, 0xc9, 0x23, 0x85, 0xb9, 0xcf, 0xe0, 0xf6, 0xc7,
+	0x48, 0x64, 0x74, 0xb1, 0xe1, 0xe7, 0x6a, 0x8d, 0xa2, 0xda, 0xd7, 0x80, 0x45, 0xaa, 0x96, 0xfa,
+	0x18, 0x1a, 0xaa, 0x97, 0xb0, 0x8d, 0xce, 0x49, 0x85, 0xbf, 0x1a, 0x75, 0x7d, 0xc0, 0xf7, 0x34,
+	0x27, 0x49, 0xc7, 0x2a, 0xeb, 0x42, 0xab, 0x74, 0xe1, 0x80, 0x35, 0xbd, 0x7f, 0x35, 0xb8, 0xa5,
+	0x68, 0x63, 0xe2, 0x69, 0x34, 0x23, 0x1c, 0x80, 0x55, 0x88, 0x13, 0xaf, 0x72, 0x51, 0xfb, 0x0f,
+	0xc4, 0x69, 0x57, 0x83, 0x7a, 0xde, 0x27, 0x38, 0x2b, 0x65, 0x84, 0xf7, 0x73, 0x7a, 0xd5, 0x23,
+	0x70, 0x1e, 0x5c, 0x07, 0xeb, 0x7e, 0x2f, 0xe1, 0x74, 0x13, 0x0f, 0xda, 0x39, 0x77, 0x27, 0x31,
+	0x67, 0xc7, 0x45, 0xfc, 0x00, 0xb0, 0xf5, 0x1e, 0x9d, 0x1c, 0xdd, 0xcb, 0xce, 0xb9, 0xaa, 0xc4,
+	0xf4, 0xf0, 0x01, 0x58, 0x05, 0x4f, 0x0b, 0xb6, 0xec, 0x47, 0xe3, 0xb4, 0xab, 0xc1, 0xac, 0xd3,
+	0xdb, 0xcb, 0x6f, 0xf7, 0x7e, 0x44, 0xf2, 0x67, 0x32, 0xf5, 0x66, 0x6c, 0xe1, 0x2f, 0xfc, 0xb4,
+	0xe7, 0x6b, 0xfa, 0xb4, 0xa1, 0x7e, 0x13, 0x2f, 0xfe, 0x0f, 0x00, 0xf8, 0xa6, 0x22, 0x31, 0x35,
+	0x04, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// AssetServiceClient is the client API for AssetService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AssetServiceClient interface {
+	CreateAsset(ctx context.Context, in *CreateAssetRequest, opts ...grpc.CallOption) (*CreateAssetResponse, error)
+	TransferAsset(ctx context.Context, in *TransferAssetRequest, opts ...grpc.CallOption) (*TransferAssetResponse, error)
+	GetAsset(ctx context.Context, in *GetAssetRequest, opts ...grpc.CallOption) (*Asset, error)
+	ListAssets(ctx context.Context, in *ListAssetsRequest, opts ...grpc.CallOption) (*ListAssetsResponse, error)
+	DeleteAsset(ctx context.Context, in *DeleteAssetRequest, opts ...grpc.CallOption) (*DeleteAssetResponse, error)
+}
+
+type assetServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAssetServiceClient(cc grpc.ClientConnInterface) AssetServiceClient {
+	return &assetServiceClient{cc}
+}
+
+func (c *assetServiceClient) CreateAsset(ctx context.Context, in *CreateAssetRequest, opts ...grpc.CallOption) (*CreateAssetResponse, error) {
+	out := new(CreateAssetResponse)
+	err := c.cc.Invoke(ctx, "/assetpb.AssetService/CreateAsset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assetServiceClient) TransferAsset(ctx context.Context, in *TransferAssetRequest, opts ...grpc.CallOption) (*TransferAssetResponse, error) {
+	out := new(TransferAssetResponse)
+	err := c.cc.Invoke(ctx, "/assetpb.AssetService/TransferAsset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assetServiceClient) GetAsset(ctx context.Context, in *GetAssetRequest, opts ...grpc.CallOption) (*Asset, error) {
+	out := new(Asset)
+	err := c.cc.Invoke(ctx, "/assetpb.AssetService/GetAsset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assetServiceClient) ListAssets(ctx context.Context, in *ListAssetsRequest, opts ...grpc.CallOption) (*ListAssetsResponse, error) {
+	out := new(ListAssetsResponse)
+	err := c.cc.Invoke(ctx, "/assetpb.AssetService/ListAssets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *assetServiceClient) DeleteAsset(ctx context.Context, in *DeleteAssetRequest, opts ...grpc.CallOption) (*DeleteAssetResponse, error) {
+	out := new(DeleteAssetResponse)
+	err := c.cc.Invoke(ctx, "/assetpb.AssetService/DeleteAsset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AssetServiceServer is the server API for AssetService service.
+type AssetServiceServer interface {
+	CreateAsset(context.Context, *CreateAssetRequest) (*CreateAssetResponse, error)
+	TransferAsset(context.Context, *TransferAssetRequest) (*TransferAssetResponse, error)
+	GetAsset(context.Context, *GetAssetRequest) (*Asset, error)
+	ListAssets(context.Context, *ListAssetsRequest) (*ListAssetsResponse, error)
+	DeleteAsset(context.Context, *DeleteAssetRequest) (*DeleteAssetResponse, error)
+}
+
+// UnimplementedAssetServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedAssetServiceServer struct {
+}
+
+func (*UnimplementedAssetServiceServer) CreateAsset(ctx context.Context, req *CreateAssetRequest) (*CreateAssetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAsset not implemented")
+}
+func (*UnimplementedAssetServiceServer) TransferAsset(ctx context.Context, req *TransferAssetRequest) (*TransferAssetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferAsset not implemented")
+}
+func (*UnimplementedAssetServiceServer) GetAsset(ctx context.Context, req *GetAssetRequest) (*Asset, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAsset not implemented")
+}
+func (*UnimplementedAssetServiceServer) ListAssets(ctx context.Context, req *ListAssetsRequest) (*ListAssetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAssets not implemented")
+}
+func (*UnimplementedAssetServiceServer) DeleteAsset(ctx context.Context, req *DeleteAssetRequest) (*DeleteAssetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAsset not implemented")
+}
+
+func RegisterAssetServiceServer(s *grpc.Server, srv AssetServiceServer) {
+	s.RegisterService(&_AssetService_serviceDesc, srv)
+}
+
+func _AssetService_CreateAsset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAssetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssetServiceServer).CreateAsset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/assetpb.AssetService/CreateAsset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssetServiceServer).CreateAsset(ctx, req.(*CreateAssetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AssetService_TransferAsset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferAssetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssetServiceServer).TransferAsset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/assetpb.AssetService/TransferAsset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssetServiceServer).TransferAsset(ctx, req.(*TransferAssetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AssetService_GetAsset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAssetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssetServiceServer).GetAsset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/assetpb.AssetService/GetAsset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssetServiceServer).GetAsset(ctx, req.(*GetAssetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AssetService_ListAssets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAssetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssetServiceServer).ListAssets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/assetpb.AssetService/ListAssets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssetServiceServer).ListAssets(ctx, req.(*ListAssetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AssetService_DeleteAsset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteAssetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AssetServiceServer).DeleteAsset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/assetpb.AssetService/DeleteAsset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AssetServiceServer).DeleteAsset(ctx, req.(*DeleteAssetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _AssetService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "assetpb.AssetService",
+	HandlerType: (*AssetServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAsset",
+			Handler:    _AssetService_CreateAsset_Handler,
+		},
+		{
+			MethodName: "TransferAsset",
+			Handler:    _AssetService_TransferAsset_Handler,
+		},
+		{
+			MethodName: "GetAsset",
+			Handler:    _AssetService_GetAsset_Handler,
+		},
+		{
+			MethodName: "ListAssets",
+			Handler:    _AssetService_ListAssets_Handler,
+		},
+		{
+			MethodName: "DeleteAsset",
+			Handler:    _AssetService_DeleteAsset_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "asset.proto",
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	codeSubmissionNotFound = "SUBMISSION_NOT_FOUND"
+	codeQueueFull          = "SUBMISSION_QUEUE_FULL"
+	codeQueueClosed        = "SUBMISSION_QUEUE_CLOSED"
+
+	// submissionQueueSize is how many async submissions may wait for the
+	// worker before new ones are refused.
+	submissionQueueSize = 256
+	// submissionTTL is how long a finished submission can be polled.
+	submissionTTL = time.Hour
+)
+
+// Submission states reported by GET /submissions/{id}.
+const (
+	submissionPending   = "pending"
+	submissionCommitted = "committed"
+	submissionFailed    = "failed"
+)
+
+// Submission is the state of an asynchronous submission.
+type Submission struct {
+	ID        string          `json:"id"`
+	Function  string          `json:"function"`
+	Status    string          `json:"status"`
+	TxID      string          `json:"txId,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *APIError       `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// asyncJob is queued for the worker. run returns the chaincode result and
+// the transaction id.
+type asyncJob struct {
+	id  string
+	ctx context.Context
+	run func(ctx context.Context) ([]byte, string, error)
+}
+
+// submissionQueue runs submissions in the background and keeps their state
+// in memory until submissionTTL after they finish.
+type submissionQueue struct {
+	jobs chan asyncJob
+	done chan struct{}
+
+	mu          sync.Mutex
+	submissions map[string]*Submission
+	lastSweep   time.Time
+	// closed is set by drain, under mu, when it closes jobs.
+	closed bool
+}
+
+// Errors enqueue refuses submissions with.
+var (
+	errQueueFull   = withCode(codeQueueFull, errors.New("too many pending submissions"))
+	errQueueClosed = withCode(codeQueueClosed, errors.New("the API is shutting down and accepts no new submissions"))
+)
+
+func newSubmissionQueue() *submissionQueue {
+	return &submissionQueue{
+		jobs:        make(chan asyncJob, submissionQueueSize),
+		done:        make(chan struct{}),
+		submissions: make(map[string]*Submission),
+	}
+}
+
+// enqueue records a pending submission and queues it. It fails with
+// errQueueFull when the queue is full and errQueueClosed once drain has
+// been called.
+func (q *submissionQueue) enqueue(ctx context.Context, function string, run func(ctx context.Context) ([]byte, string, error)) (*Submission, error) {
+	now := time.Now()
+	sub := &Submission{ID: newRequestID(), Function: function, Status: submissionPending, CreatedAt: now, UpdatedAt: now}
+
+	// The send never blocks, so it can be made under q.mu, which keeps
+	// drain from closing jobs in between.
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, errQueueClosed
+	}
+	select {
+	case q.jobs <- asyncJob{id: sub.ID, ctx: ctx, run: run}:
+	default:
+		return nil, errQueueFull
+	}
+	q.sweep(now)
+	q.submissions[sub.ID] = sub
+	snapshot := *sub
+	return &snapshot, nil
+}
+
+// get returns a copy of the submission with the given id.
+func (q *submissionQueue) get(id string) (Submission, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sweep(time.Now())
+
+	sub, ok := q.submissions[id]
+	if !ok {
+		return Submission{}, false
+	}
+	return *sub, true
+}
+
+// work runs queued jobs one at a time until the queue is drained.
+func (q *submissionQueue) work(timeout time.Duration) {
+	defer close(q.done)
+	for job := range q.jobs {
+		q.runJob(job, timeout)
+	}
+}
+
+// runJob runs one job, turning a panic into a failed submission so that
+// the worker keeps going.
+func (q *submissionQueue) runJob(job asyncJob, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(job.ctx, timeout)
+	defer cancel()
+
+	var (
+		result []byte
+		txID   string
+		err    error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				slog.ErrorContext(ctx, "async submission panicked", "submission", job.id, "panic", r)
+				err = fmt.Errorf("internal error: %v", r)
+			}
+		}()
+		result, txID, err = job.run(ctx)
+	}()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sub, ok := q.submissions[job.id]
+	if !ok {
+		return
+	}
+	sub.TxID = txID
+	sub.UpdatedAt = time.Now()
+	if err != nil {
+		sub.Status = submissionFailed
+		sub.Error = &APIError{Code: errorCode(transactionErrorStatus(err), err), Message: err.Error(), Category: errorCategory(err)}
+		return
+	}
+	sub.Status = submissionCommitted
+	sub.Result = chaincodeData(result)
+}
+
+// sweep drops finished submissions older than submissionTTL. Callers hold
+// q.mu.
+func (q *submissionQueue) sweep(now time.Time) {
+	if now.Sub(q.lastSweep) < time.Minute {
+		return
+	}
+	q.lastSweep = now
+	for id, sub := range q.submissions {
+		if sub.Status != submissionPending && now.Sub(sub.UpdatedAt) > submissionTTL {
+			delete(q.submissions, id)
+		}
+	}
+}
+
+// drain stops accepting jobs and waits for the worker to run those already
+// queued, or for ctx to be done. Submissions made after it is called are
+// refused with errQueueClosed.
+func (q *submissionQueue) drain(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// submitAsync queues run and answers 202 with the submission, whose id the
+// client polls at /submissions/{id}.
+func (wh *walletHandler) submitAsync(w http.ResponseWriter, req *http.Request, function string, run func(ctx context.Context) ([]byte, string, error)) {
+	// The job outlives the request but keeps its values, such as the
+	// request id and the selected identity.
+	sub, err := wh.async.enqueue(context.WithoutCancel(req.Context()), function, run)
+	if err != nil {
+		if errors.Is(err, errQueueFull) {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.Header().Set("Location", "/submissions/"+sub.ID)
+	writeData(w, http.StatusAccepted, sub)
+}
+
+// SubmissionStatus serves GET /submissions/{id}.
+func (wh *walletHandler) SubmissionStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		methodNotAllowed(w, req, "GET")
+		return
+	}
+
+	segments, err := pathSegments(req, "/submissions/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(segments) != 1 || segments[0] == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s", req.URL.Path))
+		return
+	}
+
+	sub, ok := wh.async.get(segments[0])
+	if !ok {
+		writeError(w, http.StatusNotFound, withCode(codeSubmissionNotFound, fmt.Errorf("submission %s does not exist or has expired", segments[0])))
+		return
+	}
+	writeData(w, http.StatusOK, sub)
+}
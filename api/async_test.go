@@ -0,0 +1,90 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDrainWhileEnqueueing drains the queue while submissions keep
+// arriving. Every submission must either be queued and run, or be refused
+// with errQueueClosed; none may panic sending on the closed channel.
+func TestDrainWhileEnqueueing(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		q := newSubmissionQueue()
+		go q.work(time.Second)
+
+		var (
+			mu      sync.Mutex
+			queued  int
+			ran     int
+			wg      sync.WaitGroup
+			started = make(chan struct{})
+		)
+		run := func(context.Context) ([]byte, string, error) {
+			mu.Lock()
+			ran++
+			mu.Unlock()
+			return nil, "", nil
+		}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-started
+				for j := 0; j < 20; j++ {
+					_, err := q.enqueue(context.Background(), "CreateAsset", run)
+					switch {
+					case err == nil:
+						mu.Lock()
+						queued++
+						mu.Unlock()
+					case errors.Is(err, errQueueClosed), errors.Is(err, errQueueFull):
+					default:
+						t.Errorf("enqueue: %v", err)
+					}
+				}
+			}()
+		}
+		close(started)
+		if err := q.drain(context.Background()); err != nil {
+			t.Fatalf("drain: %v", err)
+		}
+		wg.Wait()
+
+		mu.Lock()
+		if ran != queued {
+			t.Errorf("round %d: ran %d of %d queued submissions", round, ran, queued)
+		}
+		mu.Unlock()
+		if _, err := q.enqueue(context.Background(), "CreateAsset", run); !errors.Is(err, errQueueClosed) {
+			t.Fatalf("enqueue after drain: %v, want errQueueClosed", err)
+		}
+	}
+}
+
+// TestAsyncSubmissionAfterDrain checks that an async request during
+// shutdown is answered with 503.
+func TestAsyncSubmissionAfterDrain(t *testing.T) {
+	wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{})})
+	go wh.async.work(time.Second)
+	if err := wh.async.drain(context.Background()); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	// Draining twice is harmless.
+	if err := wh.async.drain(context.Background()); err != nil {
+		t.Fatalf("second drain: %v", err)
+	}
+
+	rec := serve(newRouter(wh), "POST", "/create-asset?async=true", createBody)
+	expectError(t, rec, http.StatusServiceUnavailable, codeQueueClosed)
+}
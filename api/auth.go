@@ -0,0 +1,215 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	apiKeyHeader     = "X-API-Key"
+	codeUnauthorized = "UNAUTHORIZED"
+	codeForbidden    = "FORBIDDEN"
+
+	codeAuthNotConfigured = "AUTH_NOT_CONFIGURED"
+)
+
+// apiKeyAuth rejects requests that do not carry one of the configured keys,
+// either in the X-API-Key header or as an "Authorization: Bearer" token,
+// or, when jwt is set, a valid JWT bearer token. Mutating routes are
+// always protected; read routes only when protectReads is set.
+type apiKeyAuth struct {
+	keys         [][]byte
+	jwt          *jwtVerifier
+	protectReads bool
+	disabled     bool
+}
+
+// newAPIKeyAuth builds the authenticator from the configuration. Keys come
+// from API_KEY, the comma-separated API_KEYS value and API_KEYS_FILE, one
+// key per line. With no keys and no JWT verifier, or with -no-auth,
+// authentication is disabled so local development needs no setup.
+func newAPIKeyAuth(cfg *appConfig) (*apiKeyAuth, error) {
+	if cfg.NoAuth {
+		return &apiKeyAuth{disabled: true}, nil
+	}
+
+	auth := &apiKeyAuth{jwt: newJWTVerifier(cfg), protectReads: cfg.AuthProtectReads}
+	auth.addKey(cfg.APIKey)
+	for _, key := range strings.Split(cfg.APIKeys, ",") {
+		auth.addKey(key)
+	}
+	if cfg.APIKeysFile != "" {
+		if err := auth.loadKeyFile(cfg.APIKeysFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(auth.keys) == 0 && auth.jwt == nil {
+		auth.disabled = true
+	}
+	return auth, nil
+}
+
+func (a *apiKeyAuth) addKey(key string) {
+	if key = strings.TrimSpace(key); key != "" {
+		a.keys = append(a.keys, []byte(key))
+	}
+}
+
+// loadKeyFile reads one key per line, skipping blank lines and # comments.
+func (a *apiKeyAuth) loadKeyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open API key file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		a.addKey(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read API key file: %w", err)
+	}
+	return nil
+}
+
+// valid compares key against every configured key in constant time, so the
+// response time does not reveal how much of a key was right.
+func (a *apiKeyAuth) valid(key string) bool {
+	match := 0
+	for _, k := range a.keys {
+		match |= subtle.ConstantTimeCompare([]byte(key), k)
+	}
+	return match == 1
+}
+
+// mutating protects a route that changes the ledger.
+func (a *apiKeyAuth) mutating(next http.HandlerFunc) http.Handler {
+	return a.protect(next, func(*http.Request) bool { return true })
+}
+
+// admin protects an operational route. Like a mutating route it always
+// needs an API key or a token with the admin role, whatever the method.
+// Unlike one it fails closed: with authentication disabled, it answers
+// 503 rather than serving anyone.
+func (a *apiKeyAuth) admin(next http.HandlerFunc) http.Handler {
+	protected := a.mutating(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if a == nil || a.disabled {
+			writeError(w, http.StatusServiceUnavailable, withCode(codeAuthNotConfigured, fmt.Errorf("%s needs API keys or JWT authentication to be configured", req.URL.Path)))
+			return
+		}
+		protected.ServeHTTP(w, req)
+	})
+}
+
+// reading protects a read-only route when reads are configured to need a key.
+func (a *apiKeyAuth) reading(next http.HandlerFunc) http.Handler {
+	return a.protect(next, func(*http.Request) bool { return false })
+}
+
+// byMethod protects a route whose GET requests read and whose other
+// methods write.
+func (a *apiKeyAuth) byMethod(next http.HandlerFunc) http.Handler {
+	return a.protect(next, func(req *http.Request) bool {
+		return req.Method != "GET" && req.Method != "HEAD"
+	})
+}
+
+// protect checks credentials before calling next. writes reports whether
+// the request changes the ledger; reads go unchecked unless protectReads
+// is set. A JWT bearer token must carry a role that allows the request,
+// while an API key allows everything.
+func (a *apiKeyAuth) protect(next http.HandlerFunc, writes func(*http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "OPTIONS" {
+			next(w, req)
+			return
+		}
+		token, _ := bearerToken(req)
+		subject, status, err := a.authorize(req.Header.Get(apiKeyHeader), token, writes(req), req.Method+" "+req.URL.Path)
+		if err != nil {
+			writeError(w, status, err)
+			return
+		}
+		if subject != "" {
+			req = req.WithContext(context.WithValue(req.Context(), subjectKey{}, subject))
+		}
+		next(w, req)
+	})
+}
+
+// authorize checks an API key or bearer token, either of which may be
+// empty, for a request described by action. It returns the token's
+// subject when the request was authenticated with a JWT, or the HTTP status
+// and error to refuse it with.
+func (a *apiKeyAuth) authorize(key, token string, write bool, action string) (string, int, error) {
+	if a == nil || a.disabled || (!write && !a.protectReads) {
+		return "", 0, nil
+	}
+
+	if token != "" {
+		if a.valid(token) {
+			return "", 0, nil
+		}
+		if a.jwt != nil {
+			return a.authorizeToken(token, write, action)
+		}
+		key = token
+	}
+
+	if key == "" {
+		return "", http.StatusUnauthorized, withCode(codeUnauthorized, fmt.Errorf("missing %s header or bearer token", apiKeyHeader))
+	}
+	if !a.valid(key) {
+		return "", http.StatusUnauthorized, withCode(codeUnauthorized, fmt.Errorf("invalid API key"))
+	}
+	return "", 0, nil
+}
+
+// authorizeToken verifies a JWT bearer token and checks that its roles
+// allow the request.
+func (a *apiKeyAuth) authorizeToken(token string, write bool, action string) (string, int, error) {
+	claims, err := a.jwt.verify(token)
+	if err != nil {
+		return "", http.StatusUnauthorized, withCode(codeUnauthorized, fmt.Errorf("invalid bearer token: %w", err))
+	}
+	if !claims.hasRole(roleAdmin) && (write || !claims.hasRole(roleReader)) {
+		return "", http.StatusForbidden, withCode(codeForbidden, fmt.Errorf("subject %q may not %s", claims.Subject, action))
+	}
+	return claims.Subject, 0, nil
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+type subjectKey struct{}
+
+// subjectFrom returns the subject of the bearer token the request was
+// authenticated with, or "" for API key and anonymous requests.
+func subjectFrom(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestAdminRoutes checks that the admin routes need a key, and that they
+// stay closed, rather than open, when no credentials are configured.
+func TestAdminRoutes(t *testing.T) {
+	keyed := &apiKeyAuth{keys: [][]byte{[]byte("secret")}}
+	tests := []struct {
+		name   string
+		auth   *apiKeyAuth
+		key    string
+		status int
+		code   string
+	}{
+		{"no auth configured", &apiKeyAuth{disabled: true}, "", http.StatusServiceUnavailable, codeAuthNotConfigured},
+		{"no auth configured with a key", &apiKeyAuth{disabled: true}, "secret", http.StatusServiceUnavailable, codeAuthNotConfigured},
+		{"nil auth", nil, "", http.StatusServiceUnavailable, codeAuthNotConfigured},
+		{"missing key", keyed, "", http.StatusUnauthorized, codeUnauthorized},
+		{"wrong key", keyed, "guess", http.StatusUnauthorized, codeUnauthorized},
+		{"valid key", keyed, "secret", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := false
+			h := tt.auth.admin(func(w http.ResponseWriter, req *http.Request) {
+				served = true
+				writeData(w, http.StatusOK, nil)
+			})
+
+			rec := serve(h, "GET", "/wallet/identities", "", apiKeyHeader, tt.key)
+			if tt.code != "" {
+				expectError(t, rec, tt.status, tt.code)
+			} else if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if served != (tt.code == "") {
+				t.Errorf("handler served = %v", served)
+			}
+		})
+	}
+}
+
+// TestAdminRoutesClosedByDefault runs the admin routes of a router whose
+// authentication is disabled, as it is when no key is configured.
+func TestAdminRoutesClosedByDefault(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{})}
+	h := newRouter(newTestHandler(contract))
+	for _, route := range []struct{ method, target string }{
+		{"POST", "/admin/init-ledger"},
+		{"GET", "/wallet/identities"},
+		{"DELETE", "/wallet/identities/appUser"},
+	} {
+		expectError(t, serve(h, route.method, route.target, ""), http.StatusServiceUnavailable, codeAuthNotConfigured)
+	}
+	if n := contract.count("InitLedger"); n != 0 {
+		t.Errorf("InitLedger submitted %d times, want 0", n)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	// maxBatchGetIDs caps the ids of a /assets/batch-get request.
+	maxBatchGetIDs = 100
+	// batchGetWorkers is how many ReadAsset evaluations of one request run
+	// at the same time.
+	batchGetWorkers = 8
+)
+
+// BatchGetRequest is the body of POST /assets/batch-get.
+type BatchGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+func (r BatchGetRequest) fieldErrors() []FieldError {
+	if len(r.IDs) == 0 {
+		return []FieldError{{Field: "ids", Message: "must not be empty"}}
+	}
+	if len(r.IDs) > maxBatchGetIDs {
+		return []FieldError{{Field: "ids", Message: fmt.Sprintf("must have at most %d ids", maxBatchGetIDs)}}
+	}
+	var errs []FieldError
+	for i, id := range r.IDs {
+		errs = requireField(errs, fmt.Sprintf("ids.%d", i), id)
+	}
+	return errs
+}
+
+// BatchGetResult is the entry of one id in a /assets/batch-get response:
+// the asset, or the error that prevented reading it.
+type BatchGetResult struct {
+	Asset *Asset    `json:"asset,omitempty"`
+	Error *APIError `json:"error,omitempty"`
+}
+
+// BatchGetAssets serves POST /assets/batch-get, which reads several assets
+// at once. The response maps every requested id to its result, so a
+// missing asset does not fail the others.
+func (wh *walletHandler) BatchGetAssets(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	var body BatchGetRequest
+	if !readJSON(w, req, &body) {
+		return
+	}
+	if !validate(w, body) {
+		return
+	}
+
+	fresh := wantsFresh(req)
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]BatchGetResult, len(body.IDs))
+		workers = make(chan struct{}, batchGetWorkers)
+		seen    = make(map[string]bool, len(body.IDs))
+	)
+	for _, id := range body.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			if fresh {
+				wh.forgetAsset(ctx, id)
+			}
+			result := wh.batchGetOne(ctx, id)
+			mu.Lock()
+			results[id] = result
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	writeData(w, http.StatusOK, results)
+}
+
+func (wh *walletHandler) batchGetOne(ctx context.Context, id string) BatchGetResult {
+	fail := func(status int, err error) BatchGetResult {
+		return BatchGetResult{Error: &APIError{Code: errorCode(status, err), Message: err.Error(), Category: errorCategory(err)}}
+	}
+
+	exists, err := wh.assetExists(ctx, id)
+	if err != nil {
+		return fail(assetCheckError(id, err))
+	}
+	if !exists {
+		return fail(http.StatusNotFound, assetNotFoundError(id))
+	}
+	result, err := wh.readLedgerAsset(ctx, id)
+	if err != nil {
+		return fail(transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+	}
+	var record ledgerRecord
+	if err := json.Unmarshal(result, &record); err != nil {
+		return fail(http.StatusBadGateway, fmt.Errorf("unexpected ReadAsset response: %w", err))
+	}
+	asset := record.asset()
+	return BatchGetResult{Asset: &asset}
+}
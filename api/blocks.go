@@ -0,0 +1,201 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+const (
+	// recentTransactionsSize is how many transactions /ledger/status lists.
+	recentTransactionsSize = 50
+	// eventsMaxBackoff caps the wait between attempts to re-register for
+	// block or chaincode events.
+	eventsMaxBackoff = 30 * time.Second
+)
+
+// blockEventSource is the part of *gateway.Network the block tracker uses.
+type blockEventSource interface {
+	RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.FilteredBlockEvent, error)
+	Unregister(registration fab.Registration)
+}
+
+var _ blockEventSource = (*gateway.Network)(nil)
+
+// eventSource returns where event listeners register: the current gateway
+// connection of the default identity, and a function that reports it
+// broken so that a new connection replaces it.
+type eventSource[T any] func() (source T, broken func())
+
+// RecentTransaction is a transaction seen in a committed block.
+// ValidationCode is the peer's verdict, such as VALID or MVCC_READ_CONFLICT.
+type RecentTransaction struct {
+	TxID           string `json:"txId"`
+	BlockNumber    uint64 `json:"blockNumber"`
+	ValidationCode string `json:"validationCode"`
+	Valid          bool   `json:"valid"`
+}
+
+// LedgerStatus is the body of /ledger/status. Height is zero until the
+// first block has been seen, and RecentTransactions is newest first.
+type LedgerStatus struct {
+	Height             uint64              `json:"height"`
+	LastBlockAt        *time.Time          `json:"lastBlockAt,omitempty"`
+	Listening          bool                `json:"listening"`
+	RecentTransactions []RecentTransaction `json:"recentTransactions"`
+}
+
+// blockTracker follows committed blocks to know the ledger height and the
+// last few transactions. recent is a ring buffer whose oldest entry is at
+// next once it is full.
+type blockTracker struct {
+	mu        sync.Mutex
+	height    uint64
+	lastBlock time.Time
+	listening bool
+	recent    []RecentTransaction
+	next      int
+
+	// backoff is the first wait before registering again.
+	backoff time.Duration
+}
+
+func newBlockTracker() *blockTracker {
+	return &blockTracker{recent: make([]RecentTransaction, 0, recentTransactionsSize), backoff: time.Second}
+}
+
+// follow registers for block events on the network source returns and
+// keeps the tracker up to date until the returned function is called. If
+// the event stream closes, for instance because the peer could not be
+// reached again, or registering fails, it reports the connection broken
+// and registers anew, on the connection that replaced it, with exponential
+// backoff.
+func (t *blockTracker) follow(source eventSource[blockEventSource]) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		backoff := t.backoff
+		for {
+			network, broken := source()
+			reg, events, err := network.RegisterFilteredBlockEvent()
+			if err != nil {
+				slog.Warn("failed to register for block events", "retry_in", backoff, "error", err)
+			} else {
+				backoff = t.backoff
+				t.setListening(true)
+				closed := t.consume(events, done)
+				network.Unregister(reg)
+				t.setListening(false)
+				if !closed {
+					return
+				}
+				slog.Warn("block event stream closed, registering again", "retry_in", backoff)
+			}
+			broken()
+
+			select {
+			case <-time.After(backoff):
+			case <-done:
+				return
+			}
+			backoff = min(backoff*2, eventsMaxBackoff)
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// consume records events until the channel is closed, in which case it
+// returns true, or done is closed.
+func (t *blockTracker) consume(events <-chan *fab.FilteredBlockEvent, done <-chan struct{}) bool {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return true
+			}
+			if event.FilteredBlock != nil {
+				t.record(event.FilteredBlock, time.Now())
+			}
+		case <-done:
+			return false
+		}
+	}
+}
+
+func (t *blockTracker) record(block *peer.FilteredBlock, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if block.Number+1 > t.height {
+		t.height = block.Number + 1
+		setLedgerHeight(t.height)
+	}
+	t.lastBlock = now
+
+	for _, tx := range block.FilteredTransactions {
+		entry := RecentTransaction{
+			TxID:           tx.Txid,
+			BlockNumber:    block.Number,
+			ValidationCode: tx.TxValidationCode.String(),
+			Valid:          tx.TxValidationCode == peer.TxValidationCode_VALID,
+		}
+		if len(t.recent) < recentTransactionsSize {
+			t.recent = append(t.recent, entry)
+			continue
+		}
+		t.recent[t.next] = entry
+		t.next = (t.next + 1) % recentTransactionsSize
+	}
+}
+
+func (t *blockTracker) setListening(listening bool) {
+	t.mu.Lock()
+	t.listening = listening
+	t.mu.Unlock()
+}
+
+func (t *blockTracker) status() LedgerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := LedgerStatus{
+		Height:             t.height,
+		Listening:          t.listening,
+		RecentTransactions: make([]RecentTransaction, 0, len(t.recent)),
+	}
+	if !t.lastBlock.IsZero() {
+		lastBlock := t.lastBlock
+		status.LastBlockAt = &lastBlock
+	}
+	// Walk the ring backwards from the newest entry.
+	for i := 1; i <= len(t.recent); i++ {
+		status.RecentTransactions = append(status.RecentTransactions, t.recent[(t.next-i+len(t.recent))%len(t.recent)])
+	}
+	return status
+}
+
+// LedgerStatus serves GET /ledger/status.
+func (wh *walletHandler) LedgerStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		methodNotAllowed(w, req, "GET")
+		return
+	}
+	writeData(w, http.StatusOK, wh.blocks.status())
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// fakeBlockSource hands out a block event channel per registration.
+type fakeBlockSource struct {
+	mu     sync.Mutex
+	events chan *fab.FilteredBlockEvent
+}
+
+func (s *fakeBlockSource) RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.FilteredBlockEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = make(chan *fab.FilteredBlockEvent, 1)
+	return s.events, s.events, nil
+}
+
+func (s *fakeBlockSource) Unregister(fab.Registration) {}
+
+// registered returns the channel of the current registration, or nil.
+func (s *fakeBlockSource) registered() chan *fab.FilteredBlockEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+// TestBlockTrackerResumesAfterStreamCloses closes the block event stream
+// and checks that the tracker reports the connection broken, registers
+// again on the connection that replaced it and records its blocks.
+func TestBlockTrackerResumesAfterStreamCloses(t *testing.T) {
+	first, second := &fakeBlockSource{}, &fakeBlockSource{}
+	var mu sync.Mutex
+	current := first
+	source := func() (blockEventSource, func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		conn := current
+		return conn, func() {
+			mu.Lock()
+			current = second
+			mu.Unlock()
+		}
+	}
+
+	tracker := newBlockTracker()
+	tracker.backoff = time.Millisecond
+	stop := tracker.follow(source)
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+	for first.registered() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the tracker did not register for block events")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	first.registered() <- &fab.FilteredBlockEvent{FilteredBlock: &peer.FilteredBlock{Number: 4}}
+	close(first.registered())
+
+	for second.registered() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the tracker did not register again on the new connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	second.registered() <- &fab.FilteredBlockEvent{FilteredBlock: &peer.FilteredBlock{Number: 5}}
+	for tracker.status().Height != 6 {
+		if time.Now().After(deadline) {
+			t.Fatalf("height = %d, want 6", tracker.status().Height)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// maxBulkAssets caps the size of a /assets/bulk request. Each asset is a
+// separate transaction, so a batch takes roughly as long as its length
+// times one commit, and counts as that many writes against the rate limit.
+// Batches larger than the client's write burst are paced to its write
+// rate rather than refused.
+const maxBulkAssets = 100
+
+// BulkResult reports what happened to one asset of a bulk request. Status
+// is "created" or "error".
+type BulkResult struct {
+	AssetID string `json:"asset_id"`
+	Status  string `json:"status"`
+	TxID    string `json:"txId,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkCreateAssets serves POST /assets/bulk. Every asset is created in its
+// own transaction; a failure is recorded in the results and the batch moves
+// on, so the response is always 207 Multi-Status. The batch's deadline
+// grows with its length: assets it leaves no time for are not submitted.
+// Batches that repeat an asset id are refused with 400.
+func (wh *walletHandler) BulkCreateAssets(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	var assets []Asset
+	if !readJSON(w, req, &assets) {
+		return
+	}
+	if len(assets) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("request body must be a non-empty array of assets"))
+		return
+	}
+	if len(assets) > maxBulkAssets {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("at most %d assets can be created per request, got %d", maxBulkAssets, len(assets)))
+		return
+	}
+	if errs := duplicateAssetIDs(assets); len(errs) > 0 {
+		writeFieldErrors(w, "request body repeats asset ids", errs)
+		return
+	}
+	ctx, cancel := wh.batchContext(req, len(assets))
+	defer cancel()
+
+	pacer := wh.limiter.pacer(req)
+	results := make([]BulkResult, 0, len(assets))
+	for _, asset := range assets {
+		var txID string
+		err := pacer.wait(ctx)
+		if err != nil {
+			err = fmt.Errorf("not submitted: %w", err)
+		} else {
+			txID, err = wh.createOne(ctx, asset)
+		}
+		result := BulkResult{AssetID: asset.AssetID, Status: "created", TxID: txID}
+		if err != nil {
+			result.Status = "error"
+			result.TxID = failedTxID(err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	writeData(w, http.StatusMultiStatus, results)
+}
+
+// duplicateAssetIDs returns a field error for every asset whose id an
+// earlier asset of the batch already has.
+func duplicateAssetIDs(assets []Asset) []FieldError {
+	var errs []FieldError
+	seen := make(map[string]int, len(assets))
+	for i, asset := range assets {
+		if asset.AssetID == "" {
+			continue
+		}
+		if first, ok := seen[asset.AssetID]; ok {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("%d.asset_id", i), Message: fmt.Sprintf("duplicates asset %d", first)})
+			continue
+		}
+		seen[asset.AssetID] = i
+	}
+	return errs
+}
+
+// createOne creates a single asset of a batch within ctx, which bounds the
+// whole batch, and returns its transaction id.
+func (wh *walletHandler) createOne(ctx context.Context, asset Asset) (string, error) {
+	if err := asset.validate(); err != nil {
+		return "", fmt.Errorf("invalid asset: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("not submitted, the request ran out of time: %w", err)
+	}
+
+	exists, err := wh.assetExists(ctx, asset.AssetID)
+	if err != nil {
+		_, err = assetCheckError(asset.AssetID, err)
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("already exists")
+	}
+	_, txID, err := wh.submitTx(ctx, "CreateAsset", asset.AssetID, asset.Colour, asset.Size, asset.Owner, asset.AppraisedValue)
+	return txID, err
+}
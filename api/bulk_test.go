@@ -0,0 +1,155 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bulkBody returns a /assets/bulk body creating the assets with ids.
+func bulkBody(ids ...string) string {
+	assets := make([]string, len(ids))
+	for i, id := range ids {
+		assets[i] = strings.Replace(createBody, "asset9", id, 1)
+	}
+	return "[" + strings.Join(assets, ",") + "]"
+}
+
+func TestBulkRejectsDuplicateIDs(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{})}
+	rec := serve(newRouter(newTestHandler(contract)), "POST", "/assets/bulk", bulkBody("a1", "a2", "a1", "a3", "a2"))
+
+	resp := expectError(t, rec, http.StatusBadRequest, codeValidationFailed)
+	want := []FieldError{
+		{Field: "2.asset_id", Message: "duplicates asset 0"},
+		{Field: "4.asset_id", Message: "duplicates asset 1"},
+	}
+	if fmt.Sprint(resp.Errors) != fmt.Sprint(want) {
+		t.Errorf("errors = %v, want %v", resp.Errors, want)
+	}
+	if n := contract.count("CreateAsset"); n != 0 {
+		t.Errorf("CreateAsset submitted %d times, want 0", n)
+	}
+}
+
+// TestBulkSharesRequestTimeout checks that a batch of slow submissions is
+// cut off at its deadline, which without BATCH_ASSET_TIMEOUT is the
+// request timeout.
+func TestBulkSharesRequestTimeout(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{}), submit: sleeping(40*time.Millisecond, nil)}
+	wh := newTestHandler(contract)
+	wh.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	rec := serve(newRouter(wh), "POST", "/assets/bulk", bulkBody("a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8"))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("the batch took %s with a 100ms request timeout", elapsed)
+	}
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusMultiStatus, rec.Body)
+	}
+	var results []BulkResult
+	if err := json.Unmarshal(decodeResponse(t, rec).Data, &results); err != nil {
+		t.Fatalf("decoding results: %v", err)
+	}
+	if len(results) != 8 {
+		t.Fatalf("got %d results, want 8", len(results))
+	}
+	if results[0].Status != "created" {
+		t.Errorf("first asset: %+v, want created", results[0])
+	}
+	if last := results[7]; last.Status != "error" || !strings.Contains(last.Error, "not submitted") {
+		t.Errorf("last asset: %+v, want it not submitted", last)
+	}
+}
+
+// TestBulkTimePerAsset checks that BATCH_ASSET_TIMEOUT extends the
+// deadline of a batch for each of its assets.
+func TestBulkTimePerAsset(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{}), submit: sleeping(40*time.Millisecond, nil)}
+	wh := newTestHandler(contract)
+	wh.timeout = 100 * time.Millisecond
+	wh.batchAssetTimeout = 100 * time.Millisecond
+
+	rec := serve(newRouter(wh), "POST", "/assets/bulk", bulkBody("a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8"))
+	if n := contract.count("CreateAsset"); n != 8 {
+		t.Errorf("CreateAsset submitted %d times, want 8: %s", n, rec.Body)
+	}
+}
+
+// TestBulkCountsEachAsset checks that every asset of a batch counts
+// against the client's write limit.
+func TestBulkCountsEachAsset(t *testing.T) {
+	wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{})})
+	wh.limiter = &rateLimiter{writes: newBucketLimiter(0.001, 5)}
+	h := wh.limiter.limit(newRouter(wh))
+
+	// 1 token for the request and 2 for its other assets leaves 2 of 5.
+	if rec := serve(h, "POST", "/assets/bulk", bulkBody("a1", "a2", "a3")); rec.Code != http.StatusMultiStatus {
+		t.Fatalf("first batch: status = %d, want %d: %s", rec.Code, http.StatusMultiStatus, rec.Body)
+	}
+	for _, id := range []string{"b1", "b2"} {
+		if rec := serve(h, "POST", "/assets/bulk", bulkBody(id)); rec.Code != http.StatusMultiStatus {
+			t.Fatalf("batch of %s: status = %d, want %d: %s", id, rec.Code, http.StatusMultiStatus, rec.Body)
+		}
+	}
+	rec := serve(h, "POST", "/assets/bulk", bulkBody("b3"))
+	expectError(t, rec, http.StatusTooManyRequests, codeRateLimited)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+}
+
+// TestBulkOverWriteBurst checks that batches of more assets than the
+// default write burst of 20, up to the cap of 100, are paced to the write
+// rate instead of being refused. The largest batch runs at a higher rate
+// to keep the test short.
+func TestBulkOverWriteBurst(t *testing.T) {
+	for _, tc := range []struct {
+		assets int
+		rate   string
+	}{
+		{21, ""},
+		{30, ""},
+		{maxBulkAssets, "100"},
+	} {
+		t.Run(fmt.Sprint(tc.assets), func(t *testing.T) {
+			if tc.rate != "" {
+				t.Setenv("RATE_LIMIT_WRITE_RPS", tc.rate)
+			}
+			contract := &fakeContract{evaluate: ledger(map[string]string{})}
+			h := withDefaultLimits(t, newTestHandler(contract))
+
+			ids := make([]string, tc.assets)
+			for i := range ids {
+				ids[i] = fmt.Sprintf("a%d", i+1)
+			}
+			rec := serve(h, "POST", "/assets/bulk", bulkBody(ids...))
+			if rec.Code != http.StatusMultiStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusMultiStatus, rec.Body)
+			}
+			var results []BulkResult
+			if err := json.Unmarshal(decodeResponse(t, rec).Data, &results); err != nil {
+				t.Fatalf("decoding results: %v", err)
+			}
+			for _, result := range results {
+				if result.Status != "created" {
+					t.Fatalf("asset %s: %+v, want created", result.AssetID, result)
+				}
+			}
+			if n := contract.count("CreateAsset"); n != tc.assets {
+				t.Errorf("CreateAsset submitted %d times, want %d", n, tc.assets)
+			}
+			expectError(t, serve(h, "POST", "/assets/bulk", bulkBody("b1")), http.StatusTooManyRequests, codeRateLimited)
+		})
+	}
+}
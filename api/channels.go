@@ -0,0 +1,92 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const codeChannelNotFound = "CHANNEL_NOT_FOUND"
+
+// channelRoutePrefixes are the routes that can be scoped to a channel with
+// /channels/{channel}. Event streams, ledger status and the operational
+// routes only follow the default channel.
+var channelRoutePrefixes = []string{"/assets", "/asset", "/create-asset", "/transaction", "/invoke", "/private-assets"}
+
+type channelKey struct{}
+
+// parseChannelList turns the comma-separated CHANNELS setting into the set
+// of channels requests may select. The default channel is always in it.
+func parseChannelList(list, defaultChannel string) map[string]bool {
+	channels := parseFunctionList(list)
+	channels[defaultChannel] = true
+	return channels
+}
+
+// channelScoped serves /channels/{channel}/... by running the route that
+// follows the channel on next, with the channel recorded in the request's
+// context for withIdentity. Channels that are not configured get 404.
+func (wh *walletHandler) channelScoped(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		segments, err := pathSegments(req, "/channels/")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		channel := segments[0]
+		if channel == "" {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s", req.URL.Path))
+			return
+		}
+		if !wh.channels[channel] {
+			writeError(w, http.StatusNotFound, withCode(codeChannelNotFound, fmt.Errorf("channel %q is not served by this API", channel)))
+			return
+		}
+
+		// The rest of the path stays escaped, so that the route sees ids
+		// with reserved characters just as it would without the prefix.
+		_, rawPath, _ := strings.Cut(strings.TrimPrefix(req.URL.EscapedPath(), "/channels/"), "/")
+		rawPath = "/" + rawPath
+		path, err := url.PathUnescape(rawPath)
+		if err != nil || !isChannelRoute(path) {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s", req.URL.Path))
+			return
+		}
+
+		// The route's withIdentity binds the contract on the channel, once
+		// the route has authorized the request.
+		ctx := req.Context()
+		if channel != wh.channelName {
+			ctx = context.WithValue(ctx, channelKey{}, channel)
+		}
+
+		scoped := req.Clone(ctx)
+		scoped.URL.Path = path
+		scoped.URL.RawPath = rawPath
+		next.ServeHTTP(w, scoped)
+	})
+}
+
+func isChannelRoute(path string) bool {
+	for _, prefix := range channelRoutePrefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// channelFor returns the channel channelScoped selected for the request,
+// or "" for the default channel.
+func channelFor(ctx context.Context) string {
+	channel, _ := ctx.Value(channelKey{}).(string)
+	return channel
+}
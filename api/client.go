@@ -0,0 +1,71 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// fabricClientSDK is the only Fabric client FABRIC_CLIENT can select
+// until one built on the Fabric Gateway API is added.
+const fabricClientSDK = "sdk"
+
+// fabricClient connects wallet identities to the network. Handlers only
+// use the ContractInvoker its connections hand out, so a client built on
+// the Fabric Gateway API can take the place of fabric-sdk-go's deprecated
+// gateway package without changing them.
+type fabricClient interface {
+	connect(label string) (fabricGateway, error)
+}
+
+// fabricGateway is the connection of one identity.
+type fabricGateway interface {
+	contract(channel, chaincode string) (ContractInvoker, error)
+	close()
+}
+
+// newFabricClient returns the client cfg.FabricClient names, connecting
+// with the identities in wallet.
+func newFabricClient(cfg *appConfig, wallet identityWallet) (fabricClient, error) {
+	switch cfg.FabricClient {
+	case fabricClientSDK:
+		return sdkClient{cfg: cfg, wallet: wallet}, nil
+	}
+	return nil, fmt.Errorf("unknown Fabric client %q", cfg.FabricClient)
+}
+
+// sdkClient connects through fabric-sdk-go's gateway package.
+type sdkClient struct {
+	cfg    *appConfig
+	wallet identityWallet
+}
+
+func (c sdkClient) connect(label string) (fabricGateway, error) {
+	gw, err := connectGateway(c.cfg, c.wallet, label)
+	if err != nil {
+		return nil, err
+	}
+	return sdkGateway{gw}, nil
+}
+
+type sdkGateway struct {
+	gw *gateway.Gateway
+}
+
+func (g sdkGateway) contract(channel, chaincode string) (ContractInvoker, error) {
+	network, err := g.gw.GetNetwork(channel)
+	if err != nil {
+		return nil, err
+	}
+	return network.GetContract(chaincode), nil
+}
+
+func (g sdkGateway) close() {
+	g.gw.Close()
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// fakeClient connects every identity to contract and counts connections.
+type fakeClient struct {
+	contract ContractInvoker
+
+	mu       sync.Mutex
+	connects map[string]int
+	closes   int
+}
+
+func (c *fakeClient) connect(label string) (fabricGateway, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connects == nil {
+		c.connects = make(map[string]int)
+	}
+	c.connects[label]++
+	return fakeGateway{c}, nil
+}
+
+type fakeGateway struct {
+	c *fakeClient
+}
+
+func (g fakeGateway) contract(channel, chaincode string) (ContractInvoker, error) {
+	return g.c.contract, nil
+}
+
+func (g fakeGateway) close() {
+	g.c.mu.Lock()
+	g.c.closes++
+	g.c.mu.Unlock()
+}
+
+func TestNewFabricClient(t *testing.T) {
+	wallet := gateway.NewInMemoryWallet()
+	if _, err := newFabricClient(&appConfig{FabricClient: fabricClientSDK}, wallet); err != nil {
+		t.Errorf("sdk client: %v", err)
+	}
+	for _, name := range []string{"gateway", "grpc"} {
+		if _, err := newFabricClient(&appConfig{FabricClient: name}, wallet); err == nil {
+			t.Errorf("the %q client was accepted", name)
+		}
+	}
+}
+
+// TestHandlersThroughClient runs the same requests as the default identity
+// and as an identity connected through the client, and checks that both
+// are answered alike by their own contract.
+func TestHandlersThroughClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		status   int
+		function string
+	}{
+		{"read", "GET", "/assets/asset1", "", http.StatusOK, "ReadAsset"},
+		{"list", "GET", "/assets", "", http.StatusOK, "GetAllAssets"},
+		{"create", "POST", "/create-asset", createBody, http.StatusCreated, "CreateAsset"},
+		{"missing asset", "GET", "/assets/asset7", "", http.StatusNotFound, "AssetExists"},
+	}
+	for _, tt := range tests {
+		for _, label := range []string{"", "user2"} {
+			t.Run(tt.name+"/"+label, func(t *testing.T) {
+				defaultContract := &fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})}
+				identityContract := &fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})}
+				client := &fakeClient{contract: identityContract}
+				wallet := gateway.NewInMemoryWallet()
+				if err := wallet.Put("user2", gateway.NewX509Identity("Org1MSP", "cert", "key")); err != nil {
+					t.Fatalf("wallet.Put: %v", err)
+				}
+				wh := newTestHandler(defaultContract)
+				wh.wallet = wallet
+				wh.identities = newIdentityPool(&appConfig{ChannelName: "mychannel", ChaincodeName: "basic"}, client)
+
+				var header []string
+				want := defaultContract
+				if label != "" {
+					header = []string{fabricUserHeader, label}
+					want = identityContract
+				}
+				rec := serve(newRouter(wh), tt.method, tt.target, tt.body, header...)
+				if rec.Code != tt.status {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+				}
+				if n := want.count(tt.function); n != 1 {
+					t.Errorf("%s called %d times on the selected contract, want 1", tt.function, n)
+				}
+				if label != "" && defaultContract.count(tt.function) != 0 {
+					t.Errorf("%s reached the default contract", tt.function)
+				}
+				if label != "" && client.connects[label] != 1 {
+					t.Errorf("connected %s %d times, want 1", label, client.connects[label])
+				}
+			})
+		}
+	}
+}
+
+// TestPoolClosesClientConnections checks that evicting an identity closes
+// its connection and that the next request connects again.
+func TestPoolClosesClientConnections(t *testing.T) {
+	client := &fakeClient{contract: &fakeContract{}}
+	pool := newIdentityPool(&appConfig{}, client)
+
+	if _, err := pool.contractOn("user2", "mychannel", "basic"); err != nil {
+		t.Fatalf("contractOn: %v", err)
+	}
+	pool.evict("user2")
+	if client.closes != 1 {
+		t.Errorf("closed %d connections, want 1", client.closes)
+	}
+	if _, err := pool.contractOn("user2", "mychannel", "basic"); err != nil {
+		t.Fatalf("contractOn: %v", err)
+	}
+	if client.connects["user2"] != 2 {
+		t.Errorf("connected %d times, want 2", client.connects["user2"])
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// loadClientCAs reads the PEM bundle of CAs client certificates must chain
+// to when mutual TLS is enabled.
+func loadClientCAs(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA bundle %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+// clientIdentityMap maps the subject common name of a verified client
+// certificate to the wallet identity its requests are signed with.
+type clientIdentityMap map[string]string
+
+// loadClientIdentityMap reads a JSON object of common names to wallet
+// labels, such as {"org1-batch-service": "batchUser"}, and checks that
+// every label is in the wallet.
+func loadClientIdentityMap(path string, wallet identityWallet) (clientIdentityMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client identity map: %w", err)
+	}
+	var mapping clientIdentityMap
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("client identity map %s is not a JSON object of strings: %w", path, err)
+	}
+	for cn, label := range mapping {
+		if cn == "" || label == "" {
+			return nil, fmt.Errorf("client identity map %s has an empty common name or label", path)
+		}
+		if !wallet.Exists(label) {
+			return nil, fmt.Errorf("client identity map %s maps %q to %q, which is not in the wallet", path, cn, label)
+		}
+	}
+	return mapping, nil
+}
+
+// clientCommonName returns the subject CN of the verified client
+// certificate on a connection, or "" when there is none.
+func clientCommonName(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
+
+type clientCNKey struct{}
+
+// clientCNFrom returns the client certificate CN the request was made
+// with, or "" when mutual TLS is off.
+func clientCNFrom(ctx context.Context) string {
+	cn, _ := ctx.Value(clientCNKey{}).(string)
+	return cn
+}
+
+// withClientCert records the client certificate CN of state in ctx and
+// returns the wallet label it maps to, or fallback when it maps to none.
+func (wh *walletHandler) withClientCert(ctx context.Context, state *tls.ConnectionState, fallback string) (context.Context, string) {
+	cn := clientCommonName(state)
+	if cn == "" {
+		return ctx, fallback
+	}
+	ctx = context.WithValue(ctx, clientCNKey{}, cn)
+	if label, ok := wh.clientIdentities[cn]; ok {
+		return ctx, label
+	}
+	return ctx, fallback
+}
@@ -0,0 +1,326 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// appConfig holds the settings the API is started with. Each value comes
+// from a command-line flag, then an environment variable, then a default.
+type appConfig struct {
+	ListenAddr string
+	// TLSCertFile and TLSKeyFile make the API serve HTTPS when both are
+	// set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile turns on mutual TLS: clients must present a
+	// certificate issued by one of its CAs. ClientIdentityMapFile maps
+	// certificate CNs to the wallet identities they sign with.
+	TLSClientCAFile       string
+	ClientIdentityMapFile string
+	// GRPCListenAddr is where the gRPC AssetService listens; empty
+	// disables it.
+	GRPCListenAddr string
+	ChannelName    string
+	// Channels is a comma-separated list of further channels requests
+	// may select with /channels/{channel}.
+	Channels      string
+	ChaincodeName string
+	// Chaincodes is a comma-separated list of further chaincodes on the
+	// channel that requests may select with X-Chaincode.
+	Chaincodes string
+	WalletUser string
+	CCPPath    string
+	// FabricClient is how identities connect; only "sdk", through
+	// fabric-sdk-go's gateway package, is supported.
+	FabricClient string
+	// OrgsFile lists further organizations requests may select with
+	// X-Fabric-Org, each with its own connection profile and wallet.
+	OrgsFile string
+	// WalletType is "filesystem", which keeps the wallet in WalletPath,
+	// "memory", which keeps it in memory and loses it on exit, or "sql",
+	// which keeps it in the WalletDBDSN database of WalletDBDriver.
+	WalletType     string
+	WalletDBDriver string
+	WalletDBDSN    string
+	// WalletPath is the wallet directory and CredentialPath the MSP
+	// directory the wallet user is loaded from when it is missing, unless
+	// WalletCertPEM and WalletKeyPEM provide its credentials directly.
+	WalletPath     string
+	CredentialPath string
+	WalletCertPEM  string
+	WalletKeyPEM   string
+	// Timeout bounds each Fabric call, both in the SDK and as a deadline
+	// on the request's context; RequestTimeout bounds all the calls a
+	// request makes, and how long its client is kept waiting.
+	Timeout         time.Duration
+	RequestTimeout  time.Duration
+	ShutdownTimeout time.Duration
+	// BatchAssetTimeout is added to RequestTimeout for every asset of a
+	// bulk create or import, which submit their assets one at a time.
+	BatchAssetTimeout time.Duration
+	// StartupMaxAttempts is how many times connecting to the network is
+	// tried at startup before the process gives up.
+	StartupMaxAttempts int
+	// MaxBodyBytes caps the size of request bodies; zero removes the cap.
+	MaxBodyBytes   int64
+	ProbeChaincode bool
+	// SubmitMaxAttempts and SubmitRetryBackoff control retries of
+	// submissions that hit read conflicts or unreachable peers.
+	SubmitMaxAttempts  int
+	SubmitRetryBackoff time.Duration
+	LogLevel           slog.Level
+	LogFormat          string
+	// ExistsCacheTTL is how long AssetExists results are reused, for at
+	// most ExistsCacheSize assets; zero disables the cache.
+	ExistsCacheTTL  time.Duration
+	ExistsCacheSize int
+	// AssetCacheTTL and AssetCacheSize bound the ReadAsset cache; a zero
+	// ttl disables it.
+	AssetCacheTTL  time.Duration
+	AssetCacheSize int
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are kept, for at most IdempotencyMaxKeys keys; a
+	// zero ttl ignores the header.
+	IdempotencyTTL     time.Duration
+	IdempotencyMaxKeys int
+	// OfflineSigningTTL is how long a transaction prepared for a client
+	// that signs it itself waits for each signature; zero disables
+	// /transactions/prepare and /transactions/submit.
+	OfflineSigningTTL time.Duration
+	// ContractPoolSize is how many gateway connections the default
+	// identity's transactions are spread over; the default of 1 opens no
+	// connections beyond the first.
+	ContractPoolSize int
+	// IdentityIdleTimeout is how long the gateway connection of an
+	// identity a request selected stays open unused; zero keeps it open.
+	IdentityIdleTimeout time.Duration
+	// InvokeAllowedFunctions is a comma-separated list of the chaincode
+	// functions /invoke may call.
+	InvokeAllowedFunctions string
+	// CORSAllowedOrigins is a comma-separated list of browser origins
+	// allowed to call the API; "*" allows any origin.
+	CORSAllowedOrigins string
+	// CARegistrarID and CARegistrarSecret are the CA identity that POST
+	// /identities registers users as; without a secret it is unavailable.
+	CARegistrarID     string
+	CARegistrarSecret string
+
+	NoAuth           bool
+	APIKey           string
+	APIKeys          string
+	APIKeysFile      string
+	AuthProtectReads bool
+	// JWTSecret and JWTJWKSURL enable bearer tokens signed with HS256 and
+	// RS256 respectively. JWTRolesClaim is a dotted path to the roles.
+	JWTSecret     string
+	JWTJWKSURL    string
+	JWTIssuer     string
+	JWTRolesClaim string
+
+	// Rate limits are requests per second per client IP; zero disables
+	// the limit. TrustedProxies lists the proxies whose X-Forwarded-For
+	// header is believed.
+	ReadRateLimit  float64
+	ReadRateBurst  int
+	WriteRateLimit float64
+	WriteRateBurst int
+	TrustedProxies string
+}
+
+// loadConfig parses args (without the program name) and the environment.
+// FABRIC_CHANNEL and FABRIC_CONTRACT are still honoured for deployments
+// that predate CHANNEL_NAME and CHAINCODE_NAME, as is CCP_PATH for
+// CONNECTION_PROFILE, and ALLOWED_ORIGINS is accepted as another name for
+// CORS_ALLOWED_ORIGINS.
+func loadConfig(args []string) (*appConfig, error) {
+	cfg := &appConfig{}
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	fs.StringVar(&cfg.ListenAddr, "listen", "", "address to serve the API on, e.g. 127.0.0.1:8090 (env API_LISTEN_ADDR, API_PORT)")
+	fs.StringVar(&cfg.GRPCListenAddr, "grpc-listen", "", "address to serve the gRPC AssetService on, disabled when empty (env GRPC_LISTEN_ADDR)")
+	fs.StringVar(&cfg.ChannelName, "channel", "", "channel the chaincode is deployed on (env CHANNEL_NAME)")
+	fs.StringVar(&cfg.ChaincodeName, "chaincode", "", "name of the asset chaincode (env CHAINCODE_NAME)")
+	fs.StringVar(&cfg.WalletUser, "wallet-user", "", "wallet identity used to connect to the gateway (env WALLET_USER)")
+	fs.StringVar(&cfg.CCPPath, "ccp", "", "path to the connection profile (env CONNECTION_PROFILE, CCP_PATH)")
+	fs.BoolVar(&cfg.NoAuth, "no-auth", false, "disable API key authentication, for local demos only")
+	// --skip-init is still accepted so that scripts written for it keep
+	// working; startup never seeds the ledger any more.
+	skipInit := fs.Bool("skip-init", false, "deprecated and ignored: the ledger is only seeded through POST /admin/init-ledger")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *skipInit {
+		slog.Warn("--skip-init is deprecated and has no effect; the ledger is only seeded through POST /admin/init-ledger")
+	}
+
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = getEnv("API_LISTEN_ADDR", ":"+getEnv("API_PORT", "8090"))
+	}
+	cfg.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cfg.TLSClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("TLS_CLIENT_CA_FILE needs TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	cfg.ClientIdentityMapFile = os.Getenv("CLIENT_IDENTITY_MAP")
+	if cfg.ClientIdentityMapFile != "" && cfg.TLSClientCAFile == "" {
+		return nil, fmt.Errorf("CLIENT_IDENTITY_MAP needs TLS_CLIENT_CA_FILE")
+	}
+	if cfg.GRPCListenAddr == "" {
+		cfg.GRPCListenAddr = os.Getenv("GRPC_LISTEN_ADDR")
+	}
+	if cfg.ChannelName == "" {
+		cfg.ChannelName = getEnv("CHANNEL_NAME", getEnv("FABRIC_CHANNEL", "mychannel"))
+	}
+	cfg.Channels = os.Getenv("CHANNELS")
+	if cfg.ChaincodeName == "" {
+		cfg.ChaincodeName = getEnv("CHAINCODE_NAME", getEnv("FABRIC_CONTRACT", "basic"))
+	}
+	cfg.Chaincodes = os.Getenv("CHAINCODES")
+	if cfg.WalletUser == "" {
+		cfg.WalletUser = getEnv("WALLET_USER", "appUser")
+	}
+	if cfg.CCPPath == "" {
+		cfg.CCPPath = getEnv("CONNECTION_PROFILE", getEnv("CCP_PATH", filepath.Join("connection", "connection-org1.yaml")))
+	}
+	cfg.FabricClient = getEnv("FABRIC_CLIENT", fabricClientSDK)
+	if cfg.FabricClient != fabricClientSDK {
+		return nil, fmt.Errorf("invalid FABRIC_CLIENT: must be %q", fabricClientSDK)
+	}
+	cfg.WalletType = getEnv("WALLET_TYPE", walletTypeFilesystem)
+	switch cfg.WalletType {
+	case walletTypeFilesystem, walletTypeMemory:
+	case walletTypeSQL:
+		cfg.WalletDBDriver = getEnv("WALLET_DB_DRIVER", "postgres")
+		cfg.WalletDBDSN = os.Getenv("WALLET_DB_DSN")
+		if cfg.WalletDBDSN == "" {
+			return nil, fmt.Errorf("WALLET_TYPE=%s needs WALLET_DB_DSN", walletTypeSQL)
+		}
+	default:
+		return nil, fmt.Errorf("invalid WALLET_TYPE: must be %q, %q or %q", walletTypeFilesystem, walletTypeMemory, walletTypeSQL)
+	}
+	cfg.WalletPath = getEnv("WALLET_PATH", "wallet")
+	cfg.OrgsFile = os.Getenv("ORGS_FILE")
+	cfg.CredentialPath = getEnv("CREDENTIAL_PATH", "user")
+	cfg.WalletCertPEM = os.Getenv("WALLET_CERT_PEM")
+	cfg.WalletKeyPEM = os.Getenv("WALLET_KEY_PEM")
+	if (cfg.WalletCertPEM == "") != (cfg.WalletKeyPEM == "") {
+		return nil, fmt.Errorf("WALLET_CERT_PEM and WALLET_KEY_PEM must be set together")
+	}
+
+	var err error
+	if cfg.Timeout, err = time.ParseDuration(getEnv("FABRIC_TIMEOUT", "15s")); err != nil {
+		return nil, fmt.Errorf("invalid FABRIC_TIMEOUT: %w", err)
+	}
+	if cfg.RequestTimeout, err = time.ParseDuration(getEnv("REQUEST_TIMEOUT", "30s")); err != nil {
+		return nil, fmt.Errorf("invalid REQUEST_TIMEOUT: %w", err)
+	}
+	if cfg.ShutdownTimeout, err = time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "30s")); err != nil {
+		return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+	}
+	if cfg.BatchAssetTimeout, err = time.ParseDuration(getEnv("BATCH_ASSET_TIMEOUT", "5s")); err != nil || cfg.BatchAssetTimeout < 0 {
+		return nil, fmt.Errorf("invalid BATCH_ASSET_TIMEOUT: must be a non-negative duration")
+	}
+	if cfg.MaxBodyBytes, err = strconv.ParseInt(getEnv("MAX_BODY_BYTES", "1048576"), 10, 64); err != nil || cfg.MaxBodyBytes < 0 {
+		return nil, fmt.Errorf("invalid MAX_BODY_BYTES: must be a non-negative number of bytes")
+	}
+	if cfg.StartupMaxAttempts, err = strconv.Atoi(getEnv("STARTUP_MAX_ATTEMPTS", "10")); err != nil || cfg.StartupMaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid STARTUP_MAX_ATTEMPTS: must be a positive integer")
+	}
+	if cfg.SubmitMaxAttempts, err = strconv.Atoi(getEnv("SUBMIT_MAX_ATTEMPTS", "3")); err != nil || cfg.SubmitMaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid SUBMIT_MAX_ATTEMPTS: must be a positive integer")
+	}
+	if cfg.SubmitRetryBackoff, err = time.ParseDuration(getEnv("SUBMIT_RETRY_BACKOFF", "200ms")); err != nil {
+		return nil, fmt.Errorf("invalid SUBMIT_RETRY_BACKOFF: %w", err)
+	}
+	if cfg.ExistsCacheTTL, err = time.ParseDuration(getEnv("EXISTS_CACHE_TTL", "3s")); err != nil {
+		return nil, fmt.Errorf("invalid EXISTS_CACHE_TTL: %w", err)
+	}
+	if cfg.ExistsCacheSize, err = strconv.Atoi(getEnv("EXISTS_CACHE_SIZE", "1024")); err != nil || cfg.ExistsCacheSize < 0 {
+		return nil, fmt.Errorf("invalid EXISTS_CACHE_SIZE: must be a non-negative integer")
+	}
+	if cfg.AssetCacheTTL, err = time.ParseDuration(getEnv("ASSET_CACHE_TTL", "5s")); err != nil {
+		return nil, fmt.Errorf("invalid ASSET_CACHE_TTL: %w", err)
+	}
+	if cfg.AssetCacheSize, err = strconv.Atoi(getEnv("ASSET_CACHE_SIZE", "1024")); err != nil || cfg.AssetCacheSize < 0 {
+		return nil, fmt.Errorf("invalid ASSET_CACHE_SIZE: must be a non-negative integer")
+	}
+	if cfg.IdempotencyTTL, err = time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h")); err != nil {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: %w", err)
+	}
+	if cfg.IdempotencyMaxKeys, err = strconv.Atoi(getEnv("IDEMPOTENCY_MAX_KEYS", "10000")); err != nil || cfg.IdempotencyMaxKeys < 1 {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_MAX_KEYS: must be a positive integer")
+	}
+	if cfg.OfflineSigningTTL, err = time.ParseDuration(getEnv("OFFLINE_SIGNING_TTL", "5m")); err != nil || cfg.OfflineSigningTTL < 0 {
+		return nil, fmt.Errorf("invalid OFFLINE_SIGNING_TTL: must be a non-negative duration")
+	}
+	if cfg.ContractPoolSize, err = strconv.Atoi(getEnv("CONTRACT_POOL_SIZE", "1")); err != nil || cfg.ContractPoolSize < 1 {
+		return nil, fmt.Errorf("invalid CONTRACT_POOL_SIZE: must be a positive integer")
+	}
+	if cfg.IdentityIdleTimeout, err = time.ParseDuration(getEnv("IDENTITY_IDLE_TIMEOUT", "10m")); err != nil {
+		return nil, fmt.Errorf("invalid IDENTITY_IDLE_TIMEOUT: %w", err)
+	}
+	if cfg.IdentityIdleTimeout > 0 && cfg.IdentityIdleTimeout <= cfg.RequestTimeout {
+		return nil, fmt.Errorf("IDENTITY_IDLE_TIMEOUT must be longer than REQUEST_TIMEOUT")
+	}
+	cfg.ProbeChaincode = getEnv("HEALTH_PROBE_CHAINCODE", "false") == "true"
+	cfg.LogFormat = getEnv("LOG_FORMAT", logFormatJSON)
+	if cfg.LogFormat != logFormatJSON && cfg.LogFormat != logFormatText {
+		return nil, fmt.Errorf("invalid LOG_FORMAT: must be %q or %q", logFormatJSON, logFormatText)
+	}
+	if err := cfg.LogLevel.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+	}
+	cfg.InvokeAllowedFunctions = os.Getenv("INVOKE_ALLOWED_FUNCTIONS")
+	cfg.CORSAllowedOrigins = getEnv("CORS_ALLOWED_ORIGINS", getEnv("ALLOWED_ORIGINS", defaultCORSOrigins))
+	cfg.CARegistrarID = getEnv("CA_REGISTRAR_ID", "admin")
+	cfg.CARegistrarSecret = os.Getenv("CA_REGISTRAR_SECRET")
+	cfg.APIKey = os.Getenv("API_KEY")
+	cfg.APIKeys = os.Getenv("API_KEYS")
+	cfg.APIKeysFile = os.Getenv("API_KEYS_FILE")
+	cfg.AuthProtectReads = getEnv("AUTH_PROTECT_READS", "false") == "true"
+	cfg.JWTSecret = os.Getenv("JWT_SECRET")
+	cfg.JWTJWKSURL = os.Getenv("JWT_JWKS_URL")
+	cfg.JWTIssuer = os.Getenv("JWT_ISSUER")
+	cfg.JWTRolesClaim = getEnv("JWT_ROLES_CLAIM", "roles")
+
+	if cfg.ReadRateLimit, err = strconv.ParseFloat(getEnv("RATE_LIMIT_READ_RPS", "0"), 64); err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_READ_RPS: %w", err)
+	}
+	if cfg.ReadRateBurst, err = strconv.Atoi(getEnv("RATE_LIMIT_READ_BURST", "0")); err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_READ_BURST: %w", err)
+	}
+	if cfg.WriteRateLimit, err = strconv.ParseFloat(getEnv("RATE_LIMIT_WRITE_RPS", "10"), 64); err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_WRITE_RPS: %w", err)
+	}
+	if cfg.WriteRateBurst, err = strconv.Atoi(getEnv("RATE_LIMIT_WRITE_BURST", "20")); err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_WRITE_BURST: %w", err)
+	}
+	cfg.TrustedProxies = os.Getenv("TRUSTED_PROXIES")
+
+	return cfg, nil
+}
+
+// getEnv returns the value of the environment variable key, or def when the
+// variable is unset or empty.
+func getEnv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestSkipInitDeprecated checks that --skip-init is still accepted, and
+// only warns, now that startup never seeds the ledger.
+func TestSkipInitDeprecated(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	if _, err := loadConfig([]string{"--skip-init"}); err != nil {
+		t.Fatalf("loadConfig(--skip-init): %v", err)
+	}
+	if !strings.Contains(logs.String(), "--skip-init is deprecated") {
+		t.Errorf("no deprecation warning was logged:\n%s", logs.String())
+	}
+}
+
+// TestFabricClientGatewayRefused checks that FABRIC_CLIENT=gateway fails
+// at startup, as no Fabric Gateway client is built in.
+func TestFabricClientGatewayRefused(t *testing.T) {
+	t.Setenv("FABRIC_CLIENT", "gateway")
+	if _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), "FABRIC_CLIENT") {
+		t.Errorf("loadConfig: err = %v, want FABRIC_CLIENT refused", err)
+	}
+}
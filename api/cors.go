@@ -0,0 +1,95 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsPolicy decides which browser origins may call the API. Matching
+// origins are echoed back individually, which lets the front end send
+// credentials; "*" in the list restores the old allow-everyone behaviour
+// for local demos, without credentials.
+type corsPolicy struct {
+	origins  map[string]bool
+	wildcard bool
+}
+
+// cors is the policy applied by corsMiddleware. main replaces it with the
+// configured one before serving.
+var cors = newCORSPolicy(defaultCORSOrigins)
+
+// defaultCORSOrigins allows any origin, as the API always has, when
+// CORS_ALLOWED_ORIGINS is unset. Deployments that serve browsers should
+// list their front end's origin instead.
+const defaultCORSOrigins = "*"
+
+// newCORSPolicy builds a policy from a comma-separated list of origins.
+func newCORSPolicy(list string) *corsPolicy {
+	p := &corsPolicy{origins: map[string]bool{}}
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		switch origin {
+		case "":
+		case "*":
+			p.wildcard = true
+		default:
+			p.origins[origin] = true
+		}
+	}
+	return p
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	return p.wildcard || p.origins[origin]
+}
+
+// apply sets the CORS response headers for req. It reports false for a
+// preflight from an origin that is not allowed, after answering it with 403.
+func (p *corsPolicy) apply(w http.ResponseWriter, req *http.Request) bool {
+	w.Header().Add("Vary", "Origin")
+
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if !p.allows(origin) {
+		if req.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusForbidden)
+			return false
+		}
+		// Leave the headers off so the browser refuses to expose the
+		// response; non-browser clients are unaffected by CORS anyway.
+		return true
+	}
+
+	if p.origins[origin] {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Fabric-Identity, X-Fabric-User, X-Chaincode, X-Fabric-Org, Idempotency-Key")
+	return true
+}
+
+// corsMiddleware applies the CORS policy to every response and answers
+// preflight requests itself, so handlers never see OPTIONS.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !cors.apply(w, req) {
+			return
+		}
+		if req.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPolicy(t *testing.T) {
+	const frontEnd = "http://localhost:5173"
+	tests := []struct {
+		name        string
+		origins     string
+		method      string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials bool
+	}{
+		{"listed origin", frontEnd, "GET", frontEnd, http.StatusOK, frontEnd, true},
+		{"listed origin with trailing slash", frontEnd + "/", "GET", frontEnd, http.StatusOK, frontEnd, true},
+		{"listed origin preflight", frontEnd, "OPTIONS", frontEnd, http.StatusNoContent, frontEnd, true},
+		{"other origin", frontEnd, "GET", "http://evil.example", http.StatusOK, "", false},
+		{"other origin preflight", frontEnd, "OPTIONS", "http://evil.example", http.StatusForbidden, "", false},
+		{"no origin", frontEnd, "GET", "", http.StatusOK, "", false},
+		{"wildcard", "*", "GET", "http://evil.example", http.StatusOK, "*", false},
+		{"wildcard preflight", "*", "OPTIONS", "http://evil.example", http.StatusNoContent, "*", false},
+		{"wildcard and listed origin", "*," + frontEnd, "GET", frontEnd, http.StatusOK, frontEnd, true},
+		{"default", defaultCORSOrigins, "GET", "http://evil.example", http.StatusOK, "*", false},
+	}
+	defer func(saved *corsPolicy) { cors = saved }(cors)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cors = newCORSPolicy(tt.origins)
+			served := false
+			h := corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				served = true
+			}))
+
+			req := httptest.NewRequest(tt.method, "/assets", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if served != (tt.method != "OPTIONS") {
+				t.Errorf("handler served = %v for %s", served, tt.method)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %v, want %v", got, tt.credentials)
+			}
+			if got := rec.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got)
+			}
+		})
+	}
+}
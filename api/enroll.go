@@ -0,0 +1,285 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+const (
+	codeUserExists       = "USER_ALREADY_EXISTS"
+	codeEnrollmentFailed = "ENROLLMENT_FAILED"
+)
+
+// EnrollRequest is the body of POST /enroll. Secret is the enrollment
+// secret the user was registered with at the CA.
+type EnrollRequest struct {
+	Username string `json:"username"`
+	Secret   string `json:"secret"`
+}
+
+// EnrollResult is returned once a user has been enrolled into the wallet.
+type EnrollResult struct {
+	Username string `json:"username"`
+	MspID    string `json:"mspId"`
+}
+
+// IdentityRequest is the body of POST /identities. Secret is optional; the
+// CA generates one when it is empty.
+type IdentityRequest struct {
+	Label       string `json:"label"`
+	Secret      string `json:"secret"`
+	Affiliation string `json:"affiliation"`
+}
+
+// IdentityResult describes an identity added to the wallet.
+type IdentityResult struct {
+	Label string `json:"label"`
+	MspID string `json:"mspId"`
+}
+
+// errAlreadyRegistered is returned by register when the CA already knows
+// the user.
+var errAlreadyRegistered = errors.New("identity is already registered with the CA")
+
+func (r IdentityRequest) fieldErrors() []FieldError {
+	return requireField(nil, "label", r.Label)
+}
+
+func (r EnrollRequest) fieldErrors() []FieldError {
+	var errs []FieldError
+	errs = requireField(errs, "username", r.Username)
+	errs = requireField(errs, "secret", r.Secret)
+	return errs
+}
+
+// caEnroller enrolls users against the CA of the client organization in
+// the connection profile. canRegister is false when no registrar secret
+// was given, in which case users can enroll but not be registered.
+type caEnroller struct {
+	sdk         *fabsdk.FabricSDK
+	client      *msp.Client
+	canRegister bool
+}
+
+// newCAEnroller connects to the CA of the connection profile at ccpPath.
+// The registrar is given here rather than in the profile, so that its
+// secret stays out of the files checked in with the API.
+func newCAEnroller(ccpPath, registrarID, registrarSecret string) (*caEnroller, error) {
+	provider := config.FromFile(filepath.Clean(ccpPath))
+	if registrarSecret != "" {
+		provider = withRegistrar(provider, registrarID, registrarSecret)
+	}
+	sdk, err := fabsdk.New(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SDK: %w", err)
+	}
+
+	client, err := msp.New(sdk.Context())
+	if err != nil {
+		sdk.Close()
+		return nil, fmt.Errorf("failed to create CA client: %w", err)
+	}
+	return &caEnroller{sdk: sdk, client: client, canRegister: registrarSecret != ""}, nil
+}
+
+// withRegistrar puts a registrarBackend in front of the backends provider
+// reads.
+func withRegistrar(provider core.ConfigProvider, id, secret string) core.ConfigProvider {
+	return func() ([]core.ConfigBackend, error) {
+		backends, err := provider()
+		if err != nil {
+			return nil, err
+		}
+		registrar := &registrarBackend{
+			backends:  backends,
+			registrar: map[string]interface{}{"enrollId": id, "enrollSecret": secret},
+		}
+		return append([]core.ConfigBackend{registrar}, backends...), nil
+	}
+}
+
+// registrarBackend answers the certificateAuthorities lookup of the
+// backends it wraps with the registrar set on every CA. The SDK takes the
+// first backend that knows a key, so every other key falls through.
+type registrarBackend struct {
+	backends  []core.ConfigBackend
+	registrar map[string]interface{}
+}
+
+func (b *registrarBackend) Lookup(key string) (interface{}, bool) {
+	if !strings.EqualFold(key, "certificateAuthorities") {
+		return nil, false
+	}
+	for _, backend := range b.backends {
+		value, ok := backend.Lookup(key)
+		if !ok {
+			continue
+		}
+		cas, ok := value.(map[string]interface{})
+		if !ok {
+			return value, true
+		}
+		withRegistrar := make(map[string]interface{}, len(cas))
+		for name, ca := range cas {
+			entry, ok := ca.(map[string]interface{})
+			if !ok {
+				withRegistrar[name] = ca
+				continue
+			}
+			copied := make(map[string]interface{}, len(entry)+1)
+			for k, v := range entry {
+				copied[k] = v
+			}
+			copied["registrar"] = b.registrar
+			withRegistrar[name] = copied
+		}
+		return withRegistrar, true
+	}
+	return nil, false
+}
+
+// enroll enrolls username with the CA and returns the resulting identity,
+// ready to be put in a wallet.
+func (e *caEnroller) enroll(username, secret string) (*gateway.X509Identity, error) {
+	if err := e.client.Enroll(username, msp.WithSecret(secret)); err != nil {
+		return nil, err
+	}
+
+	signer, err := e.client.GetSigningIdentity(username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrolled identity: %w", err)
+	}
+	key, err := signer.PrivateKey().Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to export private key: %w", err)
+	}
+
+	return gateway.NewX509Identity(signer.Identifier().MSPID, string(signer.EnrollmentCertificate()), string(key)), nil
+}
+
+// register registers label with the CA, as the registrar newCAEnroller
+// was given, and enrolls it.
+func (e *caEnroller) register(label, secret, affiliation string) (*gateway.X509Identity, error) {
+	secret, err := e.client.Register(&msp.RegistrationRequest{
+		Name:        label,
+		Type:        "client",
+		Affiliation: affiliation,
+		Secret:      secret,
+	})
+	if err != nil {
+		// The CA reports duplicates only in the message text.
+		if strings.Contains(err.Error(), "already registered") {
+			return nil, errAlreadyRegistered
+		}
+		return nil, fmt.Errorf("failed to register %s: %w", label, err)
+	}
+	return e.enroll(label, secret)
+}
+
+func (e *caEnroller) close() {
+	e.sdk.Close()
+}
+
+// Enroll serves POST /enroll, enrolling a user with the CA and storing the
+// issued identity in the wallet under the username.
+func (wh *walletHandler) Enroll(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+
+	enrollment := EnrollRequest{}
+	if !readJSON(w, req, &enrollment) {
+		return
+	}
+	if !validate(w, enrollment) {
+		return
+	}
+
+	if wh.ca == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("enrollment is not available: no CA client is configured"))
+		return
+	}
+	if wh.wallet.Exists(enrollment.Username) {
+		writeError(w, http.StatusConflict, withCode(codeUserExists, fmt.Errorf("user %s already exists in the wallet", enrollment.Username)))
+		return
+	}
+
+	slog.InfoContext(req.Context(), "enrolling user", "username", enrollment.Username)
+	identity, err := wh.ca.enroll(enrollment.Username, enrollment.Secret)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, withCode(codeEnrollmentFailed, fmt.Errorf("failed to enroll %s: %w", enrollment.Username, err)))
+		return
+	}
+
+	if err := wh.wallet.Put(enrollment.Username, identity); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to store identity for %s: %w", enrollment.Username, err))
+		return
+	}
+
+	writeData(w, http.StatusCreated, EnrollResult{Username: enrollment.Username, MspID: identity.MspID})
+}
+
+// RegisterIdentity serves POST /identities: it registers a new user with
+// the CA, enrolls it and stores the identity in the wallet under its label.
+func (wh *walletHandler) RegisterIdentity(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+
+	identityReq := IdentityRequest{}
+	if !readJSON(w, req, &identityReq) {
+		return
+	}
+	if !validate(w, identityReq) {
+		return
+	}
+
+	if wh.ca == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("registration is not available: no CA client is configured"))
+		return
+	}
+	if !wh.ca.canRegister {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("registration is not available: CA_REGISTRAR_SECRET is not set"))
+		return
+	}
+	if wh.wallet.Exists(identityReq.Label) {
+		writeError(w, http.StatusConflict, withCode(codeUserExists, fmt.Errorf("identity %s already exists in the wallet", identityReq.Label)))
+		return
+	}
+
+	slog.InfoContext(req.Context(), "registering identity", "label", identityReq.Label)
+	identity, err := wh.ca.register(identityReq.Label, identityReq.Secret, identityReq.Affiliation)
+	if errors.Is(err, errAlreadyRegistered) {
+		writeError(w, http.StatusConflict, withCode(codeUserExists, fmt.Errorf("identity %s is already registered with the CA", identityReq.Label)))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, withCode(codeEnrollmentFailed, err))
+		return
+	}
+
+	if err := wh.wallet.Put(identityReq.Label, identity); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to store identity for %s: %w", identityReq.Label, err))
+		return
+	}
+
+	writeData(w, http.StatusCreated, IdentityResult{Label: identityReq.Label, MspID: identity.MspID})
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config/lookup"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	mspconfig "github.com/hyperledger/fabric-sdk-go/pkg/msp"
+)
+
+// certificateAuthorities reads the CAs of the connection profile the way
+// the SDK's CA client does.
+func certificateAuthorities(t *testing.T, provider core.ConfigProvider) map[string]mspconfig.CAConfig {
+	t.Helper()
+	backends, err := provider()
+	if err != nil {
+		t.Fatalf("reading the connection profile: %v", err)
+	}
+	var cas map[string]mspconfig.CAConfig
+	if err := lookup.New(backends...).UnmarshalKey("certificateAuthorities", &cas); err != nil {
+		t.Fatalf("UnmarshalKey: %v", err)
+	}
+	if len(cas) == 0 {
+		t.Fatal("the connection profile has no CAs")
+	}
+	return cas
+}
+
+func TestRegistrar(t *testing.T) {
+	const profile = "connection/connection-org1.yaml"
+
+	for name, ca := range certificateAuthorities(t, config.FromFile(profile)) {
+		if ca.Registrar.EnrollID != "" || ca.Registrar.EnrollSecret != "" {
+			t.Errorf("%s: the profile has registrar %q; it must come from CA_REGISTRAR_SECRET", name, ca.Registrar.EnrollID)
+		}
+	}
+
+	for name, ca := range certificateAuthorities(t, withRegistrar(config.FromFile(profile), "registrar", "s3cret")) {
+		if ca.Registrar.EnrollID != "registrar" || ca.Registrar.EnrollSecret != "s3cret" {
+			t.Errorf("%s: registrar = %+v, want registrar with its secret", name, ca.Registrar)
+		}
+		if ca.URL == "" {
+			t.Errorf("%s: the rest of the CA's settings were lost", name)
+		}
+	}
+}
+
+// TestRegisterWithoutRegistrar checks that /identities answers 503 when no
+// registrar secret was configured.
+func TestRegisterWithoutRegistrar(t *testing.T) {
+	wh := newTestHandler(&fakeContract{})
+	wh.auth = &apiKeyAuth{keys: [][]byte{[]byte("secret")}}
+	wh.wallet = gateway.NewInMemoryWallet()
+	wh.ca = &caEnroller{}
+
+	rec := serve(newRouter(wh), "POST", "/identities", `{"label":"user2"}`, apiKeyHeader, "secret")
+	expectError(t, rec, http.StatusServiceUnavailable, codeGatewayUnavailable)
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"google.golang.org/grpc/codes"
+)
+
+// Machine-readable error codes returned in APIError.Code. Clients should
+// branch on these rather than on the human-readable message.
+const (
+	codeAssetNotFound        = "ASSET_NOT_FOUND"
+	codeAssetExists          = "ASSET_ALREADY_EXISTS"
+	codeChaincodeError       = "CHAINCODE_ERROR"
+	codeGatewayUnavailable   = "GATEWAY_UNAVAILABLE"
+	codeTimeout              = "TIMEOUT"
+	codeInvalidRequest       = "INVALID_REQUEST"
+	codeValidationFailed     = "VALIDATION_FAILED"
+	codeNotFound             = "NOT_FOUND"
+	codeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	codeInternal             = "INTERNAL_ERROR"
+	codePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	codeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	codeTransactionInvalid   = "TRANSACTION_INVALID"
+)
+
+// Error categories returned in APIError.Category.
+const (
+	categoryChaincode = "chaincode"
+	categoryNetwork   = "network"
+	categoryTimeout   = "timeout"
+)
+
+// APIError is the error part of an APIResponse.
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	// TxID is set when a submitted transaction failed after it was given
+	// an id, for instance when the peers invalidated it at commit.
+	TxID string `json:"txId,omitempty"`
+	// Category is set for failed calls to the Fabric network: "chaincode"
+	// when the chaincode or the peers' validation rejected the call,
+	// "network" when the network could not carry it out and "timeout"
+	// when it ran out of time.
+	Category string `json:"category,omitempty"`
+}
+
+// codedError attaches an explicit error code to err.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+func withCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// txError attaches the id of the failed transaction to err.
+type txError struct {
+	txID string
+	err  error
+}
+
+func (e *txError) Error() string { return e.err.Error() }
+func (e *txError) Unwrap() error { return e.err }
+
+// failedTxID returns the transaction id in err's chain, if any.
+func failedTxID(err error) string {
+	var tx *txError
+	if errors.As(err, &tx) {
+		return tx.txID
+	}
+	return ""
+}
+
+func assetNotFoundError(id string) error {
+	return withCode(codeAssetNotFound, fmt.Errorf("asset %s does not exist", id))
+}
+
+func assetExistsError(id string) error {
+	return withCode(codeAssetExists, fmt.Errorf("asset %s already exists", id))
+}
+
+func bodyTooLargeError(max int64) error {
+	return withCode(codePayloadTooLarge, fmt.Errorf("request body exceeds the limit of %d bytes", max))
+}
+
+// errorCode picks the code reported for err, which is being sent with the
+// given HTTP status. An explicit code wins; otherwise it is inferred from
+// the error and finally from the status.
+func errorCode(status int, err error) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return codeTimeout
+	}
+	if isChaincodeError(err) {
+		return codeChaincodeError
+	}
+	if isValidationFailure(err) {
+		return codeTransactionInvalid
+	}
+	if _, ok := sdkStatus(err); ok {
+		return codeGatewayUnavailable
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidRequest
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed
+	case http.StatusRequestEntityTooLarge:
+		return codePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return codeTransactionInvalid
+	case http.StatusGatewayTimeout:
+		return codeTimeout
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codeGatewayUnavailable
+	}
+	return codeInternal
+}
+
+// sdkStatus finds the fabric-sdk-go status in err's chain. The SDK wraps
+// with github.com/pkg/errors, which status.FromError understands, while this
+// package wraps with fmt.Errorf, so both kinds of wrapping are peeled here.
+func sdkStatus(err error) (*status.Status, bool) {
+	for err != nil {
+		if s, ok := status.FromError(err); ok {
+			return s, true
+		}
+		err = errors.Unwrap(err)
+	}
+	return nil, false
+}
+
+// errorCategory classifies an error of a call to the Fabric network, or
+// returns "" when err did not come from one.
+func errorCategory(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return categoryTimeout
+	}
+	if isChaincodeError(err) || isValidationFailure(err) {
+		return categoryChaincode
+	}
+	if _, ok := sdkStatus(err); ok || isConnectivityError(err) {
+		return categoryNetwork
+	}
+	return ""
+}
+
+// isValidationFailure reports whether err is a transaction the peers
+// endorsed but then invalidated at commit, for instance for an MVCC read
+// conflict or an unsatisfied endorsement policy.
+func isValidationFailure(err error) bool {
+	s, ok := sdkStatus(err)
+	return ok && s.Group == status.EventServerStatus && peer.TxValidationCode(s.Code) != peer.TxValidationCode_VALID
+}
+
+// isConnectivityError reports whether err means a peer or orderer could not
+// be reached at all, as opposed to one that answered with a failure.
+func isConnectivityError(err error) bool {
+	if errors.Is(err, errNetworkUnavailable) {
+		return true
+	}
+	s, ok := sdkStatus(err)
+	if !ok {
+		return false
+	}
+	switch s.Group {
+	case status.GRPCTransportStatus:
+		return codes.Code(s.Code) == codes.Unavailable
+	case status.EndorserClientStatus, status.OrdererClientStatus, status.ClientStatus:
+		return s.Code == status.ConnectionFailed.ToInt32()
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"golang.org/x/net/websocket"
+)
+
+// streamedEvents are the chaincode events forwarded to /events clients.
+var streamedEvents = []string{"CreateAsset", "TransferAsset"}
+
+// chaincodeEventSource is the part of *gateway.Contract the event hub
+// uses.
+type chaincodeEventSource interface {
+	RegisterEvent(eventFilter string) (fab.Registration, <-chan *fab.CCEvent, error)
+	Unregister(registration fab.Registration)
+}
+
+var _ chaincodeEventSource = (*gateway.Contract)(nil)
+
+// listenedEvents are the chaincode events the hub registers for: the
+// streamed ones, and those of every other asset write, which only
+// invalidate cached reads of the asset.
+func listenedEvents() []string {
+	names := append([]string(nil), streamedEvents...)
+	for name := range assetWrites {
+		if !isStreamedEvent(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[len(streamedEvents):])
+	return names
+}
+
+// eventBufferSize is how many events a client may fall behind by before it
+// is disconnected.
+const eventBufferSize = 64
+
+// ChaincodeEvent is the JSON message sent to /events clients.
+type ChaincodeEvent struct {
+	EventName   string          `json:"eventName"`
+	TxID        string          `json:"txId"`
+	BlockNumber uint64          `json:"blockNumber"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+// eventHub fans chaincode events out to every connected client. The
+// contract listeners are registered once, by listen, and shared by all
+// subscribers. Each client maps to the event names it asked for, or nil
+// for all of them.
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]map[string]bool
+	// assetChanged, when set before listen, is called with the id of the
+	// asset each event is about.
+	assetChanged func(id string)
+	// backoff is the first wait before registering again.
+	backoff time.Duration
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[chan []byte]map[string]bool), backoff: time.Second}
+}
+
+// listen registers a listener for each of listenedEvents on the contract
+// source returns and broadcasts what it receives, until the returned
+// function is called. Only the first registration fails listen. If an
+// event stream closes later, or registering again fails, it reports the
+// connection broken and registers anew, on the connection that replaced
+// it, with exponential backoff.
+func (h *eventHub) listen(source eventSource[chaincodeEventSource]) (stop func(), err error) {
+	contract, broken := source()
+	listeners, err := h.register(contract)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		backoff := h.backoff
+		for {
+			if listeners != nil {
+				select {
+				case <-listeners.closed:
+					listeners.unregister()
+					slog.Warn("chaincode event stream closed, registering again", "retry_in", backoff)
+					broken()
+				case <-done:
+					listeners.unregister()
+					return
+				}
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-done:
+				return
+			}
+			contract, broken = source()
+			if listeners, err = h.register(contract); err != nil {
+				backoff = min(backoff*2, eventsMaxBackoff)
+				slog.Warn("failed to register for chaincode events", "retry_in", backoff, "error", err)
+				broken()
+				continue
+			}
+			backoff = h.backoff
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
+
+// eventListeners are the listeners registered on one contract. closed is
+// closed once any of their event streams is.
+type eventListeners struct {
+	contract      chaincodeEventSource
+	registrations []fab.Registration
+	closed        chan struct{}
+	once          sync.Once
+}
+
+// register registers a listener for each of listenedEvents on contract.
+func (h *eventHub) register(contract chaincodeEventSource) (*eventListeners, error) {
+	listeners := &eventListeners{contract: contract, closed: make(chan struct{})}
+	for _, name := range listenedEvents() {
+		reg, events, err := contract.RegisterEvent(name)
+		if err != nil {
+			listeners.unregister()
+			return nil, fmt.Errorf("failed to register for %s events: %w", name, err)
+		}
+		listeners.registrations = append(listeners.registrations, reg)
+
+		go func() {
+			for event := range events {
+				h.broadcast(event)
+			}
+			listeners.once.Do(func() { close(listeners.closed) })
+		}()
+	}
+	return listeners, nil
+}
+
+func (l *eventListeners) unregister() {
+	for _, reg := range l.registrations {
+		l.contract.Unregister(reg)
+	}
+}
+
+// broadcast invalidates the asset event is about and, when it is a
+// streamed event, sends it to the clients that asked for it.
+func (h *eventHub) broadcast(event *fab.CCEvent) {
+	if h.assetChanged != nil {
+		var record ledgerRecord
+		if err := json.Unmarshal(event.Payload, &record); err == nil {
+			if id := record.asset().AssetID; id != "" {
+				h.assetChanged(id)
+			}
+		}
+	}
+	if !isStreamedEvent(event.EventName) {
+		return
+	}
+
+	msg, err := json.Marshal(ChaincodeEvent{
+		EventName:   event.EventName,
+		TxID:        event.TxID,
+		BlockNumber: event.BlockNumber,
+		Payload:     chaincodeData(event.Payload),
+	})
+	if err != nil {
+		slog.Error("failed to encode chaincode event", "event", event.EventName, "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client, names := range h.clients {
+		if names != nil && !names[event.EventName] {
+			continue
+		}
+		select {
+		case client <- msg:
+		default:
+			// The client is not keeping up; drop it rather than
+			// holding back everyone else.
+			delete(h.clients, client)
+			close(client)
+		}
+	}
+}
+
+// subscribe adds a client that receives the events in names, or every
+// event when names is nil.
+func (h *eventHub) subscribe(names map[string]bool) chan []byte {
+	client := make(chan []byte, eventBufferSize)
+	h.mu.Lock()
+	h.clients[client] = names
+	h.mu.Unlock()
+	return client
+}
+
+// close disconnects every client. Hijacked WebSocket connections are not
+// closed by http.Server.Shutdown, so main calls this first.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client)
+	}
+}
+
+func (h *eventHub) unsubscribe(client chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client)
+	}
+}
+
+// parseEventFilter parses the comma-separated ?events= parameter. It
+// returns nil, meaning every event, when the parameter is absent.
+func parseEventFilter(req *http.Request) (map[string]bool, error) {
+	param := req.URL.Query().Get("events")
+	if param == "" {
+		return nil, nil
+	}
+
+	names := make(map[string]bool)
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if !isStreamedEvent(name) {
+			return nil, fmt.Errorf("unknown event %q, expected one of %s", name, strings.Join(streamedEvents, ", "))
+		}
+		names[name] = true
+	}
+	return names, nil
+}
+
+func isStreamedEvent(name string) bool {
+	for _, streamed := range streamedEvents {
+		if name == streamed {
+			return true
+		}
+	}
+	return false
+}
+
+// Events serves the /events WebSocket, streaming each chaincode event as a
+// JSON text message until the client disconnects. ?events=CreateAsset
+// limits the stream to the listed event names.
+func (wh *walletHandler) Events(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		methodNotAllowed(w, req, "GET")
+		return
+	}
+	if wh.events == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("event streaming is not available"))
+		return
+	}
+	names, err := parseEventFilter(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			if origin := req.Header.Get("Origin"); origin != "" && !cors.allows(origin) {
+				return fmt.Errorf("origin %s is not allowed", origin)
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			wh.streamEvents(ws, names)
+		},
+	}
+	server.ServeHTTP(w, req)
+}
+
+func (wh *walletHandler) streamEvents(ws *websocket.Conn, names map[string]bool) {
+	defer ws.Close()
+
+	client := wh.events.subscribe(names)
+	defer wh.events.unsubscribe(client)
+
+	// Clients do not send anything; reading only tells us when they go.
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, ws)
+		close(gone)
+	}()
+
+	for {
+		select {
+		case msg, ok := <-client:
+			if !ok {
+				return
+			}
+			if err := websocket.Message.Send(ws, string(msg)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
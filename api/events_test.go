@@ -0,0 +1,206 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// fakeEventSource hands out one event channel per registration and
+// remembers which are still registered. Unregistering closes the channel,
+// as the SDK does.
+type fakeEventSource struct {
+	mu         sync.Mutex
+	channels   map[string]chan *fab.CCEvent
+	registered map[string]bool
+	err        error
+}
+
+func newFakeEventSource() *fakeEventSource {
+	return &fakeEventSource{channels: make(map[string]chan *fab.CCEvent), registered: make(map[string]bool)}
+}
+
+func (s *fakeEventSource) RegisterEvent(name string) (fab.Registration, <-chan *fab.CCEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	events := make(chan *fab.CCEvent, 1)
+	s.channels[name] = events
+	s.registered[name] = true
+	return name, events, nil
+}
+
+func (s *fakeEventSource) Unregister(reg fab.Registration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := reg.(string)
+	delete(s.registered, name)
+	if events, ok := s.channels[name]; ok {
+		close(events)
+		delete(s.channels, name)
+	}
+}
+
+// drop closes the event stream of name, as a lost peer connection does.
+func (s *fakeEventSource) drop(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.channels[name])
+	delete(s.channels, name)
+}
+
+// only is the eventSource of a hub that always registers on s.
+func (s *fakeEventSource) only() (chaincodeEventSource, func()) {
+	return s, func() {}
+}
+
+// send delivers an event about asset1 to the listener of name.
+func (s *fakeEventSource) send(name string) {
+	s.mu.Lock()
+	events := s.channels[name]
+	s.mu.Unlock()
+	events <- &fab.CCEvent{EventName: name, TxID: "tx1", Payload: []byte(asset1)}
+}
+
+func (s *fakeEventSource) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestEventInvalidation checks that an event from every asset write
+// invalidates the asset, and that only the streamed events reach /events
+// clients.
+func TestEventInvalidation(t *testing.T) {
+	hub := newEventHub()
+	changed := make(chan string, 1)
+	hub.assetChanged = func(id string) { changed <- id }
+	source := newFakeEventSource()
+	stop, err := hub.listen(source.only)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	want := []string{"CreateAsset", "DeleteAsset", "TransferAsset", "UpdateAsset"}
+	if got := source.names(); !reflect.DeepEqual(got, want) {
+		t.Errorf("registered for %v, want %v", got, want)
+	}
+
+	client := hub.subscribe(nil)
+	for _, name := range want {
+		source.send(name)
+		select {
+		case id := <-changed:
+			if id != "asset1" {
+				t.Errorf("%s invalidated %q, want asset1", name, id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s did not invalidate the asset", name)
+		}
+	}
+
+	var streamed []string
+	for len(streamed) < len(streamedEvents) {
+		select {
+		case msg := <-client:
+			streamed = append(streamed, string(msg))
+		case <-time.After(time.Second):
+			t.Fatalf("the client got %d events, want %d", len(streamed), len(streamedEvents))
+		}
+	}
+	select {
+	case msg := <-client:
+		t.Errorf("the client got an event that is not streamed: %s", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	stop()
+	if names := source.names(); len(names) != 0 {
+		t.Errorf("still registered for %v after stop", names)
+	}
+}
+
+func TestEventListenFailure(t *testing.T) {
+	source := newFakeEventSource()
+	source.err = errors.New("peer unavailable")
+	if _, err := newEventHub().listen(source.only); err == nil {
+		t.Error("listen succeeded without registrations")
+	}
+}
+
+// TestEventsResumeAfterStreamCloses drops an event stream and checks that
+// the hub reports the connection broken, registers again on the
+// connection that replaced it and delivers its events.
+func TestEventsResumeAfterStreamCloses(t *testing.T) {
+	first, second := newFakeEventSource(), newFakeEventSource()
+	var mu sync.Mutex
+	current, reported := first, 0
+	source := func() (chaincodeEventSource, func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		conn := current
+		return conn, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if current == conn {
+				reported++
+				current = second
+			}
+		}
+	}
+
+	hub := newEventHub()
+	hub.backoff = time.Millisecond
+	stop, err := hub.listen(source)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer stop()
+	client := hub.subscribe(nil)
+
+	first.drop("TransferAsset")
+	deadline := time.Now().Add(time.Second)
+	for len(second.names()) != len(listenedEvents()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("registered for %v on the new connection, want %v", second.names(), listenedEvents())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if names := first.names(); len(names) != 0 {
+		t.Errorf("still registered for %v on the old connection", names)
+	}
+	mu.Lock()
+	if reported != 1 {
+		t.Errorf("the connection was reported broken %d times, want 1", reported)
+	}
+	mu.Unlock()
+
+	second.send("TransferAsset")
+	select {
+	case msg := <-client:
+		if !strings.Contains(string(msg), `"eventName":"TransferAsset"`) {
+			t.Errorf("the client got %s, want a TransferAsset event", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event was delivered after registering again")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// existsCache remembers AssetExists results for a short time, so a burst of
+// mutations on the same asset does not evaluate it on the ledger each time.
+// It holds at most size entries; a zero ttl or size disables it.
+type existsCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.RWMutex
+	entries map[string]existsEntry
+}
+
+type existsEntry struct {
+	exists  bool
+	expires time.Time
+}
+
+func newExistsCache(ttl time.Duration, size int) *existsCache {
+	return &existsCache{ttl: ttl, size: size, entries: make(map[string]existsEntry)}
+}
+
+func (c *existsCache) enabled() bool {
+	return c != nil && c.ttl > 0 && c.size > 0
+}
+
+func (c *existsCache) get(id string) (exists, ok bool) {
+	if !c.enabled() {
+		return false, false
+	}
+	c.mu.RLock()
+	entry, found := c.entries[id]
+	c.mu.RUnlock()
+	if !found || time.Now().After(entry.expires) {
+		return false, false
+	}
+	return entry.exists, true
+}
+
+func (c *existsCache) put(id string, exists bool) {
+	if !c.enabled() {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expired entries are dropped once the map is full. If none have
+	// expired the result is not cached, rather than growing past size.
+	if _, found := c.entries[id]; !found && len(c.entries) >= c.size {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= c.size {
+			return
+		}
+	}
+	c.entries[id] = existsEntry{exists: exists, expires: now.Add(c.ttl)}
+}
+
+func (c *existsCache) invalidate(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
+}
+
+// assetExists is checkIfAssetExists behind the exists cache. Failed checks
+// are not cached.
+func (wh *walletHandler) assetExists(ctx context.Context, id string) (bool, error) {
+	key := existsCacheKey(ctx, id)
+	if exists, ok := wh.existsCache.get(key); ok {
+		return exists, nil
+	}
+	exists, err := wh.checkIfAssetExists(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	wh.existsCache.put(key, exists)
+	return exists, nil
+}
+
+// assetCheckError wraps the error of a failed existence check and picks
+// its status. The check is not what the client asked for, so whatever made
+// it fail is the network's fault: it answers 502 with GATEWAY_UNAVAILABLE,
+// or 504 when the request ran out of time.
+func assetCheckError(id string, err error) (int, error) {
+	err = fmt.Errorf("failed to check whether asset %s exists: %w", id, err)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return http.StatusGatewayTimeout, err
+	}
+	return http.StatusBadGateway, withCode(codeGatewayUnavailable, err)
+}
+
+func writeAssetCheckError(w http.ResponseWriter, id string, err error) {
+	status, err := assetCheckError(id, err)
+	writeError(w, status, err)
+}
+
+// existsCacheKey keys an asset id by the channel and chaincode the request
+// is scoped to, since the same id can exist in one and not another.
+func existsCacheKey(ctx context.Context, id string) string {
+	channel, chaincode := channelFor(ctx), chaincodeFor(ctx)
+	if channel == "" && chaincode == "" {
+		return id
+	}
+	return channel + "\x00" + chaincode + "\x00" + id
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestExistsCacheSize checks that the cache stops taking new assets once
+// it holds size of them, and takes them again as entries expire.
+func TestExistsCacheSize(t *testing.T) {
+	c := newExistsCache(20*time.Millisecond, 2)
+	c.put("a1", true)
+	c.put("a2", false)
+	c.put("a3", true)
+	if _, ok := c.get("a3"); ok {
+		t.Error("a3 was cached past the size")
+	}
+	c.put("a1", false)
+	if exists, ok := c.get("a1"); !ok || exists {
+		t.Errorf("a1 = %v, %v, want false, true after refreshing a cached asset", exists, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	c.put("a3", true)
+	if exists, ok := c.get("a3"); !ok || !exists {
+		t.Errorf("a3 = %v, %v, want true, true once the others expired", exists, ok)
+	}
+	if n := len(c.entries); n != 1 {
+		t.Errorf("%d entries, want the expired ones dropped", n)
+	}
+}
+
+// BenchmarkAssetExists checks the same few assets over and over, with and
+// without the cache, and reports how many of the checks reached the ledger.
+func BenchmarkAssetExists(b *testing.B) {
+	ids := make([]string, 16)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("asset%d", i)
+	}
+	for _, bb := range []struct {
+		name  string
+		cache *existsCache
+	}{
+		{"uncached", nil},
+		{"cached", newExistsCache(time.Minute, 1024)},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			contract := &fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})}
+			wh := newTestHandler(contract)
+			wh.existsCache = bb.cache
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := wh.assetExists(ctx, ids[i%len(ids)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(contract.count("AssetExists"))/float64(b.N), "evaluates/op")
+		})
+	}
+}
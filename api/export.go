@@ -0,0 +1,111 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// exportFlushRows is how many CSV rows are buffered before they are sent.
+const exportFlushRows = 100
+
+// csvHeader is the first row of GET /assets/export?format=csv.
+var csvHeader = []string{"asset_id", "colour", "size", "owner", "appraised_value"}
+
+// csvFormulaPrefixes are the characters that make a spreadsheet read a
+// cell as a formula.
+const csvFormulaPrefixes = "=+-@"
+
+// csvCell escapes value so that a spreadsheet opening the export shows it
+// as text rather than running it: a value that starts with a formula
+// character is prefixed with a quote.
+func csvCell(value string) string {
+	if value != "" && strings.IndexByte(csvFormulaPrefixes, value[0]) >= 0 {
+		return "'" + value
+	}
+	return value
+}
+
+// csvValue undoes csvCell, so that an exported file imports unchanged.
+func csvValue(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.IndexByte(csvFormulaPrefixes, cell[1]) >= 0 {
+		return cell[1:]
+	}
+	return cell
+}
+
+// ExportAssets serves GET /assets/export?format=csv, a download of every
+// asset on the ledger. Rows are written as the chaincode result is decoded
+// rather than after converting all of it.
+func (wh *walletHandler) ExportAssets(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		methodNotAllowed(w, req, "GET")
+		return
+	}
+	if format := req.URL.Query().Get("format"); format != "" && format != "csv" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported export format %q, only csv is available", format))
+		return
+	}
+
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	result, err := wh.evaluate(ctx, "GetAllAssets")
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+
+	out := csv.NewWriter(w)
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="assets.csv"`)
+		w.WriteHeader(http.StatusOK)
+		return out.Write(csvHeader)
+	}
+
+	rows := 0
+	err = eachLedgerAsset(result, func(asset Asset) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := out.Write([]string{csvCell(asset.AssetID), csvCell(asset.Colour), csvCell(asset.Size), csvCell(asset.Owner), csvCell(asset.AppraisedValue)}); err != nil {
+			return err
+		}
+		if rows++; rows%exportFlushRows == 0 {
+			out.Flush()
+			return out.Error()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("unexpected GetAllAssets response: %w", err))
+		return
+	}
+	if err != nil {
+		// The status line has gone out, so the only way left to tell the
+		// client the file is incomplete is to break the connection.
+		slog.ErrorContext(ctx, "asset export failed", "rows", rows, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		start()
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		slog.WarnContext(ctx, "asset export was not fully sent", "rows", rows, "error", err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestExportEscapesFormulas checks that cells a spreadsheet would run as
+// formulas are exported as text, and that importing the export gives the
+// assets back unchanged.
+func TestExportEscapesFormulas(t *testing.T) {
+	asset := `{"ID":"=1+1","Color":"@SUM(A1)","Size":5,"Owner":"-2+3","AppraisedValue":300}`
+	wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{"formula": asset, "asset1": asset1})})
+
+	rec := serve(newRouter(wh), "GET", "/assets/export", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "'=1+1,'@SUM(A1),5,'-2+3,300\n") {
+		t.Errorf("the formulas were not escaped:\n%s", rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), "asset1,blue,5,Tomoko,300\n") {
+		t.Errorf("a plain row was changed:\n%s", rec.Body)
+	}
+
+	assets, err := parseAssetCSV(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("parseAssetCSV: %v", err)
+	}
+	want := Asset{AssetID: "=1+1", Colour: "@SUM(A1)", Size: "5", Owner: "-2+3", AppraisedValue: "300"}
+	for _, got := range assets {
+		if got.AssetID == want.AssetID && !reflect.DeepEqual(got, want) {
+			t.Errorf("imported %+v, want %+v", got, want)
+		}
+	}
+	if len(assets) != 2 {
+		t.Errorf("imported %d assets, want 2", len(assets))
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value, cell string
+	}{
+		{"Tomoko", "Tomoko"},
+		{"", ""},
+		{"=cmd", "'=cmd"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@x", "'@x"},
+		{"a=b", "a=b"},
+		{"'quoted", "'quoted"},
+	}
+	for _, tt := range tests {
+		if got := csvCell(tt.value); got != tt.cell {
+			t.Errorf("csvCell(%q) = %q, want %q", tt.value, got, tt.cell)
+		}
+		if got := csvValue(tt.cell); got != tt.value {
+			t.Errorf("csvValue(%q) = %q, want %q", tt.cell, got, tt.value)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:assetpb -I assetpb assetpb/asset.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/m/v2/assetpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// assetServer implements assetpb.AssetServiceServer on top of the same
+// walletHandler the HTTP routes use, so both share the gateway connections,
+// the exists cache and the retry policy.
+type assetServer struct {
+	wh *walletHandler
+}
+
+var _ assetpb.AssetServiceServer = (*assetServer)(nil)
+
+// newGRPCServer builds the gRPC server for the AssetService. Requests are
+// authenticated like the HTTP API, with the API key in x-api-key or a
+// bearer token in authorization metadata, and may choose their signing
+// identity with x-fabric-user or, with mutual TLS, their client certificate,
+// and their chaincode with x-chaincode.
+func newGRPCServer(wh *walletHandler, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.UnaryInterceptor(wh.grpcInterceptor))
+	srv := grpc.NewServer(opts...)
+	assetpb.RegisterAssetServiceServer(srv, &assetServer{wh: wh})
+	return srv
+}
+
+// grpcInterceptor applies the request timeout, authentication and identity
+// selection to every AssetService call.
+func (wh *walletHandler) grpcInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, wh.timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, requestIDKey{}, newRequestID())
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	write := method != "GetAsset" && method != "ListAssets"
+	token := first("authorization")
+	if scheme, value, ok := strings.Cut(token, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(value)
+	} else {
+		token = ""
+	}
+	subject, _, err := wh.auth.authorize(first(strings.ToLower(apiKeyHeader)), token, write, method)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if subject != "" {
+		ctx = context.WithValue(ctx, subjectKey{}, subject)
+	}
+
+	label := first(strings.ToLower(fabricUserHeader))
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			ctx, label = wh.withClientCert(ctx, &info.State, label)
+		}
+	}
+	ctx, _, err = wh.selectContract(ctx, first(strings.ToLower(orgHeader)), label, first(strings.ToLower(chaincodeHeader)))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil {
+		slog.WarnContext(ctx, "gRPC call failed", "method", method, "error", err)
+	}
+	return resp, err
+}
+
+func (s *assetServer) CreateAsset(ctx context.Context, req *assetpb.CreateAssetRequest) (*assetpb.CreateAssetResponse, error) {
+	asset := fromProto(req.GetAsset())
+	if errs := asset.fieldErrors(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+	exists, err := s.wh.assetExists(ctx, asset.AssetID)
+	if err != nil {
+		return nil, assetCheckGRPCError(asset.AssetID, err)
+	}
+	if exists {
+		return nil, grpcError(assetExistsError(asset.AssetID))
+	}
+
+	_, txID, err := s.wh.submitTx(ctx, "CreateAsset", asset.AssetID, asset.Colour, asset.Size, asset.Owner, asset.AppraisedValue)
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("failed to submit transaction: %w", err))
+	}
+	return &assetpb.CreateAssetResponse{TxId: txID}, nil
+}
+
+func (s *assetServer) TransferAsset(ctx context.Context, req *assetpb.TransferAssetRequest) (*assetpb.TransferAssetResponse, error) {
+	transaction := PostTransaction{AssetID: req.GetAssetId(), Owner: req.GetOwner()}
+	if errs := transaction.fieldErrors(); len(errs) > 0 {
+		return nil, invalidArgument(errs)
+	}
+	exists, err := s.wh.assetExists(ctx, transaction.AssetID)
+	if err != nil {
+		return nil, assetCheckGRPCError(transaction.AssetID, err)
+	}
+	if !exists {
+		return nil, grpcError(assetNotFoundError(transaction.AssetID))
+	}
+
+	result, txID, err := s.wh.submitTx(ctx, "TransferAsset", transaction.AssetID, transaction.Owner)
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("failed to submit transaction: %w", err))
+	}
+
+	// Newer chaincode returns the previous owner, as JSON or a bare string;
+	// older chaincode returns nothing and it is left empty.
+	var previousOwner string
+	_ = json.Unmarshal(chaincodeData(result), &previousOwner)
+	return &assetpb.TransferAssetResponse{TxId: txID, PreviousOwner: previousOwner}, nil
+}
+
+func (s *assetServer) GetAsset(ctx context.Context, req *assetpb.GetAssetRequest) (*assetpb.Asset, error) {
+	id := req.GetAssetId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "asset_id is required")
+	}
+	exists, err := s.wh.assetExists(ctx, id)
+	if err != nil {
+		return nil, assetCheckGRPCError(id, err)
+	}
+	if !exists {
+		return nil, grpcError(assetNotFoundError(id))
+	}
+
+	result, err := s.wh.readLedgerAsset(ctx, id)
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("failed to evaluate transaction: %w", err))
+	}
+	var record ledgerRecord
+	if err := json.Unmarshal(result, &record); err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected ReadAsset response: %v", err)
+	}
+	return toProto(record.asset()), nil
+}
+
+// ListAssets returns every asset, or those of one owner. Like
+// GET /assets?owner=NAME it prefers the chaincode's QueryAssetsByOwner and
+// falls back to filtering GetAllAssets.
+func (s *assetServer) ListAssets(ctx context.Context, req *assetpb.ListAssetsRequest) (*assetpb.ListAssetsResponse, error) {
+	owner := req.GetOwner()
+	function := "GetAllAssets"
+	var (
+		result []byte
+		err    error
+	)
+	if owner != "" {
+		result, err = s.wh.evaluate(ctx, "QueryAssetsByOwner", owner)
+		if err == nil {
+			function = "QueryAssetsByOwner"
+		} else if ctx.Err() != nil {
+			return nil, grpcError(fmt.Errorf("failed to evaluate transaction: %w", err))
+		}
+	}
+	if function == "GetAllAssets" {
+		if result, err = s.wh.evaluate(ctx, "GetAllAssets"); err != nil {
+			return nil, grpcError(fmt.Errorf("failed to evaluate transaction: %w", err))
+		}
+	}
+
+	resp := &assetpb.ListAssetsResponse{}
+	err = eachLedgerAsset(result, func(asset Asset) error {
+		if owner == "" || asset.Owner == owner {
+			resp.Assets = append(resp.Assets, toProto(asset))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unexpected %s response: %v", function, err)
+	}
+	return resp, nil
+}
+
+func (s *assetServer) DeleteAsset(ctx context.Context, req *assetpb.DeleteAssetRequest) (*assetpb.DeleteAssetResponse, error) {
+	id := req.GetAssetId()
+	if id == "" {
+		return nil, status.Error(codes.InvalidArgument, "asset_id is required")
+	}
+	exists, err := s.wh.assetExists(ctx, id)
+	if err != nil {
+		return nil, assetCheckGRPCError(id, err)
+	}
+	if !exists {
+		return nil, grpcError(assetNotFoundError(id))
+	}
+
+	_, txID, err := s.wh.submitTx(ctx, "DeleteAsset", id)
+	if err != nil {
+		return nil, grpcError(fmt.Errorf("failed to submit transaction: %w", err))
+	}
+	return &assetpb.DeleteAssetResponse{TxId: txID}, nil
+}
+
+func fromProto(a *assetpb.Asset) Asset {
+	return Asset{
+		AssetID:        a.GetAssetId(),
+		Colour:         a.GetColour(),
+		Size:           a.GetSize(),
+		Owner:          a.GetOwner(),
+		AppraisedValue: a.GetAppraisedValue(),
+	}
+}
+
+func toProto(a Asset) *assetpb.Asset {
+	return &assetpb.Asset{
+		AssetId:        a.AssetID,
+		Colour:         a.Colour,
+		Size:           a.Size,
+		Owner:          a.Owner,
+		AppraisedValue: a.AppraisedValue,
+	}
+}
+
+// invalidArgument reports field errors the way validate does for HTTP,
+// one "field: message" per failed field.
+func invalidArgument(errs []FieldError) error {
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		parts[i] = e.Field + ": " + e.Message
+	}
+	return status.Errorf(codes.InvalidArgument, "request validation failed: %s", strings.Join(parts, "; "))
+}
+
+// grpcError maps an error to a gRPC status by the same rules errorCode uses
+// for the HTTP API.
+func grpcError(err error) error {
+	code := codes.Internal
+	switch errorCode(transactionErrorStatus(err), err) {
+	case codeAssetNotFound, codeChaincodeNotFound:
+		code = codes.NotFound
+	case codeAssetExists:
+		code = codes.AlreadyExists
+	case codeOrgNotFound:
+		code = codes.InvalidArgument
+	case codeUnauthorized:
+		code = codes.Unauthenticated
+	case codeForbidden:
+		code = codes.PermissionDenied
+	case codeChaincodeError:
+		code = codes.FailedPrecondition
+	case codeTransactionInvalid:
+		code = codes.Aborted
+	case codeGatewayUnavailable:
+		code = codes.Unavailable
+	case codeTimeout:
+		code = codes.DeadlineExceeded
+		if errors.Is(err, context.Canceled) {
+			code = codes.Canceled
+		}
+	}
+	return status.Error(code, err.Error())
+}
+
+// assetCheckGRPCError is assetCheckError for the gRPC service.
+func assetCheckGRPCError(id string, err error) error {
+	_, err = assetCheckError(id, err)
+	return grpcError(err)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/m/v2/assetpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialAssetService serves the AssetService of wh over an in-memory
+// listener and returns a client connected to it.
+func dialAssetService(t *testing.T, wh *walletHandler) assetpb.AssetServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(wh)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("grpc.Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return assetpb.NewAssetServiceClient(conn)
+}
+
+// TestAssetService calls every AssetService method over gRPC against a
+// mocked contract.
+func TestAssetService(t *testing.T) {
+	contract := &fakeContract{
+		evaluate: ledger(map[string]string{"asset1": asset1}),
+		submit:   answering(`"Tomoko"`),
+	}
+	client := dialAssetService(t, newTestHandler(contract))
+	ctx := context.Background()
+
+	_, err := client.CreateAsset(ctx, &assetpb.CreateAssetRequest{Asset: &assetpb.Asset{
+		AssetId: "asset9", Colour: "blue", Size: "5", Owner: "Tomoko", AppraisedValue: "300",
+	}})
+	if err != nil {
+		t.Fatalf("CreateAsset: %v", err)
+	}
+
+	asset, err := client.GetAsset(ctx, &assetpb.GetAssetRequest{AssetId: "asset1"})
+	if err != nil {
+		t.Fatalf("GetAsset: %v", err)
+	}
+	if asset.GetAssetId() != "asset1" || asset.GetOwner() != "Tomoko" || asset.GetSize() != "5" {
+		t.Errorf("GetAsset = %v, want asset1 owned by Tomoko", asset)
+	}
+
+	list, err := client.ListAssets(ctx, &assetpb.ListAssetsRequest{})
+	if err != nil {
+		t.Fatalf("ListAssets: %v", err)
+	}
+	if len(list.GetAssets()) != 1 || list.GetAssets()[0].GetAssetId() != "asset1" {
+		t.Errorf("ListAssets = %v, want asset1", list.GetAssets())
+	}
+
+	transferred, err := client.TransferAsset(ctx, &assetpb.TransferAssetRequest{AssetId: "asset1", Owner: "Max"})
+	if err != nil {
+		t.Fatalf("TransferAsset: %v", err)
+	}
+	if transferred.GetPreviousOwner() != "Tomoko" {
+		t.Errorf("previous owner = %q, want Tomoko", transferred.GetPreviousOwner())
+	}
+
+	if _, err := client.DeleteAsset(ctx, &assetpb.DeleteAssetRequest{AssetId: "asset1"}); err != nil {
+		t.Fatalf("DeleteAsset: %v", err)
+	}
+	for _, name := range []string{"CreateAsset", "TransferAsset", "DeleteAsset"} {
+		if n := contract.count(name); n != 1 {
+			t.Errorf("%s submitted %d times, want 1", name, n)
+		}
+	}
+}
+
+// TestAssetServiceErrors checks that failures reach gRPC clients with the
+// canonical status codes.
+func TestAssetServiceErrors(t *testing.T) {
+	existing := &assetpb.Asset{AssetId: "asset1", Colour: "blue", Size: "5", Owner: "Tomoko", AppraisedValue: "300"}
+	tests := []struct {
+		name     string
+		evaluate func(string, ...string) ([]byte, error)
+		call     func(context.Context, assetpb.AssetServiceClient) error
+		code     codes.Code
+	}{
+		{"missing asset", ledger(map[string]string{}), func(ctx context.Context, c assetpb.AssetServiceClient) error {
+			_, err := c.GetAsset(ctx, &assetpb.GetAssetRequest{AssetId: "asset1"})
+			return err
+		}, codes.NotFound},
+		{"existing asset", ledger(map[string]string{"asset1": asset1}), func(ctx context.Context, c assetpb.AssetServiceClient) error {
+			_, err := c.CreateAsset(ctx, &assetpb.CreateAssetRequest{Asset: existing})
+			return err
+		}, codes.AlreadyExists},
+		{"unreachable peer", failing(errPeerUnreachable), func(ctx context.Context, c assetpb.AssetServiceClient) error {
+			_, err := c.ListAssets(ctx, &assetpb.ListAssetsRequest{})
+			return err
+		}, codes.Unavailable},
+		{"invalid asset", ledger(map[string]string{}), func(ctx context.Context, c assetpb.AssetServiceClient) error {
+			_, err := c.CreateAsset(ctx, &assetpb.CreateAssetRequest{Asset: &assetpb.Asset{AssetId: "asset9"}})
+			return err
+		}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := &fakeContract{evaluate: tt.evaluate}
+			client := dialAssetService(t, newTestHandler(contract))
+			err := tt.call(context.Background(), client)
+			if got := status.Code(err); got != tt.code {
+				t.Errorf("code = %v, want %v: %v", got, tt.code, err)
+			}
+			if n := contract.count("CreateAsset"); n != 0 {
+				t.Errorf("CreateAsset submitted %d times, want 0", n)
+			}
+		})
+	}
+}
+
+// TestAssetServiceAuth checks that the API key is required in metadata
+// when authentication is on.
+func TestAssetServiceAuth(t *testing.T) {
+	wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})})
+	wh.auth = &apiKeyAuth{keys: [][]byte{[]byte("secret")}, protectReads: true}
+	client := dialAssetService(t, wh)
+
+	_, err := client.GetAsset(context.Background(), &assetpb.GetAssetRequest{AssetId: "asset1"})
+	if got := status.Code(err); got != codes.Unauthenticated {
+		t.Errorf("without a key: code = %v, want %v", got, codes.Unauthenticated)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret")
+	if _, err := client.GetAsset(ctx, &assetpb.GetAssetRequest{AssetId: "asset1"}); err != nil {
+		t.Errorf("with the key: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// readinessTimeout bounds the probe transaction so a hung peer fails
+	// the check instead of the kubelet's own timeout.
+	readinessTimeout = 3 * time.Second
+	// readinessCacheTTL is how long a probe result is reused, so frequent
+	// probes from several kubelets do not each reach the peer.
+	readinessCacheTTL = 2 * time.Second
+)
+
+// Readiness is the body of /readyz. Gateway and Chaincode are "ok" or a
+// description of what failed.
+type Readiness struct {
+	Status    string    `json:"status"`
+	Gateway   string    `json:"gateway"`
+	Chaincode string    `json:"chaincode,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// readinessCheck caches the last readiness probe.
+type readinessCheck struct {
+	mu     sync.Mutex
+	result *Readiness
+}
+
+// Healthz serves /healthz, a liveness probe that succeeds whenever the
+// process can serve HTTP.
+func (wh *walletHandler) Healthz(w http.ResponseWriter, req *http.Request) {
+	writeData(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz serves /readyz, a readiness probe that evaluates a transaction to
+// check the Fabric network is reachable.
+func (wh *walletHandler) Readyz(w http.ResponseWriter, req *http.Request) {
+	// The result is shared with other callers, so a client hanging up must
+	// not cancel the probe and cache a failure.
+	ctx := context.WithoutCancel(req.Context())
+	result := wh.readiness.get(func() *Readiness { return wh.probeReadiness(ctx) })
+
+	if result.Status == "ok" {
+		writeData(w, http.StatusOK, result)
+		return
+	}
+
+	raw, _ := json.Marshal(result)
+	writeResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Success: false,
+		Data:    raw,
+		Error: &APIError{
+			Code:      codeGatewayUnavailable,
+			Message:   "Fabric network is unreachable",
+			RequestID: w.Header().Get(requestIDHeader),
+		},
+	})
+}
+
+// get returns the cached result, running probe when it is missing or stale.
+// Concurrent callers wait for a single probe rather than starting their own.
+func (c *readinessCheck) get(probe func() *Readiness) *Readiness {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.result == nil || time.Since(c.result.CheckedAt) > readinessCacheTTL {
+		c.result = probe()
+	}
+	return c.result
+}
+
+func (wh *walletHandler) probeReadiness(ctx context.Context) *Readiness {
+	result := &Readiness{Status: "ok", Gateway: "ok", CheckedAt: time.Now()}
+
+	if wh.network == nil || wh.contract == nil {
+		result.Status = "unavailable"
+		result.Gateway = "gateway is not connected"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	if _, err := wh.evaluate(ctx, "AssetExists", "readiness-probe"); err != nil {
+		slog.WarnContext(ctx, "readiness probe failed", "error", err)
+		result.Status = "unavailable"
+		result.Chaincode = err.Error()
+		return result
+	}
+	result.Chaincode = "ok"
+	return result
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// maxIdempotencyKeyLength caps the Idempotency-Key header.
+	maxIdempotencyKeyLength = 255
+
+	codeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+)
+
+// idempotencyStore remembers the responses to requests sent with an
+// Idempotency-Key header, so that a client retrying a create whose
+// response it never received gets that response again instead of a
+// second submission. Keys are kept for ttl, and once size keys are held
+// the oldest are forgotten first.
+type idempotencyStore struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *idempotencyEntry, oldest first
+	entries map[string]*list.Element
+}
+
+// idempotencyEntry is a key's request and, once done is closed, its
+// response.
+type idempotencyEntry struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	expires     time.Time
+	done        chan struct{}
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+func newIdempotencyStore(ttl time.Duration, size int) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// begin returns the entry of key. The caller owns a new entry and must
+// finish or abandon it; an existing entry belongs to an earlier request.
+func (s *idempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (entry *idempotencyEntry, existing bool) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for front := s.order.Front(); front != nil && !now.Before(front.Value.(*idempotencyEntry).expires); front = s.order.Front() {
+		s.remove(front)
+	}
+	if elem, found := s.entries[key]; found {
+		return elem.Value.(*idempotencyEntry), true
+	}
+	for s.order.Len() >= s.size {
+		s.remove(s.order.Front())
+	}
+	entry = &idempotencyEntry{key: key, fingerprint: fingerprint, expires: now.Add(s.ttl), done: make(chan struct{})}
+	s.entries[key] = s.order.PushBack(entry)
+	return entry, false
+}
+
+// finish stores the response of entry for later requests with its key.
+func (s *idempotencyStore) finish(entry *idempotencyEntry, status int, header http.Header, body []byte) {
+	entry.status, entry.header, entry.body = status, header, body
+	close(entry.done)
+}
+
+// abandon forgets entry, so the request can be retried with its key. It
+// is used for responses a retry might improve on, such as a 5xx.
+func (s *idempotencyStore) abandon(entry *idempotencyEntry) {
+	s.mu.Lock()
+	if elem, found := s.entries[entry.key]; found && elem.Value == entry {
+		s.remove(elem)
+	}
+	s.mu.Unlock()
+	close(entry.done)
+}
+
+// remove drops elem. Callers hold s.mu.
+func (s *idempotencyStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*idempotencyEntry).key)
+}
+
+// idempotent makes next replay its earlier response to a request that
+// repeats an Idempotency-Key. Reusing a key with a different request is
+// refused with 422, and a repeat that arrives while the first request is
+// still being served waits for it. Requests without the header, and every
+// request when the store is disabled, go straight to next.
+func (wh *walletHandler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(idempotencyKeyHeader)
+		if key == "" || wh.idempotency == nil || wh.idempotency.ttl <= 0 {
+			next(w, req)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, bodyTooLargeError(tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := req.Context()
+		fingerprint := sha256.Sum256(append([]byte(req.Method+" "+req.URL.RequestURI()+"\n"), body...))
+		entry, existing := wh.idempotency.begin(wh.idempotencyScope(ctx, key), fingerprint)
+		if existing {
+			wh.replay(w, req, entry, fingerprint)
+			return
+		}
+
+		// The request id is set before the buffer, where writeError looks
+		// for it, but it belongs to this request alone and is not stored.
+		rec := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		if id := w.Header().Get(requestIDHeader); id != "" {
+			rec.header.Set(requestIDHeader, id)
+		}
+		defer func() {
+			if rec.status >= http.StatusInternalServerError || rec.status == http.StatusTooManyRequests {
+				wh.idempotency.abandon(entry)
+			} else {
+				header := rec.header.Clone()
+				header.Del(requestIDHeader)
+				wh.idempotency.finish(entry, rec.status, header, rec.body.Bytes())
+			}
+			rec.writeTo(w)
+		}()
+		next(rec, req)
+	}
+}
+
+// replay answers req with the response stored in entry, waiting for it
+// when the first request with the key is still being served.
+func (wh *walletHandler) replay(w http.ResponseWriter, req *http.Request, entry *idempotencyEntry, fingerprint [sha256.Size]byte) {
+	if entry.fingerprint != fingerprint {
+		writeError(w, http.StatusUnprocessableEntity, withCode(codeIdempotencyKeyReused, fmt.Errorf("%s was already used for a different request", idempotencyKeyHeader)))
+		return
+	}
+	select {
+	case <-entry.done:
+	case <-req.Context().Done():
+		writeError(w, http.StatusGatewayTimeout, req.Context().Err())
+		return
+	}
+	if entry.header == nil {
+		writeError(w, http.StatusConflict, withCode(codeIdempotencyKeyReused, fmt.Errorf("the earlier request with this %s failed; retry it", idempotencyKeyHeader)))
+		return
+	}
+
+	for name, values := range entry.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(entry.status)
+	w.Write(entry.body)
+}
+
+// idempotencyScope qualifies key with who sent it and where it applies,
+// so that clients choosing the same key do not see each other's responses.
+func (wh *walletHandler) idempotencyScope(ctx context.Context, key string) string {
+	return subjectFrom(ctx) + "\x00" + orgFor(ctx) + "\x00" + wh.identityFor(ctx) + "\x00" + channelFor(ctx) + "\x00" + chaincodeFor(ctx) + "\x00" + key
+}
+
+// bufferedResponse holds a response until the handler has finished, so it
+// can be stored before it is sent.
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header { return r.header }
+
+func (r *bufferedResponse) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+}
+
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(b)
+}
+
+func (r *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range r.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIdempotentErrorsCarryRequestID checks that errors written through
+// the idempotency buffer carry the request id, and that a replay carries
+// the id of the request it answers rather than the one it was stored by.
+func TestIdempotentErrorsCarryRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"field errors", `{"asset_id":"asset9"}`, http.StatusBadRequest, codeValidationFailed},
+		{"chaincode error", `{"asset_id":"asset1","owner":"Tomoko","colour":"blue","size":"5","appraised_value":"300"}`, http.StatusConflict, codeAssetExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})})
+			wh.idempotency = newIdempotencyStore(time.Minute, 16)
+			h := withRequestID(newRouter(wh))
+
+			first := serve(h, "POST", "/create-asset", tt.body, idempotencyKeyHeader, "key-1", requestIDHeader, "request-1")
+			if resp := expectError(t, first, tt.status, tt.code); resp.Error.RequestID != "request-1" {
+				t.Errorf("requestId = %q, want request-1", resp.Error.RequestID)
+			}
+
+			replay := serve(h, "POST", "/create-asset", tt.body, idempotencyKeyHeader, "key-1", requestIDHeader, "request-2")
+			expectError(t, replay, tt.status, tt.code)
+			if got := replay.Header().Get("Idempotent-Replayed"); got != "true" {
+				t.Errorf("Idempotent-Replayed = %q, want true", got)
+			}
+			if got := replay.Header().Values(requestIDHeader); len(got) != 1 || got[0] != "request-2" {
+				t.Errorf("%s = %q, want request-2", requestIDHeader, got)
+			}
+		})
+	}
+}
+
+// TestIdempotentConcurrentRequests sends the same create many times at
+// once with one Idempotency-Key. The asset must be created once, and every
+// request must get the same response.
+func TestIdempotentConcurrentRequests(t *testing.T) {
+	const clients = 50
+	contract := &fakeContract{
+		evaluate: ledger(map[string]string{}),
+		// Slow enough for the repeats to arrive while the first is served.
+		submit: sleeping(20*time.Millisecond, nil),
+	}
+	wh := newTestHandler(contract)
+	wh.idempotency = newIdempotencyStore(time.Minute, 16)
+	h := newRouter(wh)
+
+	var (
+		wg        sync.WaitGroup
+		start     = make(chan struct{})
+		responses = make([]*httptest.ResponseRecorder, clients)
+	)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			responses[i] = serve(h, "POST", "/create-asset", createBody, idempotencyKeyHeader, "key-1")
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if n := contract.count("CreateAsset"); n != 1 {
+		t.Errorf("CreateAsset submitted %d times, want 1", n)
+	}
+	replayed := 0
+	for i, rec := range responses {
+		if rec.Code != http.StatusCreated {
+			t.Errorf("client %d: status = %d, want %d: %s", i, rec.Code, http.StatusCreated, rec.Body)
+		}
+		if rec.Body.String() != responses[0].Body.String() {
+			t.Errorf("client %d: body = %s, want %s", i, rec.Body, responses[0].Body)
+		}
+		if rec.Header().Get("Idempotent-Replayed") == "true" {
+			replayed++
+		}
+	}
+	if replayed != clients-1 {
+		t.Errorf("%d responses replayed, want %d", replayed, clients-1)
+	}
+
+	// A different body under the same key is refused.
+	other := serve(h, "POST", "/create-asset", strings.Replace(createBody, "asset9", "asset10", 1), idempotencyKeyHeader, "key-1")
+	expectError(t, other, http.StatusUnprocessableEntity, codeIdempotencyKeyReused)
+}
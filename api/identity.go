@@ -0,0 +1,545 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// Requests choose the wallet identity to sign with through either header;
+// X-Fabric-User is the name the front end uses. X-Chaincode picks one of
+// the configured chaincodes.
+const (
+	fabricIdentityHeader = "X-Fabric-Identity"
+	fabricUserHeader     = "X-Fabric-User"
+	chaincodeHeader      = "X-Chaincode"
+
+	codeChaincodeNotFound = "CHAINCODE_NOT_FOUND"
+
+	// startupMaxBackoff caps the wait between attempts to reach the
+	// network at startup.
+	startupMaxBackoff = 30 * time.Second
+)
+
+// connectGateway connects to the network described by cfg as the wallet
+// identity label.
+func connectGateway(cfg *appConfig, wallet identityWallet, label string) (*gateway.Gateway, error) {
+	return gateway.Connect(
+		gateway.WithConfig(config.FromFile(filepath.Clean(cfg.CCPPath))),
+		gateway.WithIdentity(wallet, label),
+		gateway.WithTimeout(cfg.Timeout),
+	)
+}
+
+// connectNetwork connects as the wallet user and gets the configured
+// channel, retrying both with exponential backoff up to
+// cfg.StartupMaxAttempts times, so that the API waits for a network that
+// is still coming up instead of exiting.
+func connectNetwork(cfg *appConfig, wallet identityWallet) (*gateway.Gateway, *gateway.Network, error) {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		gw, err := connectGateway(cfg, wallet, cfg.WalletUser)
+		if err != nil {
+			err = fmt.Errorf("failed to connect to gateway: %w", err)
+		} else {
+			network, netErr := gw.GetNetwork(cfg.ChannelName)
+			if netErr == nil {
+				return gw, network, nil
+			}
+			gw.Close()
+			err = fmt.Errorf("failed to get network: channel %q does not exist or %s is not a member of it: %w", cfg.ChannelName, cfg.WalletUser, netErr)
+		}
+
+		if attempt >= cfg.StartupMaxAttempts {
+			return nil, nil, err
+		}
+		slog.Warn("Fabric network is not reachable yet", "attempt", attempt, "max_attempts", cfg.StartupMaxAttempts, "retry_in", backoff, "error", err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > startupMaxBackoff {
+			backoff = startupMaxBackoff
+		}
+	}
+}
+
+// identityPool keeps one gateway connection per wallet identity, opened the
+// first time a request asks for that identity and reused afterwards, and
+// the contracts obtained through it, one per channel and chaincode. A
+// connection is retired once it has been idle for a while, or when a call
+// through it fails because it broke; the next request reconnects, and the
+// retired connection is closed when the calls still in flight on it
+// finish.
+type identityPool struct {
+	cfg *appConfig
+
+	mu        sync.Mutex
+	gateways  map[string]*poolConnection
+	contracts map[poolKey]ContractInvoker
+	lastUsed  map[string]time.Time
+	// connecting holds the connection attempts in progress by label, so
+	// that requests for a label share one attempt while requests for
+	// other labels go ahead.
+	connecting map[string]*connectCall
+	// closed is set by close, after which nothing connects again.
+	closed bool
+
+	// connect opens the connection of a label: the client's, except in
+	// tests.
+	connect func(label string) (fabricGateway, error)
+}
+
+// connectCall is a connection attempt that other requests may wait for.
+// conn and err are set before done is closed.
+type connectCall struct {
+	done chan struct{}
+	conn *poolConnection
+	err  error
+}
+
+// poolConnection is the gateway connection of one identity. Like
+// fabricConnection it counts the calls in flight on it: once retired no
+// more start, and the last call to finish closes it.
+type poolConnection struct {
+	gw fabricGateway
+
+	mu      sync.Mutex
+	calls   int
+	retired bool
+	closed  bool
+}
+
+// acquire counts a call in flight on conn, and fails once conn is retired.
+func (conn *poolConnection) acquire() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.retired {
+		return false
+	}
+	conn.calls++
+	return true
+}
+
+func (conn *poolConnection) release() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.calls--
+	conn.closeIfIdle()
+}
+
+// retire stops new calls on conn and closes it once the calls in flight
+// finish.
+func (conn *poolConnection) retire() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.retired = true
+	conn.closeIfIdle()
+}
+
+// closeIfIdle closes a retired connection with no calls in flight.
+// Callers hold conn.mu.
+func (conn *poolConnection) closeIfIdle() {
+	if !conn.retired || conn.calls > 0 || conn.closed {
+		return
+	}
+	conn.closed = true
+	conn.gw.close()
+}
+
+// pooledContract is a contract the pool handed out. Each call is counted
+// in flight on its connection; a call made after the connection was
+// retired goes through the connection of the same identity that replaced
+// it, so that requests holding the contract are not failed by an
+// eviction.
+type pooledContract struct {
+	pool     *identityPool
+	key      poolKey
+	conn     *poolConnection
+	contract ContractInvoker
+}
+
+// use returns the contract to call and the connection to release once the
+// call is done.
+func (c *pooledContract) use() (ContractInvoker, *poolConnection, error) {
+	for !c.conn.acquire() {
+		current, err := c.pool.contractOn(c.key.label, c.key.channel, c.key.chaincode)
+		if err != nil {
+			return nil, nil, err
+		}
+		c = current.(*pooledContract)
+	}
+	return c.contract, c.conn, nil
+}
+
+func (c *pooledContract) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	contract, conn, err := c.use()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.release()
+	return contract.EvaluateTransaction(name, args...)
+}
+
+func (c *pooledContract) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	result, _, err := c.submitWithTxID(name, txOptions{}, args...)
+	return result, err
+}
+
+func (c *pooledContract) submitWithTxID(name string, opts txOptions, args ...string) ([]byte, string, error) {
+	contract, conn, err := c.use()
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.release()
+	return submitWithTxID(contract, name, opts, args...)
+}
+
+type poolKey struct {
+	label     string
+	channel   string
+	chaincode string
+}
+
+func newIdentityPool(cfg *appConfig, client fabricClient) *identityPool {
+	return &identityPool{
+		cfg:        cfg,
+		gateways:   make(map[string]*poolConnection),
+		contracts:  make(map[poolKey]ContractInvoker),
+		lastUsed:   make(map[string]time.Time),
+		connecting: make(map[string]*connectCall),
+		connect:    client.connect,
+	}
+}
+
+// contract returns the default chaincode's contract bound to label on the
+// default channel, connecting on first use.
+func (p *identityPool) contract(label string) (ContractInvoker, error) {
+	return p.contractOn(label, p.cfg.ChannelName, p.cfg.ChaincodeName)
+}
+
+// contractOn returns the contract of chaincode bound to label on channel,
+// connecting and getting the network on first use. Neither is done under
+// p.mu, so a slow peer holds up only the requests for that identity.
+func (p *identityPool) contractOn(label, channel, chaincode string) (ContractInvoker, error) {
+	key := poolKey{label, channel, chaincode}
+	p.mu.Lock()
+	if contract, ok := p.contracts[key]; ok {
+		p.lastUsed[label] = time.Now()
+		p.mu.Unlock()
+		return contract, nil
+	}
+	p.mu.Unlock()
+
+	conn, err := p.gateway(label)
+	if err != nil {
+		return nil, err
+	}
+	gwContract, err := conn.gw.contract(channel, chaincode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel %s as %s: %w", channel, label, err)
+	}
+	var contract ContractInvoker = &pooledContract{pool: p, key: key, conn: conn, contract: gwContract}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached, ok := p.contracts[key]; ok {
+		contract = cached
+	} else if p.gateways[label] == conn {
+		// Unless the connection was closed in the meantime.
+		p.contracts[key] = contract
+	}
+	p.lastUsed[label] = time.Now()
+	return contract, nil
+}
+
+// gateway returns the connection of label, connecting when there is none.
+// Callers that find an attempt for label in progress wait for its result
+// instead of connecting again.
+func (p *identityPool) gateway(label string) (*poolConnection, error) {
+	p.mu.Lock()
+	if conn, ok := p.gateways[label]; ok {
+		p.mu.Unlock()
+		return conn, nil
+	}
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errNetworkUnavailable
+	}
+	call, inProgress := p.connecting[label]
+	if !inProgress {
+		call = &connectCall{done: make(chan struct{})}
+		p.connecting[label] = call
+	}
+	p.mu.Unlock()
+
+	if inProgress {
+		<-call.done
+		return call.conn, call.err
+	}
+
+	slog.Info("Connecting gateway for identity", "identity", label)
+	gw, err := p.connect(label)
+	if err != nil {
+		call.err = fmt.Errorf("failed to connect as %s: %w", label, err)
+	} else {
+		call.conn = &poolConnection{gw: gw}
+	}
+
+	p.mu.Lock()
+	delete(p.connecting, label)
+	if call.err == nil && p.closed {
+		call.conn.retire()
+	} else if call.err == nil {
+		p.gateways[label] = call.conn
+		setGatewayConnected(label, true)
+	}
+	p.mu.Unlock()
+	close(call.done)
+	return call.conn, call.err
+}
+
+// connected reports whether the pool holds a connection for label.
+func (p *identityPool) connected(label string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.gateways[label]
+	return ok
+}
+
+// closeIdleEvery retires, every idle/2, the connections no request has
+// used for idle. The returned function stops it.
+func (p *identityPool) closeIdleEvery(idle time.Duration) (stop func()) {
+	ticker := time.NewTicker(idle / 2)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				p.closeIdle(now.Add(-idle))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// closeIdle retires the connections last used before cutoff.
+func (p *identityPool) closeIdle(cutoff time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for label, used := range p.lastUsed {
+		if used.Before(cutoff) {
+			slog.Info("Closing idle gateway", "identity", label)
+			p.closeLabel(label)
+		}
+	}
+}
+
+// evict retires the connection of label, so that the next request for it
+// connects again.
+func (p *identityPool) evict(label string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.gateways[label]; ok {
+		slog.Warn("Dropping broken gateway connection", "identity", label)
+		p.closeLabel(label)
+	}
+}
+
+// closeLabel retires the connection of label and forgets its contracts.
+// The connection is closed once the calls in flight on it finish. Callers
+// hold p.mu.
+func (p *identityPool) closeLabel(label string) {
+	if conn, ok := p.gateways[label]; ok {
+		conn.retire()
+		delete(p.gateways, label)
+		setGatewayConnected(label, false)
+	}
+	delete(p.lastUsed, label)
+	for key := range p.contracts {
+		if key.label == label {
+			delete(p.contracts, key)
+		}
+	}
+}
+
+func (p *identityPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for label := range p.gateways {
+		p.closeLabel(label)
+	}
+}
+
+type (
+	contractKey  struct{}
+	identityKey  struct{}
+	chaincodeKey struct{}
+)
+
+// errIdentityRefused is the one error a request gets for an identity it
+// cannot use, whether the label is missing from the wallet or could not
+// connect, so that responses do not tell which labels the wallet holds.
+var errIdentityRefused = withCode(codeUnauthorized, errors.New("the requested identity cannot be used"))
+
+// withIdentity lets a request choose the wallet identity its transactions
+// are signed with and the chaincode they target. Requests without either
+// identity header use the identity the API was started with; labels that
+// cannot be used are refused with errIdentityRefused. With mutual TLS, a
+// client certificate whose CN is in the client identity map selects its
+// mapped label instead of the headers. Requests without X-Chaincode use
+// the default chaincode, and requests without X-Fabric-Org the
+// organization the API was started as.
+//
+// Routes run it inside their auth wrapper, so that callers without
+// credentials can neither probe the wallet nor make the API connect.
+func (wh *walletHandler) withIdentity(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "OPTIONS" {
+			next(w, req)
+			return
+		}
+		label := req.Header.Get(fabricUserHeader)
+		if label == "" {
+			label = req.Header.Get(fabricIdentityHeader)
+		}
+		ctx := req.Context()
+		if req.TLS != nil {
+			ctx, label = wh.withClientCert(ctx, req.TLS, label)
+		}
+
+		ctx, status, err := wh.selectContract(ctx, req.Header.Get(orgHeader), label, req.Header.Get(chaincodeHeader))
+		if err != nil {
+			writeError(w, status, err)
+			return
+		}
+		next(w, req.WithContext(ctx))
+	}
+}
+
+// selectContract binds ctx to the contract of label and chaincode on the
+// channel channelScoped selected, in org when it is not empty, where empty
+// values mean the defaults. It returns the HTTP status to refuse the
+// request with when any is unknown or the gateway cannot be connected.
+func (wh *walletHandler) selectContract(ctx context.Context, org, label, chaincode string) (context.Context, int, error) {
+	if org != "" {
+		return wh.selectOrgContract(ctx, org, label, chaincode)
+	}
+	if label == wh.walletUser {
+		label = ""
+	}
+	if chaincode == wh.chaincodeName {
+		chaincode = ""
+	}
+	channel := channelFor(ctx)
+	if label == "" && chaincode == "" && channel == "" {
+		return ctx, 0, nil
+	}
+	if wh.identities == nil {
+		return nil, http.StatusServiceUnavailable, withCode(codeGatewayUnavailable, errors.New("this API serves only its default identity, channel and chaincode"))
+	}
+
+	if label != "" && !wh.wallet.Exists(label) {
+		status, err := refuseIdentity(ctx, label, errors.New("not in the wallet"))
+		return nil, status, err
+	}
+	if chaincode != "" && !wh.chaincodes[chaincode] {
+		return nil, http.StatusNotFound, withCode(codeChaincodeNotFound, fmt.Errorf("chaincode %q is not served by this API", chaincode))
+	}
+	if chaincode != "" {
+		ctx = context.WithValue(ctx, chaincodeKey{}, chaincode)
+	} else {
+		chaincode = wh.chaincodeName
+	}
+	if label != "" {
+		ctx = context.WithValue(ctx, identityKey{}, label)
+	} else {
+		label = wh.walletUser
+	}
+
+	if channel == "" {
+		channel = wh.channelName
+	}
+
+	contract, err := wh.identities.contractOn(label, channel, chaincode)
+	if err != nil {
+		status, err := refuseIdentity(ctx, label, err)
+		return nil, status, err
+	}
+	return context.WithValue(ctx, contractKey{}, contract), 0, nil
+}
+
+// refuseIdentity logs why label cannot be used and returns the status and
+// error to answer with: 503 when the network could not be reached, and
+// errIdentityRefused for anything else.
+func refuseIdentity(ctx context.Context, label string, err error) (int, error) {
+	slog.WarnContext(ctx, "refused identity", "identity", label, "error", err)
+	if isConnectivityError(err) {
+		return http.StatusServiceUnavailable, withCode(codeGatewayUnavailable, errors.New("the network cannot be reached"))
+	}
+	return http.StatusUnauthorized, errIdentityRefused
+}
+
+// acquireContract returns the contract for the identity withIdentity
+// selected for the request, or a default contract, borrowed from the pool
+// when there is one. The caller must call release once the call using it
+// has returned.
+func (wh *walletHandler) acquireContract(ctx context.Context) (contract ContractInvoker, release func(), err error) {
+	if contract, ok := ctx.Value(contractKey{}).(ContractInvoker); ok {
+		return contract, func() {}, nil
+	}
+	if wh.pool == nil {
+		return wh.contract, func() {}, nil
+	}
+	contract, err = wh.pool.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return contract, func() { wh.pool.release(contract) }, nil
+}
+
+// dropBrokenConnection closes the pooled connection a request's contract
+// came from when err shows the connection broke, so that later requests
+// reconnect instead of failing the same way.
+func (wh *walletHandler) dropBrokenConnection(ctx context.Context, err error) {
+	if err == nil || wh.identities == nil || !isConnectivityError(err) {
+		return
+	}
+	if _, ok := ctx.Value(contractKey{}).(ContractInvoker); ok {
+		wh.identitiesFor(ctx).evict(wh.identityFor(ctx))
+	}
+}
+
+// identityFor returns the wallet identity withIdentity selected for the
+// request, or the identity the API was started with.
+func (wh *walletHandler) identityFor(ctx context.Context) string {
+	if label, ok := ctx.Value(identityKey{}).(string); ok {
+		return label
+	}
+	return wh.walletUser
+}
+
+// chaincodeFor returns the chaincode withIdentity selected for the
+// request, or "" for the default chaincode.
+func chaincodeFor(ctx context.Context) string {
+	chaincode, _ := ctx.Value(chaincodeKey{}).(string)
+	return chaincode
+}
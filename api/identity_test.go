@@ -0,0 +1,384 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// newIdentityHandler is newTestHandler with a wallet holding appUser and
+// user2, and an identity pool whose connections always fail, as they do
+// when the connection profile cannot be read.
+func newIdentityHandler(t *testing.T) *walletHandler {
+	t.Helper()
+	wallet := gateway.NewInMemoryWallet()
+	for _, label := range []string{"appUser", "user2"} {
+		if err := wallet.Put(label, gateway.NewX509Identity("Org1MSP", "cert", "key")); err != nil {
+			t.Fatalf("wallet.Put: %v", err)
+		}
+	}
+	wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})})
+	wh.auth = &apiKeyAuth{keys: [][]byte{[]byte("secret")}, protectReads: true}
+	wh.wallet = wallet
+	cfg := &appConfig{CCPPath: "connection/missing.yaml"}
+	wh.identities = newIdentityPool(cfg, sdkClient{cfg: cfg, wallet: wallet})
+	return wh
+}
+
+// TestIdentityAfterAuth checks that the identity headers are only looked
+// at once a request is authorized, and that an identity that cannot be
+// used gets the same answer whether or not the wallet holds it.
+func TestIdentityAfterAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header []string
+		status int
+		code   string
+	}{
+		{"unknown identity without key", "GET", "/assets", []string{fabricUserHeader, "mallory"}, http.StatusUnauthorized, codeUnauthorized},
+		{"wallet identity without key", "GET", "/assets", []string{fabricUserHeader, "user2"}, http.StatusUnauthorized, codeUnauthorized},
+		{"unknown identity", "GET", "/assets", []string{fabricUserHeader, "mallory", apiKeyHeader, "secret"}, http.StatusUnauthorized, codeUnauthorized},
+		{"identity that cannot connect", "GET", "/assets", []string{fabricUserHeader, "user2", apiKeyHeader, "secret"}, http.StatusUnauthorized, codeUnauthorized},
+		{"channel scoped without key", "GET", "/channels/mychannel/assets", []string{fabricIdentityHeader, "user2"}, http.StatusUnauthorized, codeUnauthorized},
+		{"default identity", "GET", "/assets", []string{apiKeyHeader, "secret"}, http.StatusOK, ""},
+		{"health ignores identity", "GET", "/healthz", []string{fabricUserHeader, "mallory"}, http.StatusOK, ""},
+		{"metrics ignore identity", "GET", "/metrics", []string{fabricUserHeader, "user2"}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := newIdentityHandler(t)
+			rec := serve(newRouter(wh), tt.method, tt.target, "", tt.header...)
+			if tt.code == "" {
+				if rec.Code != tt.status {
+					t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+				}
+			} else {
+				resp := expectError(t, rec, tt.status, tt.code)
+				for _, label := range []string{"mallory", "user2"} {
+					if strings.Contains(resp.Error.Message, label) {
+						t.Errorf("error %q names identity %s", resp.Error.Message, label)
+					}
+				}
+			}
+			if wh.identities.connected("user2") {
+				t.Error("the pool connected user2")
+			}
+		})
+	}
+}
+
+// TestUnknownIdentityMatchesUnusable checks that the response to a label
+// the wallet does not hold cannot be told from one it holds but cannot
+// use.
+func TestUnknownIdentityMatchesUnusable(t *testing.T) {
+	h := newRouter(newIdentityHandler(t))
+	unknown := serve(h, "GET", "/assets", "", fabricUserHeader, "mallory", apiKeyHeader, "secret")
+	held := serve(h, "GET", "/assets", "", fabricUserHeader, "user2", apiKeyHeader, "secret")
+	if unknown.Code != held.Code || unknown.Body.String() != held.Body.String() {
+		t.Errorf("unknown identity got %d %s, held identity %d %s", unknown.Code, unknown.Body, held.Code, held.Body)
+	}
+}
+
+// TestPoolConnectsOncePerLabel checks that concurrent requests for an
+// identity share one connection attempt, that a failed attempt is tried
+// again and that a successful one is kept and reused.
+func TestPoolConnectsOncePerLabel(t *testing.T) {
+	pool := newIdentityPool(&appConfig{}, sdkClient{wallet: gateway.NewInMemoryWallet()})
+	var calls int32
+	pool.connect = func(label string) (fabricGateway, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return nil, errors.New("peer unavailable")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pool.contractOn("user2", "mychannel", "basic"); err == nil {
+				t.Error("contractOn succeeded without a connection")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("connected %d times, want 1", n)
+	}
+
+	// A failed attempt is not remembered.
+	if _, err := pool.contractOn("user2", "mychannel", "basic"); err == nil {
+		t.Error("contractOn succeeded without a connection")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("connected %d times, want 2", n)
+	}
+
+	client := &fakeClient{contract: &fakeContract{}}
+	pool.connect = func(label string) (fabricGateway, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return client.connect(label)
+	}
+	contracts := make([]ContractInvoker, 20)
+	for i := range contracts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			contract, err := pool.contractOn("user2", "mychannel", "basic")
+			if err != nil {
+				t.Errorf("contractOn: %v", err)
+			}
+			contracts[i] = contract
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("connected %d times, want 3", n)
+	}
+	for _, contract := range contracts[1:] {
+		if contract != contracts[0] {
+			t.Fatal("concurrent requests got different contracts")
+		}
+	}
+
+	contract, err := pool.contractOn("user2", "mychannel", "basic")
+	if err != nil {
+		t.Fatalf("contractOn: %v", err)
+	}
+	if contract != contracts[0] {
+		t.Error("a later request got a new contract")
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("connected %d times, want 3", n)
+	}
+	if !pool.connected("user2") {
+		t.Error("the connection of user2 was not kept")
+	}
+}
+
+// TestPoolConnectsLabelsIndependently checks that a slow connection does
+// not hold up requests for other identities, which connect and get their
+// contracts, nor the pool's housekeeping.
+func TestPoolConnectsLabelsIndependently(t *testing.T) {
+	client := &fakeClient{contract: &fakeContract{}}
+	pool := newIdentityPool(&appConfig{}, client)
+	release := make(chan struct{})
+	pool.connect = func(label string) (fabricGateway, error) {
+		if label == "slow" {
+			<-release
+			return nil, errors.New("peer unavailable")
+		}
+		return client.connect(label)
+	}
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		pool.contractOn("slow", "mychannel", "basic")
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				if contract, err := pool.contractOn("fast", "mychannel", "basic"); err != nil || contract == nil {
+					t.Errorf("contractOn(fast) = %v, %v", contract, err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				pool.evict("fast")
+			}()
+			go func() {
+				defer wg.Done()
+				pool.closeIdle(time.Now())
+				pool.connected("slow")
+			}()
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("requests for other identities waited for a slow connection")
+	}
+	close(release)
+	<-slowDone
+
+	first, err := pool.contractOn("fast", "mychannel", "basic")
+	if err != nil {
+		t.Fatalf("contractOn(fast): %v", err)
+	}
+	if again, _ := pool.contractOn("fast", "mychannel", "basic"); again != first {
+		t.Error("the connection of fast was not reused")
+	}
+	if pool.connected("slow") {
+		t.Error("the failed connection of slow was kept")
+	}
+}
+
+// TestPoolStress hammers the pool from many goroutines through the
+// handlers and checks that each identity connects once and shares its
+// connection, and that a connection dropped by dropBrokenConnection is
+// replaced by exactly one new one.
+func TestPoolStress(t *testing.T) {
+	labels := []string{"user1", "user2", "user3"}
+	wallet := gateway.NewInMemoryWallet()
+	for _, label := range labels {
+		if err := wallet.Put(label, gateway.NewX509Identity("Org1MSP", "cert", "key")); err != nil {
+			t.Fatalf("wallet.Put: %v", err)
+		}
+	}
+	stocked := ledger(map[string]string{"asset1": asset1})
+	var broken atomic.Bool
+	client := &fakeClient{contract: &fakeContract{evaluate: func(name string, args ...string) ([]byte, error) {
+		if broken.Load() {
+			return nil, errPeerUnreachable
+		}
+		return stocked(name, args...)
+	}}}
+	wh := newTestHandler(&fakeContract{evaluate: stocked})
+	wh.wallet = wallet
+	wh.identities = newIdentityPool(&appConfig{ChannelName: "mychannel", ChaincodeName: "basic"}, client)
+	h := newRouter(wh)
+
+	hammer := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			for _, label := range labels {
+				wg.Add(1)
+				go func(label string) {
+					defer wg.Done()
+					if rec := serve(h, "GET", "/assets/asset1", "", fabricUserHeader, label); rec.Code != http.StatusOK {
+						t.Errorf("as %s: status = %d, want %d: %s", label, rec.Code, http.StatusOK, rec.Body)
+					}
+				}(label)
+			}
+		}
+		wg.Wait()
+	}
+	connections := func() (map[string]int, int) {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		connects := make(map[string]int, len(client.connects))
+		for label, n := range client.connects {
+			connects[label] = n
+		}
+		return connects, client.closes
+	}
+
+	hammer()
+	connects, closes := connections()
+	for _, label := range labels {
+		if connects[label] != 1 {
+			t.Errorf("%s connected %d times, want 1", label, connects[label])
+		}
+	}
+	if closes != 0 {
+		t.Errorf("closed %d connections, want 0", closes)
+	}
+
+	broken.Store(true)
+	if rec := serve(h, "GET", "/assets/asset1", "", fabricUserHeader, "user1"); rec.Code == http.StatusOK {
+		t.Fatal("a request over a broken connection succeeded")
+	}
+	broken.Store(false)
+	if wh.identities.connected("user1") {
+		t.Error("the broken connection of user1 was kept")
+	}
+	if _, closes := connections(); closes != 1 {
+		t.Errorf("closed %d connections, want the broken one", closes)
+	}
+
+	hammer()
+	connects, _ = connections()
+	want := map[string]int{"user1": 2, "user2": 1, "user3": 1}
+	for label, n := range want {
+		if connects[label] != n {
+			t.Errorf("%s connected %d times, want %d", label, connects[label], n)
+		}
+	}
+}
+
+// TestPoolRetiresConnectionsInFlight checks that evicting an identity
+// does not close its connection under a call in flight, that a request
+// still holding its contract carries on over a new connection, and that
+// the old one is closed once the call finishes.
+func TestPoolRetiresConnectionsInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	client := &fakeClient{contract: &fakeContract{evaluate: func(string, ...string) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+		}
+		return []byte("ok"), nil
+	}}}
+	closes := func() int {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.closes
+	}
+	pool := newIdentityPool(&appConfig{}, client)
+
+	held, err := pool.contractOn("user2", "mychannel", "basic")
+	if err != nil {
+		t.Fatalf("contractOn: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := held.EvaluateTransaction("ReadAsset", "asset1")
+		done <- err
+	}()
+	<-started
+
+	pool.evict("user2")
+	if n := closes(); n != 0 {
+		t.Fatalf("closed %d connections with a call in flight, want 0", n)
+	}
+	if _, err := held.EvaluateTransaction("ReadAsset", "asset1"); err != nil {
+		t.Errorf("a call after the eviction: %v", err)
+	}
+	client.mu.Lock()
+	connects := client.connects["user2"]
+	client.mu.Unlock()
+	if connects != 2 {
+		t.Errorf("connected %d times, want 2", connects)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("the call in flight failed: %v", err)
+	}
+	if n := closes(); n != 1 {
+		t.Errorf("closed %d connections once the call finished, want 1", n)
+	}
+
+	pool.close()
+	if n := closes(); n != 2 {
+		t.Errorf("closed %d connections after close, want 2", n)
+	}
+	if _, err := held.EvaluateTransaction("ReadAsset", "asset1"); err == nil {
+		t.Error("a call after the pool was closed succeeded")
+	}
+}
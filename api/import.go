@@ -0,0 +1,244 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// maxImportRows caps the number of assets in one /assets/import file.
+const maxImportRows = 1000
+
+// ImportRowError reports why one row of an import was not created. Row is
+// the 1-based position of the asset in the file, not counting a CSV
+// header.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	AssetID string `json:"asset_id,omitempty"`
+	Error   string `json:"error"`
+}
+
+// ImportSummary is the response to POST /assets/import.
+type ImportSummary struct {
+	Total   int              `json:"total"`
+	Created int              `json:"created"`
+	Skipped int              `json:"skipped"`
+	Failed  int              `json:"failed"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+// ImportAssets serves POST /assets/import, which creates the assets in a
+// CSV or JSON file uploaded as the "file" field of a multipart form. Every
+// row is validated, and checked against the ledger, before anything is
+// submitted. Assets that already exist fail the whole import unless
+// ?onConflict=skip is given, in which case they are left alone. The
+// import's deadline grows with its rows, and each asset it creates counts
+// as a write against the rate limit, the import waiting for the client's
+// limit to allow the next one when it runs out.
+func (wh *walletHandler) ImportAssets(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	onConflict := req.URL.Query().Get("onConflict")
+	if onConflict == "" {
+		onConflict = "fail"
+	}
+	if onConflict != "fail" && onConflict != "skip" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf(`onConflict must be "skip" or "fail"`))
+		return
+	}
+
+	file, header, err := req.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, bodyTooLargeError(tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected a multipart form with a file field: %w", err))
+		return
+	}
+	defer file.Close()
+
+	assets, err := readImportFile(file, header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(assets) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("the file contains no assets"))
+		return
+	}
+	if len(assets) > maxImportRows {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("at most %d assets can be imported per file, got %d", maxImportRows, len(assets)))
+		return
+	}
+
+	ctx, cancel := wh.batchContext(req, len(assets))
+	defer cancel()
+
+	summary := ImportSummary{Total: len(assets), Errors: []ImportRowError{}}
+	seen := make(map[string]int)
+	for i, asset := range assets {
+		if first, ok := seen[asset.AssetID]; ok {
+			summary.Errors = append(summary.Errors, ImportRowError{Row: i + 1, AssetID: asset.AssetID, Error: fmt.Sprintf("duplicates row %d", first)})
+			continue
+		}
+		if asset.AssetID != "" {
+			seen[asset.AssetID] = i + 1
+		}
+		if errs := asset.fieldErrors(); len(errs) > 0 {
+			var msgs []string
+			for _, e := range errs {
+				msgs = append(msgs, e.String())
+			}
+			summary.Errors = append(summary.Errors, ImportRowError{Row: i + 1, AssetID: asset.AssetID, Error: strings.Join(msgs, ", ")})
+		}
+	}
+	if len(summary.Errors) > 0 {
+		rejectImport(w, http.StatusBadRequest, codeValidationFailed, "the file has invalid rows, nothing was imported", summary)
+		return
+	}
+
+	existing := make(map[int]bool)
+	for i, asset := range assets {
+		exists, err := wh.assetExists(ctx, asset.AssetID)
+		if err != nil {
+			writeAssetCheckError(w, asset.AssetID, err)
+			return
+		}
+		if !exists {
+			continue
+		}
+		existing[i] = true
+		if onConflict == "fail" {
+			summary.Errors = append(summary.Errors, ImportRowError{Row: i + 1, AssetID: asset.AssetID, Error: "already exists"})
+		}
+	}
+	if len(summary.Errors) > 0 {
+		rejectImport(w, http.StatusConflict, codeAssetExists, "some assets already exist, nothing was imported", summary)
+		return
+	}
+
+	pacer := wh.limiter.pacer(req)
+	for i, asset := range assets {
+		if existing[i] {
+			summary.Skipped++
+			continue
+		}
+		if err := pacer.wait(ctx); err != nil {
+			summary.Failed++
+			summary.Errors = append(summary.Errors, ImportRowError{Row: i + 1, AssetID: asset.AssetID, Error: fmt.Sprintf("not submitted: %v", err)})
+			continue
+		}
+		if _, err := wh.createOne(ctx, asset); err != nil {
+			summary.Failed++
+			summary.Errors = append(summary.Errors, ImportRowError{Row: i + 1, AssetID: asset.AssetID, Error: err.Error()})
+			continue
+		}
+		summary.Created++
+	}
+
+	status := http.StatusOK
+	if summary.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	writeData(w, status, summary)
+}
+
+// rejectImport answers an import that was refused before anything was
+// submitted, with the summary listing the rows at fault.
+func rejectImport(w http.ResponseWriter, status int, code, message string, summary ImportSummary) {
+	summary.Failed = len(summary.Errors)
+	raw, _ := json.Marshal(summary)
+	writeResponse(w, status, APIResponse{
+		Success: false,
+		Data:    raw,
+		Error: &APIError{
+			Code:      code,
+			Message:   message,
+			RequestID: w.Header().Get(requestIDHeader),
+		},
+	})
+}
+
+// readImportFile parses an uploaded file as JSON when its name or content
+// type says so, or when it starts with '[', and as CSV otherwise.
+func readImportFile(file multipart.File, header *multipart.FileHeader) ([]Asset, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the uploaded file: %w", err)
+	}
+
+	isJSON := strings.EqualFold(filepath.Ext(header.Filename), ".json") ||
+		strings.HasPrefix(header.Header.Get("Content-Type"), "application/json") ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+	if isJSON {
+		var assets []Asset
+		if err := json.Unmarshal(data, &assets); err != nil {
+			return nil, fmt.Errorf("the file is not a valid JSON array of assets: %w", err)
+		}
+		return assets, nil
+	}
+	return parseAssetCSV(data)
+}
+
+// parseAssetCSV reads assets from CSV with a header row naming the columns,
+// which are those of GET /assets/export and may come in any order. Cells
+// the export quoted against formula injection are read back unquoted.
+func parseAssetCSV(data []byte) ([]Asset, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the file is not valid CSV: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvHeader {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the CSV header has no %s column", name)
+		}
+	}
+
+	var assets []Asset
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return assets, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the file is not valid CSV: %w", err)
+		}
+		assets = append(assets, Asset{
+			AssetID:        csvValue(record[columns["asset_id"]]),
+			Colour:         csvValue(record[columns["colour"]]),
+			Size:           csvValue(record[columns["size"]]),
+			Owner:          csvValue(record[columns["owner"]]),
+			AppraisedValue: csvValue(record[columns["appraised_value"]]),
+		})
+		if len(assets) > maxImportRows {
+			return assets, nil
+		}
+	}
+}
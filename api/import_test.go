@@ -0,0 +1,178 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importCSV returns a CSV file with a row for each of ids.
+func importCSV(ids ...string) string {
+	rows := []string{"asset_id,colour,size,owner,appraised_value"}
+	for _, id := range ids {
+		rows = append(rows, id+",blue,5,Tomoko,300")
+	}
+	return strings.Join(rows, "\n") + "\n"
+}
+
+// serveImport uploads file to target as a multipart form.
+func serveImport(t *testing.T, h http.Handler, target, file string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "assets.csv")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write([]byte(file))
+	form.Close()
+
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// importSummary checks the status and error code of an import response,
+// which carries its summary even when it fails, and decodes the summary.
+func importSummary(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) ImportSummary {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	resp := decodeResponse(t, rec)
+	if code != "" && (resp.Error == nil || resp.Error.Code != code) {
+		t.Fatalf("want error code %q, got %s", code, rec.Body)
+	}
+	var summary ImportSummary
+	if err := json.Unmarshal(resp.Data, &summary); err != nil {
+		t.Fatalf("decoding the summary: %v", err)
+	}
+	return summary
+}
+
+func TestImportRejectsDuplicateIDs(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{})}
+	rec := serveImport(t, newRouter(newTestHandler(contract)), "/assets/import", importCSV("a1", "a2", "a1"))
+
+	summary := importSummary(t, rec, http.StatusBadRequest, codeValidationFailed)
+	want := []ImportRowError{{Row: 3, AssetID: "a1", Error: "duplicates row 1"}}
+	if fmt.Sprint(summary.Errors) != fmt.Sprint(want) {
+		t.Errorf("errors = %+v, want %+v", summary.Errors, want)
+	}
+	if n := contract.count("CreateAsset"); n != 0 {
+		t.Errorf("CreateAsset submitted %d times, want 0", n)
+	}
+}
+
+// TestImportDeadline checks that an import of slow submissions is cut off
+// at its deadline, which allows BATCH_ASSET_TIMEOUT for each row on top of
+// the request timeout.
+func TestImportDeadline(t *testing.T) {
+	rows := importCSV("a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8")
+
+	t.Run("request timeout only", func(t *testing.T) {
+		contract := &fakeContract{evaluate: ledger(map[string]string{}), submit: sleeping(40*time.Millisecond, nil)}
+		wh := newTestHandler(contract)
+		wh.timeout = 100 * time.Millisecond
+
+		start := time.Now()
+		rec := serveImport(t, newRouter(wh), "/assets/import", rows)
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("the import took %s with a 100ms deadline", elapsed)
+		}
+		summary := importSummary(t, rec, http.StatusMultiStatus, "")
+		if summary.Created == 0 || summary.Failed == 0 || summary.Created+summary.Failed != 8 {
+			t.Errorf("summary = %+v, want some rows created and the rest failed", summary)
+		}
+	})
+
+	t.Run("time per row", func(t *testing.T) {
+		contract := &fakeContract{evaluate: ledger(map[string]string{}), submit: sleeping(40*time.Millisecond, nil)}
+		wh := newTestHandler(contract)
+		wh.timeout = 100 * time.Millisecond
+		wh.batchAssetTimeout = 100 * time.Millisecond
+
+		rec := serveImport(t, newRouter(wh), "/assets/import", rows)
+		if summary := importSummary(t, rec, http.StatusOK, ""); summary.Created != 8 {
+			t.Errorf("summary = %+v, want all 8 rows created", summary)
+		}
+	})
+}
+
+// TestImportCountsEachAsset checks that every asset an import creates
+// counts against the client's write limit, and existing ones do not.
+func TestImportCountsEachAsset(t *testing.T) {
+	wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})})
+	wh.limiter = &rateLimiter{writes: newBucketLimiter(0.001, 5)}
+	h := wh.limiter.limit(newRouter(wh))
+
+	// asset1 is skipped, so this costs 1 token for the request and 2 more
+	// for its other new assets, which leaves 2 of 5.
+	rec := serveImport(t, h, "/assets/import?onConflict=skip", importCSV("asset1", "a1", "a2", "a3"))
+	if summary := importSummary(t, rec, http.StatusOK, ""); summary.Created != 3 || summary.Skipped != 1 {
+		t.Errorf("summary = %+v, want 3 created and 1 skipped", summary)
+	}
+	for _, id := range []string{"b1", "b2"} {
+		if rec := serveImport(t, h, "/assets/import", importCSV(id)); rec.Code != http.StatusOK {
+			t.Fatalf("importing %s: status = %d, want %d: %s", id, rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+	expectError(t, serveImport(t, h, "/assets/import", importCSV("b3")), http.StatusTooManyRequests, codeRateLimited)
+}
+
+// withDefaultLimits configures wh with the default request timeouts and
+// rate limits, and returns its router behind the rate limiter.
+func withDefaultLimits(t *testing.T, wh *walletHandler) http.Handler {
+	t.Helper()
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if wh.limiter, err = newRateLimiter(cfg); err != nil {
+		t.Fatalf("newRateLimiter: %v", err)
+	}
+	wh.timeout = cfg.RequestTimeout
+	wh.batchAssetTimeout = cfg.BatchAssetTimeout
+	return wh.limiter.limit(newRouter(wh))
+}
+
+// TestImportOverWriteBurst checks that, with the default configuration, an
+// import of more rows than the write burst is paced to the write rate
+// instead of being refused, and leaves the client's limit spent.
+func TestImportOverWriteBurst(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{})}
+	h := withDefaultLimits(t, newTestHandler(contract))
+
+	var ids []string
+	for i := 1; i <= 25; i++ {
+		ids = append(ids, fmt.Sprintf("a%d", i))
+	}
+	start := time.Now()
+	rec := serveImport(t, h, "/assets/import", importCSV(ids...))
+	if summary := importSummary(t, rec, http.StatusOK, ""); summary.Created != 25 {
+		t.Errorf("summary = %+v, want all 25 rows created", summary)
+	}
+	// The request and 19 of its assets fit the burst of 20; the last 5
+	// wait for the bucket to refill at 10 a second.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("the import took %s, want it paced to the write rate", elapsed)
+	}
+	if n := contract.count("CreateAsset"); n != 25 {
+		t.Errorf("CreateAsset submitted %d times, want 25", n)
+	}
+	expectError(t, serveImport(t, h, "/assets/import", importCSV("b1")), http.StatusTooManyRequests, codeRateLimited)
+}
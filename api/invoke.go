@@ -0,0 +1,82 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// InvokeRequest is the body of POST /invoke. Type is "submit" to record a
+// transaction on the ledger or "evaluate" to only query it.
+type InvokeRequest struct {
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+	Type     string   `json:"type"`
+}
+
+func (r InvokeRequest) fieldErrors() []FieldError {
+	errs := requireField(nil, "function", r.Function)
+	if r.Type != "submit" && r.Type != "evaluate" {
+		errs = append(errs, FieldError{Field: "type", Message: `must be "submit" or "evaluate"`})
+	}
+	return errs
+}
+
+// parseFunctionList turns a comma-separated list of chaincode function
+// names into a set.
+func parseFunctionList(list string) map[string]bool {
+	functions := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			functions[name] = true
+		}
+	}
+	return functions
+}
+
+// Invoke serves POST /invoke, which calls any chaincode function listed in
+// INVOKE_ALLOWED_FUNCTIONS. With the list empty every call is refused.
+func (wh *walletHandler) Invoke(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+
+	var invoke InvokeRequest
+	if !readJSON(w, req, &invoke) {
+		return
+	}
+	if !validate(w, invoke) {
+		return
+	}
+	if !wh.invokeAllowed[invoke.Function] {
+		writeError(w, http.StatusForbidden, withCode(codeForbidden, fmt.Errorf("function %s may not be invoked through /invoke", invoke.Function)))
+		return
+	}
+
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	if invoke.Type == "evaluate" {
+		result, err := wh.evaluate(ctx, invoke.Function, invoke.Args...)
+		if err != nil {
+			writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+			return
+		}
+		writeData(w, http.StatusOK, chaincodeData(result))
+		return
+	}
+
+	result, txID, err := wh.submitTx(ctx, invoke.Function, invoke.Args...)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+	writeTxResult(w, http.StatusOK, txID, chaincodeData(result))
+}
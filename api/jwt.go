@@ -0,0 +1,262 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles understood by the API. Admins may call every route; readers only
+// the read routes.
+const (
+	roleAdmin  = "asset-admin"
+	roleReader = "asset-reader"
+)
+
+// jwksRefreshInterval limits how often an unknown key id makes the
+// verifier fetch the key set again.
+const jwksRefreshInterval = time.Minute
+
+// jwtClaims are the parts of a verified token the API uses.
+type jwtClaims struct {
+	Subject string
+	Roles   []string
+}
+
+func (c *jwtClaims) hasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// jwtVerifier checks bearer tokens signed either with a shared HS256 secret
+// or with an RS256 key published at a JWKS URL, such as Keycloak's
+// /protocol/openid-connect/certs endpoint.
+type jwtVerifier struct {
+	secret     []byte
+	jwksURL    string
+	issuer     string
+	rolesClaim []string
+	client     *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// newJWTVerifier returns nil when neither a secret nor a JWKS URL is
+// configured. rolesClaim is a dotted path into the claims, so Keycloak's
+// realm roles are found with "realm_access.roles".
+func newJWTVerifier(cfg *appConfig) *jwtVerifier {
+	if cfg.JWTSecret == "" && cfg.JWTJWKSURL == "" {
+		return nil
+	}
+	return &jwtVerifier{
+		secret:     []byte(cfg.JWTSecret),
+		jwksURL:    cfg.JWTJWKSURL,
+		issuer:     cfg.JWTIssuer,
+		rolesClaim: strings.Split(cfg.JWTRolesClaim, "."),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// verify checks the token's signature and validity period and returns its
+// claims.
+func (v *jwtVerifier) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if err := v.checkSignature(header.Alg, header.Kid, signed, signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, errors.New("token was issued by an untrusted issuer")
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &jwtClaims{Subject: subject, Roles: v.roles(claims)}, nil
+}
+
+func (v *jwtVerifier) checkSignature(alg, kid string, signed, signature []byte) error {
+	switch alg {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "RS256":
+		if v.jwksURL == "" {
+			return errors.New("RS256 tokens are not accepted")
+		}
+		key, err := v.publicKey(kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported token algorithm %q", alg)
+}
+
+// publicKey returns the JWKS key with the given id, fetching the key set
+// when the id is unknown so that key rotation is picked up.
+func (v *jwtVerifier) publicKey(kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(v.fetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := v.fetchKeys()
+	v.fetchedAt = time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	v.keys = keys
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (v *jwtVerifier) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	resp, err := v.client.Get(v.jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// roles follows rolesClaim through the claims. The roles may be a JSON
+// array or a space-separated string.
+func (v *jwtVerifier) roles(claims map[string]interface{}) []string {
+	var value interface{} = claims
+	for _, name := range v.rolesClaim {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch roles := value.(type) {
+	case string:
+		return strings.Fields(roles)
+	case []interface{}:
+		var out []string
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ledgerAsset is an asset as stored by the asset-transfer chaincode. The
+// field names differ between the chaincode flavours ("Color" vs "color"),
+// which encoding/json tolerates because it matches keys case-insensitively.
+// The ledger-queries chaincode names the id "assetID" instead of "ID".
+type ledgerAsset struct {
+	ID             string      `json:"ID"`
+	AssetID        string      `json:"assetID"`
+	Color          ledgerValue `json:"Color"`
+	Size           ledgerValue `json:"Size"`
+	Owner          string      `json:"Owner"`
+	AppraisedValue ledgerValue `json:"AppraisedValue"`
+}
+
+// ledgerRecord covers both shapes the chaincode uses for query results: a
+// {"Key": ..., "Record": {...}} wrapper or the bare asset.
+type ledgerRecord struct {
+	Key    string       `json:"Key"`
+	Record *ledgerAsset `json:"Record"`
+	ledgerAsset
+}
+
+// ledgerValue accepts a JSON string or number. The Go chaincode stores size
+// and appraised value as integers while the JavaScript one keeps whatever
+// string it was given.
+type ledgerValue string
+
+func (v *ledgerValue) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*v = ledgerValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expected string or number, got %s", data)
+	}
+	*v = ledgerValue(n)
+	return nil
+}
+
+func (a ledgerAsset) toAsset() Asset {
+	return Asset{
+		AssetID:        a.ID,
+		Owner:          a.Owner,
+		Colour:         string(a.Color),
+		Size:           string(a.Size),
+		AppraisedValue: string(a.AppraisedValue),
+	}
+}
+
+// parseLedgerAssets converts a chaincode query result into API assets. An
+// empty or null result yields an empty, non-nil slice.
+func parseLedgerAssets(data []byte) ([]Asset, error) {
+	assets := []Asset{}
+	err := eachLedgerAsset(data, func(asset Asset) error {
+		assets = append(assets, asset)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+// eachLedgerAsset decodes a chaincode query result one record at a time,
+// calling fn with each asset, so that large results need not be held as a
+// slice. It stops at the first error, from decoding or from fn.
+func eachLedgerAsset(data []byte, fn func(Asset) error) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("expected a JSON array, got %v", tok)
+	}
+	for dec.More() {
+		var record ledgerRecord
+		if err := dec.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(record.asset()); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// asset returns the API form of whichever shape record came in.
+func (record ledgerRecord) asset() Asset {
+	asset := record.ledgerAsset
+	if record.Record != nil {
+		asset = *record.Record
+	}
+	if asset.ID == "" {
+		asset.ID = asset.AssetID
+	}
+	if asset.ID == "" {
+		asset.ID = record.Key
+	}
+	return asset.toAsset()
+}
+
+// ledgerHistoryEntry is one element of the chaincode's GetAssetHistory
+// result. Record is null (or absent) for entries that delete the asset.
+type ledgerHistoryEntry struct {
+	Record    *ledgerAsset    `json:"record"`
+	TxID      string          `json:"txId"`
+	Timestamp ledgerTimestamp `json:"timestamp"`
+	IsDelete  bool            `json:"isDelete"`
+}
+
+// ledgerTimestamp accepts an RFC 3339 string, as produced by the Go
+// chaincode, or a protobuf-style {"seconds": ..., "nanos": ...} object.
+type ledgerTimestamp struct {
+	time.Time
+}
+
+func (t *ledgerTimestamp) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &t.Time)
+	}
+	var ts struct {
+		Seconds int64 `json:"seconds"`
+		Nanos   int64 `json:"nanos"`
+	}
+	if err := json.Unmarshal(data, &ts); err != nil {
+		return fmt.Errorf("unsupported timestamp %s", data)
+	}
+	t.Time = time.Unix(ts.Seconds, ts.Nanos).UTC()
+	return nil
+}
+
+// parseAssetHistory converts a GetAssetHistory result into API history
+// entries, oldest first as returned by the chaincode.
+func parseAssetHistory(data []byte) ([]AssetHistoryEntry, error) {
+	history := []AssetHistoryEntry{}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return history, nil
+	}
+
+	var entries []ledgerHistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		item := AssetHistoryEntry{
+			TxID:      entry.TxID,
+			Timestamp: entry.Timestamp.Time,
+			IsDelete:  entry.IsDelete,
+		}
+		if entry.Record != nil && !entry.IsDelete {
+			asset := entry.Record.toAsset()
+			item.Value = &asset
+		}
+		history = append(history, item)
+	}
+	return history, nil
+}
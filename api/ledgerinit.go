@@ -0,0 +1,84 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+const codeLedgerInitialized = "LEDGER_ALREADY_INITIALIZED"
+
+// InitLedger serves POST /admin/init-ledger, which seeds the ledger with
+// the chaincode's sample assets. It is refused with 409 when the ledger
+// already has assets, unless ?force=true is given, in which case InitLedger
+// runs again and the chaincode overwrites the sample assets. The response
+// is a TxResult whose result lists the assets InitLedger created or
+// changed.
+func (wh *walletHandler) InitLedger(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	// Two calls at once would both find the ledger empty.
+	wh.ledgerInit.Lock()
+	defer wh.ledgerInit.Unlock()
+
+	before, status, err := wh.ledgerAssets(ctx)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	if len(before) > 0 && req.URL.Query().Get("force") != "true" {
+		writeError(w, http.StatusConflict, withCode(codeLedgerInitialized, fmt.Errorf("the ledger already has %d assets; pass ?force=true to run InitLedger again", len(before))))
+		return
+	}
+
+	_, txID, err := wh.submitTx(ctx, "InitLedger")
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+
+	after, status, err := wh.ledgerAssets(ctx)
+	if err != nil {
+		writeError(w, status, fmt.Errorf("transaction %s was committed but the assets could not be read: %w", txID, err))
+		return
+	}
+	previous := make(map[string]Asset, len(before))
+	for _, asset := range before {
+		previous[asset.AssetID] = asset
+	}
+	created := []Asset{}
+	for _, asset := range after {
+		if old, ok := previous[asset.AssetID]; !ok || old != asset {
+			wh.forgetAsset(ctx, asset.AssetID)
+			created = append(created, asset)
+		}
+	}
+	slog.InfoContext(ctx, "Initialized the ledger", "tx_id", txID, "assets", len(created))
+	writeTxResult(w, http.StatusOK, txID, created)
+}
+
+// ledgerAssets evaluates GetAllAssets and returns the status to respond
+// with when it fails.
+func (wh *walletHandler) ledgerAssets(ctx context.Context) ([]Asset, int, error) {
+	result, err := wh.evaluate(ctx, "GetAllAssets")
+	if err != nil {
+		return nil, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err)
+	}
+	assets, err := parseLedgerAssets(result)
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("unexpected GetAllAssets response: %w", err)
+	}
+	return assets, 0, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// logLevel is the minimum level logged; main sets it from LOG_LEVEL.
+var logLevel = new(slog.LevelVar)
+
+// Log formats selected with LOG_FORMAT.
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// newLogger returns a logger writing JSON, or key=value lines for people
+// to read when format is logFormatText. It adds the request id and the
+// authenticated subject found in the context to every record logged with
+// one of the *Context functions.
+func newLogger(w io.Writer, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if format == logFormatText {
+		return slog.New(contextHandler{slog.NewTextHandler(w, opts)})
+	}
+	return slog.New(contextHandler{slog.NewJSONHandler(w, opts)})
+}
+
+// contextHandler decorates records with request-scoped attributes.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if subject := subjectFrom(ctx); subject != "" {
+		r.AddAttrs(slog.String("subject", subject))
+	}
+	if cn := clientCNFrom(ctx); cn != "" {
+		r.AddAttrs(slog.String("client_cn", cn))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -7,17 +7,43 @@ SPDX-License-Identifier: Apache-2.0
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"os"
+	"os/signal"
 	"encoding/json"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"net"
 	"net/http"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"net/url"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
 	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// APIResponse is the envelope every endpoint responds with. Data holds the
+// result of a successful call and Error describes why a call failed.
+type APIResponse struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   *APIError       `json:"error,omitempty"`
+	// Errors lists the invalid fields when a request body fails validation.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
 type Asset struct {
 	AssetID string `json:"asset_id"`
 	Owner string `json:"owner"`
@@ -29,232 +55,1286 @@ type Asset struct {
 type PostTransaction struct {
 	AssetID string `json:"asset_id"`
 	Owner string `json:"owner"`
+	// Transient is passed to the chaincode as transient data and
+	// EndorsingPeers, when set, replaces discovery's choice of peers.
+	Transient map[string]string `json:"transient,omitempty"`
+	EndorsingPeers []string `json:"endorsingPeers,omitempty"`
 }
 
 type PostAsset struct {
 	Id string	`json:"id"`
 }
 
+// AssetHistoryEntry is one past state of an asset. Value is null for the
+// entry that deleted the asset.
+type AssetHistoryEntry struct {
+	TxID      string    `json:"txId"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Value     *Asset    `json:"value"`
+}
+
+// TxResult is the response to a request that submitted a transaction. TxID
+// identifies the transaction on the ledger and Result is the outcome.
+type TxResult struct {
+	TxID   string      `json:"txId,omitempty"`
+	Result interface{} `json:"result"`
+}
+
+type DeleteResult struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+// ExistsResult is the data of an /asset/exists response.
+type ExistsResult struct {
+	ID     string `json:"id"`
+	Exists bool   `json:"exists"`
+}
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 500
+)
+
+// AssetPage is one page of GET /assets. Pass Bookmark back to fetch the
+// next page; it is empty once the last page has been returned.
+type AssetPage struct {
+	Assets   []json.RawMessage `json:"assets"`
+	Bookmark string            `json:"bookmark"`
+}
+
+// ContractInvoker is the part of *gateway.Contract the handlers use, so they
+// can be driven by a fake contract instead of a live Fabric network.
+type ContractInvoker interface {
+	SubmitTransaction(name string, args ...string) ([]byte, error)
+	EvaluateTransaction(name string, args ...string) ([]byte, error)
+}
+
+var _ ContractInvoker = (*gateway.Contract)(nil)
+
 type walletHandler struct {
-	wallet *gateway.Wallet
-	contract *gateway.Contract
+	wallet identityWallet
+	network *gateway.Network
+	contract ContractInvoker
+	// pool lends out contracts of the default identity when
+	// CONTRACT_POOL_SIZE is above one; nil means contract is shared.
+	pool *contractPool
+	// probeChaincode makes /health evaluate a transaction on the peers
+	// instead of only checking that the gateway objects were created.
+	probeChaincode bool
+	// timeout bounds every transaction a request makes on the network,
+	// and callTimeout each Fabric call among them; zero leaves calls
+	// bounded by timeout alone.
+	timeout     time.Duration
+	callTimeout time.Duration
+	// batchAssetTimeout extends the deadline of a batch request for each
+	// asset it writes.
+	batchAssetTimeout time.Duration
+	auth *apiKeyAuth
+	// walletUser is the identity of contract; identities holds connections
+	// for the other wallet identities requests may select.
+	walletUser string
+	identities *identityPool
+	// orgs are the further organizations requests may select with
+	// X-Fabric-Org.
+	orgs orgRegistry
+	// channelName is the default channel and channels every channel
+	// requests may select with /channels/{channel}.
+	channelName string
+	channels map[string]bool
+	// chaincodeName is the default chaincode and chaincodes every
+	// chaincode requests may select with X-Chaincode.
+	chaincodeName string
+	chaincodes map[string]bool
+	// orgPeers are the client organization's peers, which endorse
+	// private data transactions; empty when the profile does not say.
+	orgPeers []string
+	// knownPeers are the connection profile's peers, by name and by
+	// address, which requests may ask to endorse with.
+	knownPeers map[string]bool
+	// clientIdentities maps client certificate CNs to wallet labels when
+	// mutual TLS is on.
+	clientIdentities clientIdentityMap
+	// ca enrolls new users for /enroll; nil when the connection profile
+	// has no usable CA.
+	ca *caEnroller
+	// events fans chaincode events out to /events clients; nil when the
+	// listeners could not be registered.
+	events *eventHub
+	readiness readinessCheck
+	// blocks follows block events for /ledger/status.
+	blocks *blockTracker
+	// invokeAllowed is the set of chaincode functions /invoke may call.
+	invokeAllowed map[string]bool
+	// validator checks requests against the OpenAPI document once their
+	// route has authorized them; nil skips the check.
+	validator *requestValidator
+	// existsCache saves the AssetExists evaluation in front of repeated
+	// mutations of the same asset.
+	existsCache *existsCache
+	// assetCache saves the ReadAsset evaluation of single-asset reads.
+	assetCache *assetCache
+	// idempotency keeps the responses to creates sent with an
+	// Idempotency-Key.
+	idempotency *idempotencyStore
+	// offline keeps the transactions prepared for clients that sign them
+	// themselves; nil when offline signing is disabled.
+	offline *offlineSigning
+	// ledgerInit serializes /admin/init-ledger calls.
+	ledgerInit sync.Mutex
+	// async runs submissions requested with ?async=true.
+	async *submissionQueue
+	// limiter is the rate limiter requests pass; batch requests are
+	// charged one more write for every asset after the first.
+	limiter *rateLimiter
+	retry retryPolicy
+
+	// activeRequests counts requests currently being served and
+	// submissions tracks submitted transactions, including those whose
+	// request has already timed out, so shutdown can wait for both.
+	activeRequests int64
+	submissions    sync.WaitGroup
 }
 
-func (wh *walletHandler) CreateAsset(w http.ResponseWriter, req *http.Request) {
-	setupCORS(&w, req)
-    if (*req).Method == "OPTIONS" {
-        return
-    }
+// serveHTTP serves srv on listener, over HTTPS when srv has a TLS
+// configuration.
+func serveHTTP(srv *http.Server, listener net.Listener) error {
+	if srv.TLSConfig != nil {
+		log.Printf("Listening on %s (HTTPS)", listener.Addr())
+		return srv.ServeTLS(listener, "", "")
+	}
+	log.Printf("Listening on %s", listener.Addr())
+	return srv.Serve(listener)
+}
 
-	if req.Method == "POST" {
+// trackRequests wraps next so that activeRequests reflects the number of
+// requests in progress.
+func (wh *walletHandler) trackRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&wh.activeRequests, 1)
+		defer atomic.AddInt64(&wh.activeRequests, -1)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// waitForSubmissions blocks until every submitted transaction has returned
+// from the SDK or ctx is done.
+func (wh *walletHandler) waitForSubmissions(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wh.submissions.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestContext derives the context a handler uses for its transactions:
+// it is cancelled when the client goes away or after wh.timeout.
+func (wh *walletHandler) requestContext(req *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(req.Context(), wh.timeout)
+}
+
+// batchContext is requestContext for a request that writes n assets one
+// after another. Its deadline allows wh.batchAssetTimeout for each asset
+// on top of wh.timeout, plus however long the write rate limit can make
+// the batch wait.
+func (wh *walletHandler) batchContext(req *http.Request, n int) (context.Context, context.CancelFunc) {
+	timeout := wh.timeout + time.Duration(n)*wh.batchAssetTimeout + wh.limiter.batchDuration(n)
+	return context.WithTimeout(req.Context(), timeout)
+}
+
+// callContext derives the context of a single Fabric call from ctx, the
+// request's context, cutting it short after wh.callTimeout.
+func (wh *walletHandler) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if wh.callTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, wh.callTimeout)
+}
+
+// submitTx submits a transaction, retrying it according to wh.retry and
+// giving up when ctx is done. It also returns the Fabric transaction id
+// when the contract can report it; a failed transaction that was given an
+// id carries it in a txError.
+func (wh *walletHandler) submitTx(ctx context.Context, name string, args ...string) ([]byte, string, error) {
+	return wh.submitTxWith(ctx, name, txOptions{}, args...)
+}
+
+// txOptions are the options a transaction is created with. They stay in
+// this form until submitWithTxID turns them into gateway options, so that
+// contracts other than the gateway's can see them.
+type txOptions struct {
+	// transient is passed to the chaincode but not recorded on the ledger.
+	transient map[string][]byte
+	// endorsingPeers replace the peers discovery would pick.
+	endorsingPeers []string
+}
+
+func (o txOptions) empty() bool {
+	return len(o.transient) == 0 && len(o.endorsingPeers) == 0
+}
+
+func (o txOptions) gatewayOptions() []gateway.TransactionOption {
+	var opts []gateway.TransactionOption
+	if len(o.transient) > 0 {
+		opts = append(opts, gateway.WithTransient(o.transient))
+	}
+	if len(o.endorsingPeers) > 0 {
+		opts = append(opts, gateway.WithEndorsingPeers(o.endorsingPeers...))
+	}
+	return opts
+}
+
+// submitTxWith is submitTx with transaction options, such as transient
+// data or the peers to endorse with. Neither the options nor the
+// arguments are logged.
+func (wh *walletHandler) submitTxWith(ctx context.Context, name string, opts txOptions, args ...string) ([]byte, string, error) {
+	slog.InfoContext(ctx, "submit transaction", "function", name)
+	type submitted struct {
+		payload []byte
+		txID    string
+	}
+	var result submitted
+	err := wh.retry.do(ctx, name, func() error {
+		var err error
+		callCtx, cancel := wh.callContext(ctx)
+		defer cancel()
+		wh.submissions.Add(1)
+		result, err = callWithContext(callCtx, func() (submitted, error) {
+			defer wh.submissions.Done()
+			defer observeTransaction("submit", name, time.Now())
+			contract, release, err := wh.acquireContract(ctx)
+			if err != nil {
+				return submitted{}, err
+			}
+			defer release()
+			payload, txID, err := submitWithTxID(contract, name, opts, args...)
+			return submitted{payload, txID}, err
+		})
+		return err
+	})
+	if err != nil && result.txID != "" {
+		err = &txError{txID: result.txID, err: err}
+	}
+	recordSubmit(name, err)
+	logTransactionResult(ctx, name, result.payload, err)
+	wh.dropBrokenConnection(ctx, err)
+	if err == nil && len(args) > 0 && assetWrites[name] {
+		wh.forgetAsset(ctx, args[0])
+	}
+	return result.payload, result.txID, err
+}
 
-		body, err := ioutil.ReadAll(req.Body)
+// transactionCreator is implemented by contracts that can build explicit
+// transactions, which is needed to learn a submission's transaction id.
+type transactionCreator interface {
+	CreateTransaction(name string, opts ...gateway.TransactionOption) (*gateway.Transaction, error)
+}
+
+// txSubmitter is implemented by contracts that take transaction options
+// and report transaction ids themselves.
+type txSubmitter interface {
+	submitWithTxID(name string, opts txOptions, args ...string) ([]byte, string, error)
+}
+
+// submitWithTxID submits name on contract. The transaction id comes from the
+// commit event, so it is empty for contracts that only offer
+// SubmitTransaction, which also cannot take transaction options.
+func submitWithTxID(contract ContractInvoker, name string, opts txOptions, args ...string) ([]byte, string, error) {
+	if submitter, ok := contract.(txSubmitter); ok {
+		return submitter.submitWithTxID(name, opts, args...)
+	}
+	creator, ok := contract.(transactionCreator)
+	if !ok {
+		if !opts.empty() {
+			return nil, "", fmt.Errorf("contract cannot create transactions with options")
+		}
+		result, err := contract.SubmitTransaction(name, args...)
+		return result, "", err
+	}
+
+	txn, err := creator.CreateTransaction(name, opts.gatewayOptions()...)
+	if err != nil {
+		return nil, "", err
+	}
+	commit := txn.RegisterCommitEvent()
+	result, err := txn.Submit(args...)
+
+	var txID string
+	select {
+	case event, ok := <-commit:
+		if ok {
+			txID = event.TxID
+		}
+	default:
+	}
+	return result, txID, err
+}
+
+// evaluate evaluates a transaction, giving up when ctx is done.
+func (wh *walletHandler) evaluate(ctx context.Context, name string, args ...string) ([]byte, error) {
+	slog.InfoContext(ctx, "evaluate transaction", "function", name)
+	callCtx, cancel := wh.callContext(ctx)
+	defer cancel()
+	result, err := callWithContext(callCtx, func() ([]byte, error) {
+		defer observeTransaction("evaluate", name, time.Now())
+		contract, release, err := wh.acquireContract(ctx)
 		if err != nil {
-			http.Error(w, "Error reading request body",
-				http.StatusInternalServerError)
+			return nil, err
 		}
+		defer release()
+		return contract.EvaluateTransaction(name, args...)
+	})
+	logTransactionResult(ctx, name, result, err)
+	wh.dropBrokenConnection(ctx, err)
+	return result, err
+}
 
-		asset := Asset{}
-		json.Unmarshal(body, &asset)
+func logTransactionResult(ctx context.Context, name string, result []byte, err error) {
+	if err != nil {
+		slog.WarnContext(ctx, "transaction failed", "function", name, "error", err)
+		return
+	}
+	slog.DebugContext(ctx, "transaction result", "function", name, "payload", string(result))
+}
+
+// callWithContext runs call and returns its result, or ctx.Err() if ctx is
+// done first. The gateway API takes no context, so an abandoned call keeps
+// running in the background until the SDK's own timeouts end it.
+func callWithContext[T any](ctx context.Context, call func() (T, error)) (T, error) {
+	type callResult struct {
+		value T
+		err   error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		value, err := call()
+		done <- callResult{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
 
-		exists := checkIfAssetExists(wh.contract, asset.AssetID)
+func (wh *walletHandler) CreateAsset(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	if req.Method == "POST" {
 
-		log.Println(exists)
+		body := CreateAssetRequest{}
+		if !readJSON(w, req, &body) {
+			return
+		}
+		if !validate(w, body) || !wh.checkEndorsingPeers(w, body.EndorsingPeers) {
+			return
+		}
+		asset := body.Asset
+		opts := txOptions{transient: transientData(body.Transient), endorsingPeers: body.EndorsingPeers}
+
+		if req.URL.Query().Get("async") == "true" {
+			wh.submitAsync(w, req, "CreateAsset", func(ctx context.Context) ([]byte, string, error) {
+				exists, err := wh.assetExists(ctx, asset.AssetID)
+				if err != nil {
+					_, err = assetCheckError(asset.AssetID, err)
+					return nil, "", err
+				}
+				if exists {
+					return nil, "", assetExistsError(asset.AssetID)
+				}
+				return wh.submitTxWith(ctx, "CreateAsset", opts, asset.AssetID, asset.Colour, asset.Size, asset.Owner, asset.AppraisedValue)
+			})
+			return
+		}
+
+		exists, err := wh.assetExists(ctx, asset.AssetID)
+		if err != nil {
+			writeAssetCheckError(w, asset.AssetID, err)
+			return
+		}
 
 		if exists {
-			w.Write([]byte("error asset already exists"))
+			writeError(w, http.StatusConflict, assetExistsError(asset.AssetID))
 			return
 		}
 
-		log.Println("--> Submit Transaction: CreateAsset, creates new asset with ID, color, owner, size, and appraisedValue arguments")
-		result, err := wh.contract.SubmitTransaction("CreateAsset", asset.AssetID, asset.Colour, asset.Size, asset.Owner, asset.AppraisedValue)
+		result, txID, err := wh.submitTxWith(ctx, "CreateAsset", opts, asset.AssetID, asset.Colour, asset.Size, asset.Owner, asset.AppraisedValue)
 		if err != nil {
-			log.Fatalf("Failed to Submit transaction: %v", err)
+			writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+			return
 		}
 
-		w.Write(result)
+		writeTxResult(w, http.StatusCreated, txID, chaincodeData(result))
 	} else {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, req, "POST")
 	}
 }
 
 func (wh *walletHandler) StartTransaction(w http.ResponseWriter, req *http.Request) {
-	setupCORS(&w, req)
-    if (*req).Method == "OPTIONS" {
-        return
-    }
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
 
 	if req.Method == "POST" {
 
-		body, err := ioutil.ReadAll(req.Body)
-		if err != nil {
-			http.Error(w, "Error reading request body",
-				http.StatusInternalServerError)
-		}
-
 		transaction := PostTransaction{}
-		json.Unmarshal(body, &transaction)
+		if !readJSON(w, req, &transaction) {
+			return
+		}
+		if !validate(w, transaction) || !wh.checkEndorsingPeers(w, transaction.EndorsingPeers) {
+			return
+		}
 
-		exists := checkIfAssetExists(wh.contract, transaction.AssetID)
+		exists, err := wh.assetExists(ctx, transaction.AssetID)
+		if err != nil {
+			writeAssetCheckError(w, transaction.AssetID, err)
+			return
+		}
 
 		if !exists {
-			w.Write([]byte("error asset does not exists"))
+			writeError(w, http.StatusNotFound, assetNotFoundError(transaction.AssetID))
 			return
 		}
 
-		log.Println("--> Submit Transaction: TransferAsset asset1, transfer to new owner of Tom")
-		result, err := wh.contract.SubmitTransaction("TransferAsset", transaction.AssetID, transaction.Owner)
+		opts := txOptions{transient: transientData(transaction.Transient), endorsingPeers: transaction.EndorsingPeers}
+		result, txID, err := wh.submitTxWith(ctx, "TransferAsset", opts, transaction.AssetID, transaction.Owner)
 		if err != nil {
-			log.Fatalf("Failed to Submit transaction: %v", err)
+			writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+			return
 		}
 
-		w.Write(result)
+		writeTxResult(w, http.StatusOK, txID, chaincodeData(result))
 	} else {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, req, "POST")
 	}
 }
 
 func (wh *walletHandler) GetAllAssets(w http.ResponseWriter, req *http.Request) {
-	setupCORS(&w, req)
-    if (*req).Method == "OPTIONS" {
-        return
-    }
+	if req.Method != "GET" {
+		methodNotAllowed(w, req, "GET")
+		return
+	}
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	query := req.URL.Query()
+	if owner := query.Get("owner"); owner != "" {
+		wh.getAssetsByOwner(ctx, w, owner)
+		return
+	}
+	if query.Has("pageSize") || query.Has("bookmark") {
+		wh.getAssetsPage(ctx, w, query)
+		return
+	}
+
+	result, err := wh.evaluate(ctx, "GetAllAssets")
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+
+	writeData(w, http.StatusOK, chaincodeList(result))
+}
+
+// getAssetsByOwner serves GET /assets/owner/{owner} and its query-string
+// form GET /assets?owner=NAME. It uses the chaincode's QueryAssetsByOwner
+// rich query when the chaincode provides one (CouchDB state database) and
+// otherwise falls back to filtering GetAllAssets here. The X-Query-Strategy
+// response header reports which of the two was used: "rich-query" or
+// "server-filter".
+func (wh *walletHandler) getAssetsByOwner(ctx context.Context, w http.ResponseWriter, owner string) {
+	result, err := wh.evaluate(ctx, "QueryAssetsByOwner", owner)
+	if err == nil {
+		w.Header().Set("X-Query-Strategy", "rich-query")
+		assets, err := parseLedgerAssets(result)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("unexpected QueryAssetsByOwner response: %w", err))
+			return
+		}
+		writeData(w, http.StatusOK, assets)
+		return
+	}
+	if ctx.Err() != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+	slog.WarnContext(ctx, "QueryAssetsByOwner is unavailable, filtering GetAllAssets instead", "error", err)
+
+	result, err = wh.evaluate(ctx, "GetAllAssets")
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+
+	all, err := parseLedgerAssets(result)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("unexpected GetAllAssets response: %w", err))
+		return
+	}
+
+	owned := []Asset{}
+	for _, asset := range all {
+		if asset.Owner == owner {
+			owned = append(owned, asset)
+		}
+	}
+	w.Header().Set("X-Query-Strategy", "server-filter")
+	writeData(w, http.StatusOK, owned)
+}
 
-	log.Println("--> Evaluate Transaction: GetAllAssets, function returns all the current assets on the ledger")
-	result, err := wh.contract.EvaluateTransaction("GetAllAssets")
+// getAssetsPage serves GET /assets?pageSize=N&bookmark=B by evaluating the
+// chaincode's GetAssetsWithPagination function. An empty bookmark in the
+// response means there are no further pages.
+func (wh *walletHandler) getAssetsPage(ctx context.Context, w http.ResponseWriter, query url.Values) {
+	pageSize := defaultPageSize
+	if raw := query.Get("pageSize"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("pageSize must be a positive integer, got %q", raw))
+			return
+		}
+		pageSize = size
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	bookmark := query.Get("bookmark")
+
+	result, err := wh.evaluate(ctx, "GetAssetsWithPagination", strconv.Itoa(pageSize), bookmark)
 	if err != nil {
-		log.Fatalf("Failed to evaluate transaction: %v", err)
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
 	}
-	log.Println(string(result))
 
-	w.Write(result)
+	var chaincodePage struct {
+		Records             []json.RawMessage `json:"records"`
+		FetchedRecordsCount int               `json:"fetchedRecordsCount"`
+		Bookmark            string            `json:"bookmark"`
+	}
+	if err := json.Unmarshal(result, &chaincodePage); err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("unexpected GetAssetsWithPagination response: %w", err))
+		return
+	}
+
+	page := AssetPage{Assets: chaincodePage.Records, Bookmark: chaincodePage.Bookmark}
+	if page.Assets == nil {
+		page.Assets = []json.RawMessage{}
+	}
+	// Fabric hands back a bookmark even for the last page; only pass it on
+	// when the page was full and there may be more to fetch.
+	if len(page.Assets) < pageSize {
+		page.Bookmark = ""
+	}
+
+	writeData(w, http.StatusOK, page)
 }
 
+// Health serves /health for load balancer liveness and readiness probes.
+func (wh *walletHandler) Health(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	if wh.network == nil || wh.contract == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("gateway is not connected"))
+		return
+	}
+
+	if wh.probeChaincode {
+		if _, err := wh.evaluate(ctx, "AssetExists", "healthcheck-probe"); err != nil {
+			writeError(w, http.StatusServiceUnavailable, fmt.Errorf("chaincode is unreachable: %w", err))
+			return
+		}
+	}
+
+	writeData(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GetSingleAsset serves the legacy POST /asset endpoint.
+//
+// Deprecated: use GET /assets/{id}.
 func (wh *walletHandler) GetSingleAsset(w http.ResponseWriter, req *http.Request) {
-	setupCORS(&w, req)
-    if (*req).Method == "OPTIONS" {
-        return
-    }
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
 
 	if req.Method == "POST" {
 
-		body, err := ioutil.ReadAll(req.Body)
-		if err != nil {
-			http.Error(w, "Error reading request body",
-				http.StatusInternalServerError)
+		asset := PostAsset{}
+		if !readJSON(w, req, &asset) {
+			return
+		}
+		if !validate(w, asset) {
+			return
 		}
 
+		w.Header().Set("Deprecation", "true")
+		wh.readAsset(ctx, w, asset.Id, wantsFresh(req))
+	} else {
+		methodNotAllowed(w, req, "POST")
+	}
+}
+
+// DeleteAsset serves the legacy /asset/delete endpoint.
+//
+// Deprecated: use DELETE /assets/{id}.
+func (wh *walletHandler) DeleteAsset(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	if req.Method == "POST" || req.Method == "DELETE" {
+
 		asset := PostAsset{}
-		json.Unmarshal(body, &asset)
+		if !readJSON(w, req, &asset) {
+			return
+		}
+		if !validate(w, asset) {
+			return
+		}
 
-		exists := checkIfAssetExists(wh.contract, asset.Id)
+		w.Header().Set("Deprecation", "true")
+		wh.deleteAsset(ctx, w, asset.Id)
+	} else {
+		methodNotAllowed(w, req, "POST", "DELETE")
+	}
+}
 
-		log.Println(exists)
+// UpdateAsset serves the legacy /asset/update endpoint.
+//
+// Deprecated: use PUT /assets/{id}.
+func (wh *walletHandler) UpdateAsset(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
 
-		if !exists {
-			w.Write([]byte("error asset does not exists"))
+	if req.Method == "POST" || req.Method == "PUT" {
+
+		asset := Asset{}
+		if !readJSON(w, req, &asset) {
 			return
 		}
 
-		log.Println("--> Evaluate Transaction: ReadAsset, function returns an asset with a given assetID")
-		result, err := wh.contract.EvaluateTransaction("ReadAsset", asset.Id)
-		if err != nil {
-			log.Fatalf("Failed to evaluate transaction: %v\n", err)
+		w.Header().Set("Deprecation", "true")
+		wh.updateAsset(ctx, w, asset)
+	} else {
+		methodNotAllowed(w, req, "POST", "PUT")
+	}
+}
+
+// AssetHistory serves POST /asset/history with a {"id": "..."} body and
+// returns the same history as GET /assets/{id}/history. Both rely on the
+// chaincode exposing a GetAssetHistory function, as the asset-transfer
+// ledger-queries sample does; the basic sample chaincode does not.
+func (wh *walletHandler) AssetHistory(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	if req.Method == "POST" {
+
+		asset := PostAsset{}
+		if !readJSON(w, req, &asset) {
+			return
+		}
+		if !validate(w, asset) {
+			return
 		}
-		log.Println(string(result))
 
-		w.Write(result)
+		wh.assetHistory(ctx, w, asset.Id)
 	} else {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, req, "POST")
+	}
+}
+
+// AssetExists serves /asset/exists, which tells whether an asset id is
+// taken, for instance before a create form is shown. GET takes the id as
+// the id query parameter and POST as a {"id": "..."} body.
+func (wh *walletHandler) AssetExists(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	asset := PostAsset{}
+	switch req.Method {
+	case "GET":
+		asset.Id = req.URL.Query().Get("id")
+	case "POST":
+		if !readJSON(w, req, &asset) {
+			return
+		}
+	default:
+		methodNotAllowed(w, req, "GET", "POST")
+		return
+	}
+	if !validate(w, asset) {
+		return
+	}
+
+	exists, err := wh.assetExists(ctx, asset.Id)
+	if err != nil {
+		writeAssetCheckError(w, asset.Id, err)
+		return
+	}
+	writeData(w, http.StatusOK, ExistsResult{ID: asset.Id, Exists: exists})
+}
+
+// AssetByID serves /assets/{id}. GET reads the asset, PUT replaces its
+// colour, size, owner and appraised value, and DELETE removes it. The id is
+// taken from the path and may be URL-encoded.
+func (wh *walletHandler) AssetByID(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	segments, err := pathSegments(req, "/assets/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(segments) == 2 && segments[0] == "owner" && segments[1] != "" {
+		if req.Method != "GET" {
+			methodNotAllowed(w, req, "GET")
+			return
+		}
+		wh.getAssetsByOwner(ctx, w, segments[1])
+		return
+	}
+	if len(segments) == 2 && segments[0] != "" && segments[1] == "history" {
+		if req.Method != "GET" {
+			methodNotAllowed(w, req, "GET")
+			return
+		}
+		wh.assetHistory(ctx, w, segments[0])
+		return
 	}
+	if len(segments) != 1 || segments[0] == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s", req.URL.Path))
+		return
+	}
+	id := segments[0]
+
+	switch req.Method {
+	case "GET":
+		wh.readAsset(ctx, w, id, wantsFresh(req))
+	case "PUT":
+		asset := Asset{}
+		if !readJSON(w, req, &asset) {
+			return
+		}
+
+		if asset.AssetID != "" && asset.AssetID != id {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("asset_id %s in body does not match %s in path", asset.AssetID, id))
+			return
+		}
+		asset.AssetID = id
+
+		wh.updateAsset(ctx, w, asset)
+	case "DELETE":
+		wh.deleteAsset(ctx, w, id)
+	default:
+		methodNotAllowed(w, req, "GET", "PUT", "DELETE")
+	}
+}
+
+// assetHistory serves GET /assets/{id}/history from the chaincode's
+// GetAssetHistory function, which wraps the stub's GetHistoryForKey. An asset
+// that has been deleted still has a history; one that never existed does not.
+func (wh *walletHandler) assetHistory(ctx context.Context, w http.ResponseWriter, id string) {
+	result, err := wh.evaluate(ctx, "GetAssetHistory", id)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+
+	history, err := parseAssetHistory(result)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("unexpected GetAssetHistory response: %w", err))
+		return
+	}
+	if len(history) == 0 {
+		writeError(w, http.StatusNotFound, withCode(codeAssetNotFound, fmt.Errorf("asset %s has no history", id)))
+		return
+	}
+
+	writeData(w, http.StatusOK, history)
+}
+
+// readAsset answers with asset id. fresh skips the caches, for clients
+// that must see a write made through another replica.
+func (wh *walletHandler) readAsset(ctx context.Context, w http.ResponseWriter, id string, fresh bool) {
+	if fresh {
+		wh.forgetAsset(ctx, id)
+	}
+	exists, err := wh.assetExists(ctx, id)
+	if err != nil {
+		writeAssetCheckError(w, id, err)
+		return
+	}
+
+	if !exists {
+		writeError(w, http.StatusNotFound, assetNotFoundError(id))
+		return
+	}
+
+	result, err := wh.readLedgerAsset(ctx, id)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+
+	writeData(w, http.StatusOK, chaincodeData(result))
+}
+
+func (wh *walletHandler) updateAsset(ctx context.Context, w http.ResponseWriter, asset Asset) {
+	if !validate(w, asset) {
+		return
+	}
+
+	exists, err := wh.assetExists(ctx, asset.AssetID)
+	if err != nil {
+		writeAssetCheckError(w, asset.AssetID, err)
+		return
+	}
+
+	if !exists {
+		writeError(w, http.StatusNotFound, assetNotFoundError(asset.AssetID))
+		return
+	}
+
+	_, txID, err := wh.submitTx(ctx, "UpdateAsset", asset.AssetID, asset.Colour, asset.Size, asset.Owner, asset.AppraisedValue)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+
+	result, err := wh.readLedgerAsset(ctx, asset.AssetID)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+
+	writeTxResult(w, http.StatusOK, txID, chaincodeData(result))
+}
+
+func (wh *walletHandler) deleteAsset(ctx context.Context, w http.ResponseWriter, id string) {
+	exists, err := wh.assetExists(ctx, id)
+	if err != nil {
+		writeAssetCheckError(w, id, err)
+		return
+	}
+
+	if !exists {
+		writeError(w, http.StatusNotFound, assetNotFoundError(id))
+		return
+	}
+
+	_, txID, err := wh.submitTx(ctx, "DeleteAsset", id)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+
+	writeTxResult(w, http.StatusOK, txID, DeleteResult{ID: id, Deleted: true})
 }
 
 func main() {
+	// LOG_FORMAT is read before the rest of the configuration, so that
+	// every line is in the same format; loadConfig rejects bad values.
+	slog.SetDefault(newLogger(os.Stderr, os.Getenv("LOG_FORMAT")))
+
 	log.Println("============ application-golang starts ============")
 
-	err := os.Setenv("DISCOVERY_AS_LOCALHOST", "true")
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	logLevel.Set(cfg.LogLevel)
+	log.Printf("Configuration: listen=%s channel=%s chaincode=%s walletUser=%s ccp=%s walletType=%s wallet=%s credentials=%s timeout=%s requestTimeout=%s shutdownTimeout=%s",
+		cfg.ListenAddr, cfg.ChannelName, cfg.ChaincodeName, cfg.WalletUser, cfg.CCPPath, cfg.WalletType, cfg.WalletPath, cfg.CredentialPath, cfg.Timeout, cfg.RequestTimeout, cfg.ShutdownTimeout)
+
+	if info, err := os.Stat(cfg.CCPPath); err != nil || info.IsDir() {
+		log.Fatalf("Connection profile %s is not a readable file; set CONNECTION_PROFILE to its path", cfg.CCPPath)
+	}
+
+	err = os.Setenv("DISCOVERY_AS_LOCALHOST", "true")
 	if err != nil {
 		log.Fatalf("Error setting DISCOVERY_AS_LOCALHOST environemnt variable: %v", err)
 	}
 
-	wallet, err := gateway.NewFileSystemWallet("wallet")
+	cors = newCORSPolicy(cfg.CORSAllowedOrigins)
+
+	auth, err := newAPIKeyAuth(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create wallet: %v", err)
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	if auth.disabled {
+		slog.Warn("Authentication is disabled; set API_KEY to protect the API and enable the admin routes")
 	}
 
-	if !wallet.Exists("appUser") {
-		err = populateWallet(wallet)
-		if err != nil {
-			log.Fatalf("Failed to populate wallet contents: %v", err)
-		}
+	limiter, err := newRateLimiter(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure rate limiting: %v", err)
 	}
 
-	ccpPath := filepath.Join(
-		"connection",
-		"connection-org1.yaml",
-	)
+	wallet, err := openWallet(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open the wallet: %v", err)
+	}
 
-	gw, err := gateway.Connect(
-		gateway.WithConfig(config.FromFile(filepath.Clean(ccpPath))),
-		gateway.WithIdentity(wallet, "appUser"),
-	)
+	client, err := newFabricClient(cfg, wallet)
+	if err != nil {
+		log.Fatalf("Failed to create the Fabric client: %v", err)
+	}
 
+	gw, network, err := connectNetwork(cfg, wallet)
 	if err != nil {
-		log.Fatalf("Failed to connect to gateway: %v", err)
+		log.Fatalf("Giving up after %d attempts: %v", cfg.StartupMaxAttempts, err)
 	}
 
+	// Runs after the HTTP server has been shut down, so that no handler is
+	// still using the gateway when it is closed.
 	defer gw.Close()
+	setGatewayConnected(cfg.WalletUser, true)
+
+	// Requests and the event listeners use contract through a wrapper that
+	// reconnects when the connection breaks.
+	contract := network.GetContract(cfg.ChaincodeName)
+	defaultContract := newReconnectingContract(&fabricConnection{gw: gw, network: network, contract: contract}, func() (*fabricConnection, error) {
+		return connectContract(cfg, wallet)
+	})
+	defer defaultContract.close()
+
+	if err := verifyChaincode(contract); err != nil {
+		log.Fatalf("Chaincode %q is not available on channel %q; check that it is committed and CHAINCODE_NAME is correct: %v", cfg.ChaincodeName, cfg.ChannelName, err)
+	}
+
+	// Every further chaincode is checked now, so that a name that is not
+	// committed on the channel stops the process rather than failing
+	// requests later.
+	chaincodes := parseFunctionList(cfg.Chaincodes)
+	chaincodes[cfg.ChaincodeName] = true
+	for name := range chaincodes {
+		if name == cfg.ChaincodeName {
+			continue
+		}
+		if err := verifyChaincode(network.GetContract(name)); err != nil {
+			log.Fatalf("Chaincode %q is not available on channel %q; check CHAINCODES: %v", name, cfg.ChannelName, err)
+		}
+	}
 
-	network, err := gw.GetNetwork("mychannel")
+	var pool *contractPool
+	if cfg.ContractPoolSize > 1 {
+		pool, err = newContractPool(cfg, wallet, defaultContract, cfg.ContractPoolSize)
+		if err != nil {
+			log.Fatalf("Failed to build the contract pool: %v", err)
+		}
+		defer pool.close()
+	}
 
+	orgPeers, err := clientOrgPeers(cfg.CCPPath)
+	if err != nil {
+		slog.Warn("Private data endpoints are disabled", "error", err)
+	}
+	knownPeers, err := profilePeers(cfg.CCPPath)
 	if err != nil {
-		log.Fatalf("Failed to get network: %v", err)
+		slog.Warn("Requests cannot choose endorsing peers", "error", err)
 	}
 
-	contract := network.GetContract("basic")
+	ca, err := newCAEnroller(cfg.CCPPath, cfg.CARegistrarID, cfg.CARegistrarSecret)
+	if err != nil {
+		slog.Warn("User enrollment is disabled", "error", err)
+	} else {
+		defer ca.close()
+		if !ca.canRegister {
+			slog.Warn("Identity registration is disabled; set CA_REGISTRAR_SECRET to enable it")
+		}
+	}
 
-	log.Println("--> Submit Transaction: InitLedger, function creates the initial set of assets on the ledger")
-	result, err := contract.SubmitTransaction("InitLedger")
+	var offline *offlineSigning
+	if cfg.OfflineSigningTTL > 0 {
+		offlineNetwork, err := newSDKOfflineNetwork(cfg.CCPPath, wallet, cfg.WalletUser)
+		if err != nil {
+			slog.Warn("Offline signing is disabled", "error", err)
+		} else {
+			defer offlineNetwork.close()
+			offline = newOfflineSigning(offlineNetwork, cfg.OfflineSigningTTL)
+		}
+	}
+
+	existsCache := newExistsCache(cfg.ExistsCacheTTL, cfg.ExistsCacheSize)
+	assetCache := newAssetCache(cfg.AssetCacheTTL, cfg.AssetCacheSize)
+
+	events := newEventHub()
+	// Events only arrive for the default channel and chaincode, whose
+	// cache keys are the bare asset ids.
+	events.assetChanged = func(id string) {
+		existsCache.invalidate(id)
+		assetCache.invalidate(id)
+	}
+	stopEvents, err := events.listen(defaultContract.chaincodeEvents)
 	if err != nil {
-		log.Fatalf("Failed to Submit transaction: %v", err)
+		slog.Warn("Chaincode event streaming is disabled", "error", err)
+		events = nil
+	} else {
+		defer stopEvents()
 	}
-	log.Println(string(result))
+
+	blocks := newBlockTracker()
+	stopBlocks := blocks.follow(defaultContract.blockEvents)
+	defer stopBlocks()
 
 	wHandler := walletHandler{
 		wallet: wallet,
-		contract: contract,
+		network: network,
+		contract: defaultContract,
+		pool: pool,
+		probeChaincode: cfg.ProbeChaincode,
+		timeout: cfg.RequestTimeout,
+		callTimeout: cfg.Timeout,
+		batchAssetTimeout: cfg.BatchAssetTimeout,
+		auth: auth,
+		ca: ca,
+		walletUser: cfg.WalletUser,
+		identities: newIdentityPool(cfg, client),
+		events: events,
+		blocks: blocks,
+		async: newSubmissionQueue(),
+		existsCache: existsCache,
+		assetCache: assetCache,
+		idempotency: newIdempotencyStore(cfg.IdempotencyTTL, cfg.IdempotencyMaxKeys),
+		offline: offline,
+		limiter: limiter,
+		invokeAllowed: parseFunctionList(cfg.InvokeAllowedFunctions),
+		channelName: cfg.ChannelName,
+		channels: parseChannelList(cfg.Channels, cfg.ChannelName),
+		chaincodeName: cfg.ChaincodeName,
+		chaincodes: chaincodes,
+		orgPeers: orgPeers,
+		knownPeers: knownPeers,
+		retry: retryPolicy{
+			maxAttempts: cfg.SubmitMaxAttempts,
+			backoff: cfg.SubmitRetryBackoff,
+			maxBackoff: cfg.SubmitRetryBackoff * 16,
+		},
+	}
+	defer wHandler.identities.close()
+	if cfg.OrgsFile != "" {
+		wHandler.orgs, err = loadOrgRegistry(cfg.OrgsFile, cfg)
+		if err != nil {
+			log.Fatalf("Failed to load organizations: %v", err)
+		}
+		defer wHandler.orgs.close()
+		slog.Info("Organizations loaded", "count", len(wHandler.orgs))
+	}
+	if cfg.IdentityIdleTimeout > 0 {
+		stopIdle := wHandler.identities.closeIdleEvery(cfg.IdentityIdleTimeout)
+		defer stopIdle()
+		for _, org := range wHandler.orgs {
+			stopOrgIdle := org.identities.closeIdleEvery(cfg.IdentityIdleTimeout)
+			defer stopOrgIdle()
+		}
+	}
+
+	// Bind before serving so that an address already in use stops the
+	// process with a clear error instead of surfacing later.
+	listener, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", cfg.ListenAddr, err)
+	}
+
+	go wHandler.async.work(cfg.RequestTimeout)
+
+	wHandler.validator, err = newRequestValidator(openAPIDocument)
+	if err != nil {
+		log.Fatalf("Failed to load the OpenAPI document: %v", err)
+	}
+
+	// Middleware is listed innermost first.
+	var handler http.Handler = instrument(newRouter(&wHandler))
+	handler = limitBody(cfg.MaxBodyBytes, handler)
+	handler = limiter.limit(handler)
+	handler = corsMiddleware(handler)
+	handler = logRequests(handler)
+	handler = withRequestID(handler)
+	handler = wHandler.trackRequests(handler)
+
+	srv := &http.Server{
+		Addr:    cfg.ListenAddr,
+		Handler: handler,
+	}
+
+	// The certificate is reloaded on SIGHUP, for the HTTP and gRPC
+	// servers alike, so that renewals need no restart.
+	if cfg.TLSCertFile != "" {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		stopReload := certs.reloadOnSIGHUP()
+		defer stopReload()
+		srv.TLSConfig = certs.config()
+
+		if cfg.TLSClientCAFile != "" {
+			srv.TLSConfig.ClientCAs, err = loadClientCAs(cfg.TLSClientCAFile)
+			if err != nil {
+				log.Fatalf("Failed to configure mutual TLS: %v", err)
+			}
+			srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		if cfg.ClientIdentityMapFile != "" {
+			wHandler.clientIdentities, err = loadClientIdentityMap(cfg.ClientIdentityMapFile, wallet)
+			if err != nil {
+				log.Fatalf("Failed to configure mutual TLS: %v", err)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var grpcSrv *grpc.Server
+	if cfg.GRPCListenAddr != "" {
+		grpcListener, err := net.Listen("tcp", cfg.GRPCListenAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", cfg.GRPCListenAddr, err)
+		}
+		var opts []grpc.ServerOption
+		if srv.TLSConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(srv.TLSConfig)))
+		}
+		grpcSrv = newGRPCServer(&wHandler, opts...)
+		go func() {
+			log.Printf("Serving gRPC on %s", grpcListener.Addr())
+			if err := grpcSrv.Serve(grpcListener); err != nil {
+				log.Printf("gRPC server failed: %v", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serveHTTP(srv, listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	case <-ctx.Done():
+		pending := atomic.LoadInt64(&wHandler.activeRequests)
+		log.Printf("Shutdown signal received, draining %d in-flight requests", pending)
+
+		if wHandler.events != nil {
+			wHandler.events.close()
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP server shutdown: %v", err)
+		}
+		if grpcSrv != nil {
+			stopped := make(chan struct{})
+			go func() {
+				grpcSrv.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-shutdownCtx.Done():
+				grpcSrv.Stop()
+			}
+		}
+		if err := wHandler.async.drain(shutdownCtx); err != nil {
+			log.Printf("Gave up waiting for queued submissions: %v", err)
+		}
+		if err := wHandler.waitForSubmissions(shutdownCtx); err != nil {
+			log.Printf("Gave up waiting for submitted transactions: %v", err)
+		}
+
+		remaining := atomic.LoadInt64(&wHandler.activeRequests)
+		log.Printf("Drained %d of %d in-flight requests", pending-remaining, pending)
+	}
+
+	log.Println("Closing gateway connection")
+}
+
+// readJSON decodes the request body into v. On failure it writes a 400
+// response and returns false, in which case the handler must return.
+func readJSON(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if req.Header.Get("Content-Type") == "" {
+		slog.WarnContext(req.Context(), "request body has no Content-Type, assuming JSON", "path", req.URL.Path)
+	} else if !isJSONRequest(req) {
+		writeError(w, http.StatusUnsupportedMediaType, withCode(codeUnsupportedMediaType, fmt.Errorf("Content-Type must be application/json, got %q", req.Header.Get("Content-Type"))))
+		return false
 	}
 
-	http.HandleFunc("/create-asset", wHandler.CreateAsset)
-	http.HandleFunc("/transaction", wHandler.StartTransaction)
-	http.HandleFunc("/assets", wHandler.GetAllAssets)
-	http.HandleFunc("/asset", wHandler.GetSingleAsset)
-	http.ListenAndServe(":8090", nil)
+	body, err := ioutil.ReadAll(req.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, bodyTooLargeError(tooLarge.Limit))
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+		return false
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("request body is not valid JSON: %w", err))
+		return false
+	}
+	return true
+}
+
+// pathSegments returns the URL-decoded path segments that follow prefix, so
+// ids containing reserved characters such as "/" can be sent percent-encoded.
+func pathSegments(req *http.Request, prefix string) ([]string, error) {
+	rest := strings.TrimPrefix(req.URL.EscapedPath(), prefix)
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path segment %q: %w", segment, err)
+		}
+		segments[i] = decoded
+	}
+	return segments, nil
+}
+
+// identityStore is the part of a wallet populateWallet needs. The
+// filesystem and in-memory wallets both provide it.
+type identityStore interface {
+	Put(label string, id gateway.Identity) error
 }
 
-func populateWallet(wallet *gateway.Wallet) error {
+// populateWallet stores the wallet user's identity, taken from
+// WALLET_CERT_PEM and WALLET_KEY_PEM when they are set and from the MSP
+// directory at cfg.CredentialPath otherwise.
+func populateWallet(wallet identityStore, cfg *appConfig) error {
 	log.Println("============ Populating wallet ============")
-	credPath := filepath.Join(
-		"user",
-	)
+	if cfg.WalletCertPEM != "" {
+		identity := gateway.NewX509Identity("Org1MSP", cfg.WalletCertPEM, cfg.WalletKeyPEM)
+		return wallet.Put(cfg.WalletUser, identity)
+	}
 
-	certPath := filepath.Join(credPath, "signcerts", "cert.pem")
+	certPath := filepath.Join(cfg.CredentialPath, "signcerts", "cert.pem")
 	// read the certificate pem
 	cert, err := ioutil.ReadFile(filepath.Clean(certPath))
 	if err != nil {
 		return err
 	}
 
-	keyDir := filepath.Join(credPath, "keystore")
-	// there's a single file in this dir containing the private key
-	files, err := ioutil.ReadDir(keyDir)
+	keyPath, err := findPrivateKey(filepath.Join(cfg.CredentialPath, "keystore"))
 	if err != nil {
 		return err
 	}
-	if len(files) != 1 {
-		return fmt.Errorf("keystore folder should have contain one file")
-	}
-	keyPath := filepath.Join(keyDir, files[0].Name())
 	key, err := ioutil.ReadFile(filepath.Clean(keyPath))
 	if err != nil {
 		return err
@@ -262,25 +1342,173 @@ func populateWallet(wallet *gateway.Wallet) error {
 
 	identity := gateway.NewX509Identity("Org1MSP", string(cert), string(key))
 
-	return wallet.Put("appUser", identity)
+	return wallet.Put(cfg.WalletUser, identity)
 }
 
-func checkIfAssetExists(contract *gateway.Contract, asset string) bool{
-	log.Println("--> Evaluate Transaction: AssetExists, function returns 'true' if an asset with given assetID exist")
-	result, _ := contract.EvaluateTransaction("AssetExists", asset)
-	log.Println(string(result))
-	
-	if string(result) == "true"{
-		return true
+// findPrivateKey returns the first key file in keyDir, in name order. CA
+// output may leave several files or hidden ones behind, so only regular
+// files named *_sk or *.pem are considered.
+func findPrivateKey(keyDir string) (string, error) {
+	files, err := ioutil.ReadDir(keyDir)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !file.Mode().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if strings.HasSuffix(name, "_sk") || strings.HasSuffix(name, ".pem") {
+			return filepath.Join(keyDir, name), nil
+		}
+	}
+	return "", fmt.Errorf("keystore folder %s has no private key file (*_sk or *.pem)", keyDir)
+}
+
+// verifyChaincode checks that the contract's chaincode is committed on the
+// channel by evaluating the metadata function every contract-api chaincode
+// provides. Errors raised by the chaincode itself still prove it exists.
+func verifyChaincode(contract ContractInvoker) error {
+	_, err := contract.EvaluateTransaction("org.hyperledger.fabric:GetMetadata")
+	if err == nil || isChaincodeError(err) {
+		return nil
+	}
+	return err
+}
+
+// checkIfAssetExists evaluates AssetExists for asset. An error means the
+// check itself failed, not that the asset is missing.
+func (wh *walletHandler) checkIfAssetExists(ctx context.Context, asset string) (bool, error) {
+	result, err := wh.evaluate(ctx, "AssetExists", asset)
+	if err != nil {
+		return false, err
+	}
+	return string(result) == "true", nil
+}
+
+// writeData sends data to the client wrapped in a successful APIResponse.
+func writeData(w http.ResponseWriter, status int, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to encode response: %w", err))
+		return
+	}
+	writeResponse(w, status, APIResponse{Success: true, Data: raw})
+}
+
+// methodNotAllowed responds with 405 and an Allow header listing the
+// methods the route accepts. OPTIONS is always allowed for CORS preflights.
+func methodNotAllowed(w http.ResponseWriter, req *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(append(allowed, "OPTIONS"), ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("invalid request method %s", req.Method))
+}
+
+// writeError logs err and sends it to the client wrapped in a failed
+// APIResponse with the given HTTP status. Handlers must return after
+// calling it.
+func writeError(w http.ResponseWriter, status int, err error) {
+	slog.Error("request failed", "request_id", w.Header().Get(requestIDHeader), "status", status, "error", err)
+
+	txID := failedTxID(err)
+	if txID != "" {
+		w.Header().Set(txIDHeader, txID)
 	}
+	writeResponse(w, status, APIResponse{Success: false, Error: &APIError{
+		Code:      errorCode(status, err),
+		Message:   err.Error(),
+		Category:  errorCategory(err),
+		RequestID: w.Header().Get(requestIDHeader),
+		TxID:      txID,
+	}})
+}
 
-	return false
+// writeTxResult sends the outcome of a submitted transaction along with its
+// id, which is also set in the X-Transaction-ID header.
+func writeTxResult(w http.ResponseWriter, status int, txID string, result interface{}) {
+	if txID != "" {
+		w.Header().Set(txIDHeader, txID)
+	}
+	writeData(w, status, TxResult{TxID: txID, Result: result})
 }
 
-func setupCORS(w *http.ResponseWriter, req *http.Request) {
-    (*w).Header().Set("Access-Control-Allow-Origin", "*")
-    (*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-    (*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+func writeResponse(w http.ResponseWriter, status int, resp APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// chaincodeData turns a transaction result into response data. Most
+// chaincode functions return JSON, some return a bare string (TransferAsset
+// returns the previous owner) and some return nothing at all.
+func chaincodeData(payload []byte) json.RawMessage {
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return nil
+	}
+	if json.Valid(payload) {
+		return payload
+	}
+	quoted, _ := json.Marshal(string(payload))
+	return quoted
+}
+
+// chaincodeList is chaincodeData for functions that return a list. An
+// empty ledger makes some chaincodes return nothing or null, which becomes
+// an empty array so that clients always get one.
+func chaincodeList(payload []byte) json.RawMessage {
+	data := chaincodeData(payload)
+	if data == nil || bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return json.RawMessage("[]")
+	}
+	return data
+}
+
+// transactionErrorStatus maps an error returned by the gateway to an HTTP
+// status. Errors raised by the chaincode itself (e.g. "asset already exists")
+// are the client's fault and map to 400, and a transaction the peers
+// invalidated at commit maps to 422. A call that ran out of time or whose
+// client went away maps to 504, a peer or orderer that could not be reached
+// to 503 and any other failure of the network to 502. Anything else means
+// the SDK or this API failed and maps to 500.
+func transactionErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return http.StatusGatewayTimeout
+	}
+	if isChaincodeError(err) {
+		return http.StatusBadRequest
+	}
+	if isValidationFailure(err) {
+		return http.StatusUnprocessableEntity
+	}
+	if isConnectivityError(err) {
+		return http.StatusServiceUnavailable
+	}
+	if _, ok := sdkStatus(err); ok {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// isChaincodeError reports whether err originates from the chaincode rather
+// than from the transport or the SDK. When several peers fail, the SDK
+// bundles their errors together and all of them must be chaincode errors.
+func isChaincodeError(err error) bool {
+	s, ok := sdkStatus(err)
+	if !ok {
+		return false
+	}
+	if s.Group == status.ChaincodeStatus {
+		return true
+	}
+	if s.Code != int32(status.MultipleErrors) || len(s.Details) == 0 {
+		return false
+	}
+	for _, detail := range s.Details {
+		detailErr, ok := detail.(error)
+		if !ok || !isChaincodeError(detailErr) {
+			return false
+		}
+	}
+	return true
 }
 
 
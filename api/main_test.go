@@ -0,0 +1,604 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+)
+
+// fakeContract is a ContractInvoker driven by functions, standing in for
+// a Fabric network. Calls without a function succeed with no payload.
+type fakeContract struct {
+	mu          sync.Mutex
+	calls       []string
+	submissions []fakeSubmission
+	evaluate    func(name string, args ...string) ([]byte, error)
+	submit      func(name string, args ...string) ([]byte, error)
+}
+
+// fakeSubmission is a submission fakeContract received, with the options
+// it was created with.
+type fakeSubmission struct {
+	name string
+	opts txOptions
+	args []string
+}
+
+func (c *fakeContract) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	c.record(name)
+	if c.evaluate == nil {
+		return nil, nil
+	}
+	return c.evaluate(name, args...)
+}
+
+func (c *fakeContract) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	c.record(name)
+	if c.submit == nil {
+		return nil, nil
+	}
+	return c.submit(name, args...)
+}
+
+// submitWithTxID records the submission and its options and answers it
+// like SubmitTransaction, with no transaction id.
+func (c *fakeContract) submitWithTxID(name string, opts txOptions, args ...string) ([]byte, string, error) {
+	c.mu.Lock()
+	c.submissions = append(c.submissions, fakeSubmission{name: name, opts: opts, args: args})
+	c.mu.Unlock()
+	result, err := c.SubmitTransaction(name, args...)
+	return result, "", err
+}
+
+// submitted returns the submissions received so far.
+func (c *fakeContract) submitted() []fakeSubmission {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]fakeSubmission(nil), c.submissions...)
+}
+
+func (c *fakeContract) record(name string) {
+	c.mu.Lock()
+	c.calls = append(c.calls, name)
+	c.mu.Unlock()
+}
+
+// count returns how many times the function name was called.
+func (c *fakeContract) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, call := range c.calls {
+		if call == name {
+			n++
+		}
+	}
+	return n
+}
+
+// ledger returns an evaluate function for a ledger holding assets, keyed
+// by id, that answers AssetExists, ReadAsset and GetAllAssets.
+func ledger(assets map[string]string) func(string, ...string) ([]byte, error) {
+	return func(name string, args ...string) ([]byte, error) {
+		switch name {
+		case "AssetExists":
+			_, ok := assets[args[0]]
+			return []byte(boolString(ok)), nil
+		case "ReadAsset":
+			asset, ok := assets[args[0]]
+			if !ok {
+				return nil, chaincodeError("the asset " + args[0] + " does not exist")
+			}
+			return []byte(asset), nil
+		case "GetAllAssets":
+			var all []string
+			for _, asset := range assets {
+				all = append(all, asset)
+			}
+			return []byte("[" + strings.Join(all, ",") + "]"), nil
+		}
+		return nil, nil
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// failing returns a contract function that always fails with err.
+func failing(err error) func(string, ...string) ([]byte, error) {
+	return func(string, ...string) ([]byte, error) { return nil, err }
+}
+
+// answering returns a contract function that always answers result.
+func answering(result string) func(string, ...string) ([]byte, error) {
+	return func(string, ...string) ([]byte, error) { return []byte(result), nil }
+}
+
+// sleeping returns a contract function that answers like next after d,
+// standing in for a peer that stopped responding.
+func sleeping(d time.Duration, next func(string, ...string) ([]byte, error)) func(string, ...string) ([]byte, error) {
+	return func(name string, args ...string) ([]byte, error) {
+		time.Sleep(d)
+		if next == nil {
+			return nil, nil
+		}
+		return next(name, args...)
+	}
+}
+
+// Errors shaped like those the SDK returns.
+func chaincodeError(msg string) error {
+	return status.New(status.ChaincodeStatus, 500, msg, nil)
+}
+
+var (
+	errPeerUnreachable = status.New(status.EndorserClientStatus, status.ConnectionFailed.ToInt32(), "connection to peer0 failed", nil)
+	errPeerRejected    = status.New(status.EndorserServerStatus, 500, "endorsement failure", nil)
+	errSDKBroken       = errors.New("sdk failure")
+)
+
+// newTestHandler returns a walletHandler that serves every request with
+// contract and no caches, authentication or Fabric identities.
+func newTestHandler(contract ContractInvoker) *walletHandler {
+	return &walletHandler{
+		contract:      contract,
+		timeout:       time.Second,
+		auth:          &apiKeyAuth{disabled: true},
+		walletUser:    "appUser",
+		channelName:   "mychannel",
+		channels:      map[string]bool{"mychannel": true},
+		chaincodeName: "basic",
+		chaincodes:    map[string]bool{"basic": true},
+		async:         newSubmissionQueue(),
+		retry:         retryPolicy{maxAttempts: 1},
+	}
+}
+
+// serve sends a request to h and returns the recorded response. A
+// non-empty body is sent as JSON; header holds name, value pairs.
+func serve(h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeResponse decodes the APIResponse envelope of rec, failing the test
+// when it is not one.
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder) APIResponse {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var resp APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not an APIResponse: %v: %s", err, rec.Body)
+	}
+	return resp
+}
+
+// expectError checks that rec is a failed APIResponse with status and code.
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) APIResponse {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	resp := decodeResponse(t, rec)
+	if resp.Success || resp.Error == nil || resp.Data != nil {
+		t.Fatalf("want a failed envelope with an error and no data, got %s", rec.Body)
+	}
+	if resp.Error.Code != code {
+		t.Errorf("error code = %q, want %q", resp.Error.Code, code)
+	}
+	if resp.Error.Message == "" {
+		t.Error("error message is empty")
+	}
+	return resp
+}
+
+const asset1 = `{"ID":"asset1","Color":"blue","Size":5,"Owner":"Tomoko","AppraisedValue":300}`
+
+const createBody = `{"asset_id":"asset9","owner":"Tomoko","colour":"blue","size":"5","appraised_value":"300"}`
+
+// TestHandlerFailures drives the asset handlers against a failing contract
+// and checks that each failure is answered with its status and an error
+// envelope, and that the handler keeps serving afterwards.
+func TestHandlerFailures(t *testing.T) {
+	empty := ledger(map[string]string{})
+	stocked := ledger(map[string]string{"asset1": asset1})
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		evaluate func(string, ...string) ([]byte, error)
+		submit   func(string, ...string) ([]byte, error)
+		status   int
+		code     string
+	}{
+		{"create: exists check fails", "POST", "/create-asset", createBody, failing(errPeerUnreachable), nil, http.StatusBadGateway, codeGatewayUnavailable},
+		{"create: asset exists", "POST", "/create-asset", `{"asset_id":"asset1","owner":"Tomoko","colour":"blue","size":"5","appraised_value":"300"}`, stocked, nil, http.StatusConflict, codeAssetExists},
+		{"create: chaincode rejects", "POST", "/create-asset", createBody, empty, failing(chaincodeError("bad asset")), http.StatusBadRequest, codeChaincodeError},
+		{"create: peer unreachable", "POST", "/create-asset", createBody, empty, failing(errPeerUnreachable), http.StatusServiceUnavailable, codeGatewayUnavailable},
+		{"create: peer rejects", "POST", "/create-asset", createBody, empty, failing(errPeerRejected), http.StatusBadGateway, codeGatewayUnavailable},
+		{"create: sdk fails", "POST", "/create-asset", createBody, empty, failing(errSDKBroken), http.StatusInternalServerError, codeInternal},
+
+		{"get: exists check fails", "GET", "/assets/asset1", "", failing(errPeerUnreachable), nil, http.StatusBadGateway, codeGatewayUnavailable},
+		{"get: missing asset", "GET", "/assets/asset2", "", stocked, nil, http.StatusNotFound, codeAssetNotFound},
+		{"get: legacy missing asset", "POST", "/asset", `{"id":"asset2"}`, stocked, nil, http.StatusNotFound, codeAssetNotFound},
+		{"get: read fails", "GET", "/assets/asset1", "", func(name string, args ...string) ([]byte, error) {
+			if name == "AssetExists" {
+				return []byte("true"), nil
+			}
+			return nil, errPeerUnreachable
+		}, nil, http.StatusServiceUnavailable, codeGatewayUnavailable},
+
+		{"list: chaincode fails", "GET", "/assets", "", failing(chaincodeError("no")), nil, http.StatusBadRequest, codeChaincodeError},
+		{"list: peer unreachable", "GET", "/assets", "", failing(errPeerUnreachable), nil, http.StatusServiceUnavailable, codeGatewayUnavailable},
+		{"list: sdk fails", "GET", "/assets", "", failing(errSDKBroken), nil, http.StatusInternalServerError, codeInternal},
+
+		{"transfer: exists check fails", "POST", "/transaction", `{"asset_id":"asset1","owner":"Max"}`, failing(errPeerUnreachable), nil, http.StatusBadGateway, codeGatewayUnavailable},
+		{"transfer: missing asset", "POST", "/transaction", `{"asset_id":"asset2","owner":"Max"}`, stocked, nil, http.StatusNotFound, codeAssetNotFound},
+		{"transfer: chaincode rejects", "POST", "/transaction", `{"asset_id":"asset1","owner":"Max"}`, stocked, failing(chaincodeError("no")), http.StatusBadRequest, codeChaincodeError},
+		{"transfer: peer unreachable", "POST", "/transaction", `{"asset_id":"asset1","owner":"Max"}`, stocked, failing(errPeerUnreachable), http.StatusServiceUnavailable, codeGatewayUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := &fakeContract{evaluate: tt.evaluate, submit: tt.submit}
+			router := newRouter(newTestHandler(contract))
+
+			expectError(t, serve(router, tt.method, tt.target, tt.body), tt.status, tt.code)
+
+			// The handler survives the failure and answers the next request.
+			contract.evaluate = ledger(map[string]string{})
+			if rec := serve(router, "GET", "/assets", ""); rec.Code != http.StatusOK {
+				t.Fatalf("after the failure, GET /assets = %d: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+// TestErrorEnvelope checks the fields of the error envelope for each kind
+// of failure, including the request id withRequestID assigns.
+func TestErrorEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		err      error
+		code     string
+		category string
+		txID     string
+	}{
+		{"not found", http.StatusNotFound, assetNotFoundError("asset1"), codeAssetNotFound, "", ""},
+		{"duplicate", http.StatusConflict, assetExistsError("asset1"), codeAssetExists, "", ""},
+		{"chaincode", http.StatusBadRequest, chaincodeError("no"), codeChaincodeError, categoryChaincode, ""},
+		{"unreachable", http.StatusServiceUnavailable, errPeerUnreachable, codeGatewayUnavailable, categoryNetwork, ""},
+		{"timeout", http.StatusGatewayTimeout, context.DeadlineExceeded, codeTimeout, categoryTimeout, ""},
+		{"invalidated", http.StatusUnprocessableEntity, &txError{txID: "tx1", err: status.New(status.EventServerStatus, int32(peer.TxValidationCode_MVCC_READ_CONFLICT), "conflict", nil)}, codeTransactionInvalid, categoryChaincode, "tx1"},
+		{"internal", http.StatusInternalServerError, errSDKBroken, codeInternal, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				writeError(w, tt.status, tt.err)
+			}))
+			rec := serve(h, "GET", "/", "", requestIDHeader, "req-1")
+
+			resp := expectError(t, rec, tt.status, tt.code)
+			if resp.Error.RequestID != "req-1" {
+				t.Errorf("requestId = %q, want req-1", resp.Error.RequestID)
+			}
+			if resp.Error.Category != tt.category {
+				t.Errorf("category = %q, want %q", resp.Error.Category, tt.category)
+			}
+			if resp.Error.TxID != tt.txID || rec.Header().Get(txIDHeader) != tt.txID {
+				t.Errorf("txId = %q, header %q, want %q", resp.Error.TxID, rec.Header().Get(txIDHeader), tt.txID)
+			}
+		})
+	}
+}
+
+// TestRouteFailuresCarryRequestID checks that failures answered by the
+// routes carry the request id too.
+func TestRouteFailuresCarryRequestID(t *testing.T) {
+	contract := &fakeContract{evaluate: failing(errPeerUnreachable)}
+	h := withRequestID(newRouter(newTestHandler(contract)))
+
+	for _, target := range []string{"/assets", "/assets/asset1"} {
+		resp := decodeResponse(t, serve(h, "GET", target, "", requestIDHeader, "req-2"))
+		if resp.Error == nil || resp.Error.RequestID != "req-2" {
+			t.Errorf("GET %s: want an error with requestId req-2, got %+v", target, resp.Error)
+		}
+	}
+}
+
+// TestFakeContractSubmissions checks, through the ContractInvoker seam,
+// which transactions CreateAsset and StartTransaction submit.
+func TestFakeContractSubmissions(t *testing.T) {
+	var submitted []string
+	contract := &fakeContract{
+		evaluate: ledger(map[string]string{"asset1": asset1}),
+		submit: func(name string, args ...string) ([]byte, error) {
+			submitted = append([]string{name}, args...)
+			if name == "TransferAsset" {
+				return []byte("Tomoko"), nil
+			}
+			return nil, nil
+		},
+	}
+	router := newRouter(newTestHandler(contract))
+
+	rec := serve(router, "POST", "/create-asset", createBody)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", rec.Code, rec.Body)
+	}
+	if want := "CreateAsset asset9 blue 5 Tomoko 300"; strings.Join(submitted, " ") != want {
+		t.Errorf("submitted %q, want %q", strings.Join(submitted, " "), want)
+	}
+
+	rec = serve(router, "POST", "/transaction", `{"asset_id":"asset1","owner":"Max"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("transfer = %d: %s", rec.Code, rec.Body)
+	}
+	if want := "TransferAsset asset1 Max"; strings.Join(submitted, " ") != want {
+		t.Errorf("submitted %q, want %q", strings.Join(submitted, " "), want)
+	}
+	var result TxResult
+	if err := json.Unmarshal(decodeResponse(t, rec).Data, &result); err != nil || result.Result != "Tomoko" {
+		t.Errorf("transfer result = %+v (%v), want the previous owner", result, err)
+	}
+}
+
+// routeCase is a request to the router against a fake contract and what
+// it must be answered with. An empty code expects success; data, when set,
+// is the expected response data and submitted the expected last
+// submission, as the function name followed by its arguments.
+type routeCase struct {
+	name      string
+	method    string
+	target    string
+	body      string
+	evaluate  func(string, ...string) ([]byte, error)
+	submit    func(string, ...string) ([]byte, error)
+	timeout   time.Duration
+	status    int
+	code      string
+	data      string
+	submitted string
+}
+
+func (tt routeCase) run(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		submitted string
+	)
+	contract := &fakeContract{evaluate: tt.evaluate, submit: func(name string, args ...string) ([]byte, error) {
+		mu.Lock()
+		submitted = strings.Join(append([]string{name}, args...), " ")
+		mu.Unlock()
+		if tt.submit == nil {
+			return nil, nil
+		}
+		return tt.submit(name, args...)
+	}}
+	wh := newTestHandler(contract)
+	if tt.timeout > 0 {
+		wh.timeout = tt.timeout
+	}
+
+	rec := serve(newRouter(wh), tt.method, tt.target, tt.body)
+	if tt.code != "" {
+		expectError(t, rec, tt.status, tt.code)
+	} else {
+		if rec.Code != tt.status {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+		}
+		resp := decodeResponse(t, rec)
+		if !resp.Success {
+			t.Fatalf("want success, got %s", rec.Body)
+		}
+		if tt.data != "" && string(resp.Data) != tt.data {
+			t.Errorf("data = %s, want %s", resp.Data, tt.data)
+		}
+	}
+	// A call the handler gave up on may still be running.
+	if tt.timeout > 0 && tt.submitted != "" {
+		deadline := time.Now().Add(time.Second)
+		for {
+			mu.Lock()
+			done := submitted != ""
+			mu.Unlock()
+			if done || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if submitted != tt.submitted {
+		t.Errorf("submitted %q, want %q", submitted, tt.submitted)
+	}
+}
+
+// TestAssetRoutes runs requests through the asset routes.
+func TestAssetRoutes(t *testing.T) {
+	stocked := ledger(map[string]string{"asset1": asset1})
+
+	tests := []routeCase{
+		// Deleting an asset.
+		{name: "delete", method: "DELETE", target: "/assets/asset1", evaluate: stocked, status: http.StatusOK, data: `{"result":{"id":"asset1","deleted":true}}`, submitted: "DeleteAsset asset1"},
+		{name: "delete missing asset", method: "DELETE", target: "/assets/asset2", evaluate: stocked, status: http.StatusNotFound, code: codeAssetNotFound},
+		{name: "delete fails", method: "DELETE", target: "/assets/asset1", evaluate: stocked, submit: failing(chaincodeError("no")), status: http.StatusBadRequest, code: codeChaincodeError, submitted: "DeleteAsset asset1"},
+		{name: "legacy delete", method: "POST", target: "/asset/delete", body: `{"id":"asset1"}`, evaluate: stocked, status: http.StatusOK, submitted: "DeleteAsset asset1"},
+		{name: "legacy delete missing asset", method: "DELETE", target: "/asset/delete", body: `{"id":"asset2"}`, evaluate: stocked, status: http.StatusNotFound, code: codeAssetNotFound},
+		{name: "legacy delete without id", method: "POST", target: "/asset/delete", body: `{}`, evaluate: stocked, status: http.StatusBadRequest, code: codeValidationFailed},
+		{name: "legacy delete wrong method", method: "GET", target: "/asset/delete", evaluate: stocked, status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+
+		// Ids in the path.
+		{name: "read", method: "GET", target: "/assets/asset1", evaluate: stocked, status: http.StatusOK, data: asset1},
+		{name: "read missing id", method: "GET", target: "/assets/", evaluate: stocked, status: http.StatusNotFound, code: codeNotFound},
+		{name: "read missing asset", method: "GET", target: "/assets/asset2", evaluate: stocked, status: http.StatusNotFound, code: codeAssetNotFound},
+		{name: "read encoded id", method: "GET", target: "/assets/lot%2F7%20b", evaluate: ledger(map[string]string{"lot/7 b": asset1}), status: http.StatusOK, data: asset1},
+		{name: "update encoded id", method: "PUT", target: "/assets/lot%2F7", body: `{"owner":"Max","colour":"red","size":"1","appraised_value":"2"}`, evaluate: ledger(map[string]string{"lot/7": asset1}), status: http.StatusOK, submitted: "UpdateAsset lot/7 red 1 Max 2"},
+		{name: "update id mismatch", method: "PUT", target: "/assets/asset1", body: `{"asset_id":"asset2","owner":"Max","colour":"red","size":"1","appraised_value":"2"}`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "delete encoded id", method: "DELETE", target: "/assets/lot%2F7", evaluate: ledger(map[string]string{"lot/7": asset1}), status: http.StatusOK, submitted: "DeleteAsset lot/7"},
+		{name: "legacy read missing id", method: "POST", target: "/asset", body: `{"id":""}`, evaluate: stocked, status: http.StatusBadRequest, code: codeValidationFailed},
+
+		// Malformed bodies.
+		{name: "create malformed body", method: "POST", target: "/create-asset", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "transfer malformed body", method: "POST", target: "/transaction", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "legacy read malformed body", method: "POST", target: "/asset", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "legacy delete malformed body", method: "POST", target: "/asset/delete", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "legacy update malformed body", method: "POST", target: "/asset/update", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "update malformed body", method: "PUT", target: "/assets/asset1", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "bulk malformed body", method: "POST", target: "/assets/bulk", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+		{name: "invoke malformed body", method: "POST", target: "/invoke", body: `{ not json }`, evaluate: stocked, status: http.StatusBadRequest, code: codeInvalidRequest},
+
+		// Listing an empty ledger.
+		{name: "list empty ledger", method: "GET", target: "/assets", evaluate: ledger(map[string]string{}), status: http.StatusOK, data: `[]`},
+		{name: "list null result", method: "GET", target: "/assets", evaluate: answering("null"), status: http.StatusOK, data: `[]`},
+		{name: "list no result", method: "GET", target: "/assets", evaluate: answering(""), status: http.StatusOK, data: `[]`},
+
+		// Contracts slower than the request timeout.
+		{name: "read times out", method: "GET", target: "/assets/asset1", evaluate: sleeping(time.Second, stocked), timeout: 20 * time.Millisecond, status: http.StatusGatewayTimeout, code: codeTimeout},
+		{name: "list times out", method: "GET", target: "/assets", evaluate: sleeping(time.Second, stocked), timeout: 20 * time.Millisecond, status: http.StatusGatewayTimeout, code: codeTimeout},
+		{name: "create times out", method: "POST", target: "/create-asset", body: createBody, evaluate: stocked, submit: sleeping(time.Second, nil), timeout: 20 * time.Millisecond, status: http.StatusGatewayTimeout, code: codeTimeout, submitted: "CreateAsset asset9 blue 5 Tomoko 300"},
+		{name: "transfer times out", method: "POST", target: "/transaction", body: `{"asset_id":"asset1","owner":"Max"}`, evaluate: stocked, submit: sleeping(time.Second, nil), timeout: 20 * time.Millisecond, status: http.StatusGatewayTimeout, code: codeTimeout, submitted: "TransferAsset asset1 Max"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
+
+// TestMethodNotAllowed checks that routes refuse other methods with 405
+// and list the ones they accept in the Allow header.
+func TestMethodNotAllowed(t *testing.T) {
+	tests := []struct {
+		method, target, allow string
+	}{
+		{"GET", "/create-asset", "POST, OPTIONS"},
+		{"DELETE", "/transaction", "POST, OPTIONS"},
+		{"POST", "/assets", "GET, OPTIONS"},
+		{"PATCH", "/assets/asset1", "GET, PUT, DELETE, OPTIONS"},
+		{"PUT", "/asset", "POST, OPTIONS"},
+		{"GET", "/asset/delete", "POST, DELETE, OPTIONS"},
+		{"GET", "/asset/update", "POST, PUT, OPTIONS"},
+		{"DELETE", "/asset/exists", "GET, POST, OPTIONS"},
+		{"GET", "/assets/bulk", "POST, OPTIONS"},
+		{"POST", "/events", "GET, OPTIONS"},
+	}
+	h := newRouter(newTestHandler(&fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})}))
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, "")
+			expectError(t, rec, http.StatusMethodNotAllowed, codeMethodNotAllowed)
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+// TestHungContract checks that a contract that never answers costs the
+// client no more than the request timeout or FABRIC_TIMEOUT, or less when
+// the client gives up first, and that each answers 504.
+func TestHungContract(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	hung := func(string, ...string) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		callTimeout time.Duration
+		cancel      time.Duration
+	}{
+		{"request timeout", 20 * time.Millisecond, 0, 0},
+		{"fabric timeout", time.Hour, 20 * time.Millisecond, 0},
+		{"client went away", time.Hour, 0, 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := newTestHandler(&fakeContract{evaluate: hung, submit: hung})
+			wh.timeout, wh.callTimeout = tt.timeout, tt.callTimeout
+			h := newRouter(wh)
+
+			for _, target := range []string{"/assets", "/assets/asset1"} {
+				req := httptest.NewRequest("GET", target, nil)
+				if tt.cancel > 0 {
+					ctx, cancel := context.WithTimeout(req.Context(), tt.cancel)
+					defer cancel()
+					req = req.WithContext(ctx)
+				}
+				rec := httptest.NewRecorder()
+				start := time.Now()
+				h.ServeHTTP(rec, req)
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("%s took %s", target, elapsed)
+				}
+				expectError(t, rec, http.StatusGatewayTimeout, codeTimeout)
+			}
+		})
+	}
+}
+
+// TestAssetCheckFailures checks that a failed AssetExists evaluation fails
+// the request with 502, rather than passing for a missing asset, and that
+// nothing is submitted after it.
+func TestAssetCheckFailures(t *testing.T) {
+	stocked := ledger(map[string]string{"asset1": asset1})
+	checkFails := func(err error) func(string, ...string) ([]byte, error) {
+		return func(name string, args ...string) ([]byte, error) {
+			if name == "AssetExists" {
+				return nil, err
+			}
+			return stocked(name, args...)
+		}
+	}
+	unreachable, rejected := checkFails(errPeerUnreachable), checkFails(errPeerRejected)
+	update := `{"owner":"Max","colour":"red","size":"1","appraised_value":"2"}`
+
+	tests := []routeCase{
+		{name: "create", method: "POST", target: "/create-asset", body: createBody, evaluate: unreachable, status: http.StatusBadGateway, code: codeGatewayUnavailable},
+		{name: "create rejected", method: "POST", target: "/create-asset", body: createBody, evaluate: rejected, status: http.StatusBadGateway, code: codeGatewayUnavailable},
+		{name: "transfer", method: "POST", target: "/transaction", body: `{"asset_id":"asset1","owner":"Max"}`, evaluate: unreachable, status: http.StatusBadGateway, code: codeGatewayUnavailable},
+		{name: "transfer with history", method: "POST", target: "/asset/transfer/history", body: `{"asset_id":"asset1","owner":"Max"}`, evaluate: unreachable, status: http.StatusBadGateway, code: codeGatewayUnavailable},
+		{name: "legacy read", method: "POST", target: "/asset", body: `{"id":"asset1"}`, evaluate: unreachable, status: http.StatusBadGateway, code: codeGatewayUnavailable},
+		{name: "update", method: "PUT", target: "/assets/asset1", body: update, evaluate: unreachable, status: http.StatusBadGateway, code: codeGatewayUnavailable},
+		{name: "delete", method: "DELETE", target: "/assets/asset1", evaluate: unreachable, status: http.StatusBadGateway, code: codeGatewayUnavailable},
+		{name: "check times out", method: "DELETE", target: "/assets/asset1", evaluate: checkFails(context.DeadlineExceeded), status: http.StatusGatewayTimeout, code: codeTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, tt.run)
+	}
+}
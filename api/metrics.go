@@ -0,0 +1,104 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_http_requests_total",
+		Help: "HTTP requests served, by route, method and status code.",
+	}, []string{"endpoint", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "method"})
+
+	submittedTransactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_fabric_submit_transactions_total",
+		Help: "Transactions submitted to the ledger, by chaincode function and outcome.",
+	}, []string{"function", "outcome"})
+
+	transactionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_fabric_transaction_duration_seconds",
+		Help:    "Time taken by Fabric transactions, by kind (submit or evaluate) and chaincode function.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"kind", "function"})
+
+	gatewayConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "api_fabric_gateway_connected",
+		Help: "1 while a gateway connection is open for the wallet identity, 0 once it is closed.",
+	}, []string{"identity"})
+
+	ledgerHeight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "api_fabric_ledger_height",
+		Help: "Height of the channel's ledger, from the last block event received.",
+	})
+
+	assetCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_asset_cache_lookups_total",
+		Help: "Lookups in the ReadAsset cache, by result (hit or miss).",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpDuration, submittedTransactions, transactionDuration, gatewayConnected, ledgerHeight, assetCacheLookups)
+}
+
+// instrument records request counts and latency for every route on mux.
+// Requests are labelled with the mux pattern they matched rather than the
+// raw path, so asset ids do not each get their own series.
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, req)
+
+		_, endpoint := mux.Handler(req)
+		if endpoint == "" {
+			endpoint = "unmatched"
+		}
+		httpRequests.WithLabelValues(endpoint, req.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(endpoint, req.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeTransaction records how long a submit or evaluate call took.
+func observeTransaction(kind, function string, start time.Time) {
+	transactionDuration.WithLabelValues(kind, function).Observe(time.Since(start).Seconds())
+}
+
+// setGatewayConnected updates the connection gauge for identity.
+func setGatewayConnected(identity string, connected bool) {
+	value := 0.0
+	if connected {
+		value = 1
+	}
+	gatewayConnected.WithLabelValues(identity).Set(value)
+}
+
+// recordSubmit counts the outcome of a submitted transaction.
+func recordSubmit(function string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	submittedTransactions.WithLabelValues(function, outcome).Inc()
+}
+
+// setLedgerHeight updates the ledger height gauge.
+func setLedgerHeight(height uint64) {
+	ledgerHeight.Set(float64(height))
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// TestMetricNames exercises the handlers through the instrumented router
+// and checks that /metrics then reports each metric with the labels of
+// the requests made.
+func TestMetricNames(t *testing.T) {
+	wallet := gateway.NewInMemoryWallet()
+	if err := wallet.Put("metricsUser", gateway.NewX509Identity("Org1MSP", "cert", "key")); err != nil {
+		t.Fatalf("wallet.Put: %v", err)
+	}
+	contract := &fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})}
+	wh := newTestHandler(contract)
+	wh.wallet = wallet
+	wh.identities = newIdentityPool(&appConfig{}, &fakeClient{contract: contract})
+	h := instrument(newRouter(wh))
+
+	requests := []struct {
+		method, target, body string
+		header               []string
+		status               int
+	}{
+		{"GET", "/assets", "", nil, http.StatusOK},
+		{"POST", "/create-asset", createBody, nil, http.StatusCreated},
+		{"GET", "/assets/asset7", "", nil, http.StatusNotFound},
+		{"GET", "/assets/asset1", "", []string{fabricUserHeader, "metricsUser"}, http.StatusOK},
+	}
+	for _, r := range requests {
+		if rec := serve(h, r.method, r.target, r.body, r.header...); rec.Code != r.status {
+			t.Fatalf("%s %s: status = %d, want %d: %s", r.method, r.target, rec.Code, r.status, rec.Body)
+		}
+	}
+
+	rec := serve(h, "GET", "/metrics", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	exposition := rec.Body.String()
+	for _, want := range []string{
+		`api_http_requests_total{endpoint="/assets",method="GET",status="200"}`,
+		`api_http_requests_total{endpoint="/create-asset",method="POST",status="201"}`,
+		`api_http_requests_total{endpoint="/assets/",method="GET",status="404"}`,
+		`api_http_request_duration_seconds_count{endpoint="/assets",method="GET"}`,
+		`api_fabric_submit_transactions_total{function="CreateAsset",outcome="success"}`,
+		`api_fabric_transaction_duration_seconds_count{function="CreateAsset",kind="submit"}`,
+		`api_fabric_transaction_duration_seconds_count{function="GetAllAssets",kind="evaluate"}`,
+		`api_fabric_gateway_connected{identity="metricsUser"} 1`,
+	} {
+		if !strings.Contains(exposition, want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+
+	wh.identities.evict("metricsUser")
+	if body := serve(h, "GET", "/metrics", "").Body.String(); !strings.Contains(body, `api_fabric_gateway_connected{identity="metricsUser"} 0`) {
+		t.Error("the gateway gauge is not 0 once the connection is closed")
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// txIDHeader carries the id of the transaction a request submitted, so
+// that logRequests can report it.
+const txIDHeader = "X-Transaction-ID"
+
+type requestIDKey struct{}
+
+// withRequestID gives every request an id, reusing the caller's
+// X-Request-ID when it looks sane. The id is echoed in the response header,
+// where writeError picks it up, and stored in the request context for the
+// logger.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(req.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// limitBody caps request bodies at max bytes. Requests that declare a
+// larger Content-Length are refused outright; for the rest, reading past
+// the limit fails and readJSON answers 413.
+func limitBody(max int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if max <= 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if req.ContentLength > max {
+			writeError(w, http.StatusRequestEntityTooLarge, bodyTooLargeError(max))
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, max)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// requestIDFrom returns the id withRequestID stored in ctx, if any.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// logRequests logs the start and end of every request. It must run inside
+// withRequestID so both lines carry the request id. Server errors are
+// logged at error level.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ctx := req.Context()
+		slog.InfoContext(ctx, "request started", "method", req.Method, "endpoint", req.URL.Path, "remote_addr", req.RemoteAddr)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, req)
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"method", req.Method,
+			"endpoint", req.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", req.RemoteAddr,
+		}
+		if txID := rec.Header().Get(txIDHeader); txID != "" {
+			attrs = append(attrs, "tx_id", txID)
+		}
+		slog.Log(ctx, level, "request finished", attrs...)
+	})
+}
+
+// statusRecorder remembers the status code and body size written through
+// it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets WebSocket handlers take over the connection through the
+// recorder.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
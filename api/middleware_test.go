@@ -0,0 +1,61 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLimitBody checks that bodies over the cap are refused with 413,
+// whether they declare their length or not.
+func TestLimitBody(t *testing.T) {
+	const max = 128
+	large := strings.Replace(createBody, "Tomoko", strings.Repeat("x", max), 1)
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		max     int64
+		status  int
+	}{
+		{"under the cap", createBody, false, max, http.StatusCreated},
+		{"declared over the cap", large, false, max, http.StatusRequestEntityTooLarge},
+		{"chunked over the cap", large, true, max, http.StatusRequestEntityTooLarge},
+		{"no cap", large, false, 0, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := &fakeContract{evaluate: ledger(map[string]string{})}
+			h := limitBody(tt.max, newRouter(newTestHandler(contract)))
+
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				// Hide the length, as a chunked upload would, so that only
+				// reading the body finds it too large.
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest("POST", "/create-asset", body)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if tt.status == http.StatusRequestEntityTooLarge {
+				expectError(t, rec, tt.status, codePayloadTooLarge)
+				if n := contract.count("CreateAsset"); n != 0 {
+					t.Errorf("CreateAsset submitted %d times, want 0", n)
+				}
+			} else if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,602 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	mspclient "github.com/hyperledger/fabric-sdk-go/pkg/client/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	contextApi "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	mspctx "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
+	sdkcontext "github.com/hyperledger/fabric-sdk-go/pkg/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/txn"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+const (
+	codePreparedNotFound = "PREPARED_TRANSACTION_NOT_FOUND"
+	codeSignatureInvalid = "SIGNATURE_INVALID"
+
+	// maxPreparedTransactions caps the transactions waiting for a
+	// signature at once.
+	maxPreparedTransactions = 10000
+)
+
+// The stages of an offline-signed transaction, named after what the
+// client signs next.
+const (
+	stageProposal    = "proposal"
+	stageTransaction = "transaction"
+)
+
+// PrepareRequest is the body of POST /transactions/prepare: the chaincode
+// function to call and the identity that will sign the transaction, given
+// by its MSP id and PEM certificate.
+type PrepareRequest struct {
+	Function    string   `json:"function"`
+	Args        []string `json:"args"`
+	MSPID       string   `json:"msp_id"`
+	Certificate string   `json:"certificate"`
+}
+
+func (r PrepareRequest) fieldErrors() []FieldError {
+	errs := requireField(nil, "function", r.Function)
+	errs = requireField(errs, "msp_id", r.MSPID)
+	if _, err := parseSigningCertificate(r.Certificate); err != nil {
+		errs = append(errs, FieldError{Field: "certificate", Message: err.Error()})
+	}
+	return errs
+}
+
+// SignedSubmission is the body of POST /transactions/submit: the id of a
+// prepared transaction and the signature of the payload it was last
+// returned with.
+type SignedSubmission struct {
+	TransactionID string `json:"transaction_id"`
+	Signature     []byte `json:"signature"`
+}
+
+func (s SignedSubmission) fieldErrors() []FieldError {
+	errs := requireField(nil, "transaction_id", s.TransactionID)
+	if len(s.Signature) == 0 {
+		errs = append(errs, FieldError{Field: "signature", Message: "must be a base64-encoded ECDSA signature"})
+	}
+	return errs
+}
+
+// PreparedTransaction is what the client signs next. Digest is the SHA-256
+// digest of Payload, which is signed with the private key of the
+// certificate the transaction was prepared for. Stage is "proposal" for
+// the proposal the peers endorse and "transaction" for the endorsed
+// transaction the orderer orders.
+type PreparedTransaction struct {
+	TxID      string    `json:"txId"`
+	Stage     string    `json:"stage"`
+	Payload   []byte    `json:"payload"`
+	Digest    []byte    `json:"digest"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// offlineNetwork carries transactions signed outside the API: it has a
+// signed proposal endorsed, and a signed transaction ordered and
+// committed.
+type offlineNetwork interface {
+	endorse(ctx context.Context, channel, chaincode string, proposal *peer.SignedProposal) ([]*fab.TransactionProposalResponse, error)
+	commit(ctx context.Context, channel, txID string, envelope *fab.SignedEnvelope) error
+}
+
+// pendingTransaction is a transaction waiting for its client's signature.
+type pendingTransaction struct {
+	id          string
+	stage       string
+	channel     string
+	chaincode   string
+	certificate *x509.Certificate
+	proposal    *peer.Proposal
+	// payload is what the client signs next and result the chaincode's
+	// response once the proposal is endorsed.
+	payload []byte
+	result  []byte
+	expires time.Time
+}
+
+func (p *pendingTransaction) prepared() PreparedTransaction {
+	digest := sha256.Sum256(p.payload)
+	return PreparedTransaction{
+		TxID:      p.id,
+		Stage:     p.stage,
+		Payload:   p.payload,
+		Digest:    digest[:],
+		ExpiresAt: p.expires,
+	}
+}
+
+// offlineSigning keeps the transactions prepared by /transactions/prepare
+// until they are submitted or their ttl runs out.
+type offlineSigning struct {
+	network offlineNetwork
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pendingTransaction
+}
+
+func newOfflineSigning(network offlineNetwork, ttl time.Duration) *offlineSigning {
+	return &offlineSigning{network: network, ttl: ttl, pending: make(map[string]*pendingTransaction)}
+}
+
+// put keeps tx for another ttl. It returns false when too many
+// transactions are waiting for signatures.
+func (s *offlineSigning) put(tx *pendingTransaction) bool {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) >= maxPreparedTransactions {
+		for id, p := range s.pending {
+			if now.After(p.expires) {
+				delete(s.pending, id)
+			}
+		}
+		if len(s.pending) >= maxPreparedTransactions {
+			return false
+		}
+	}
+	tx.expires = now.Add(s.ttl)
+	s.pending[tx.id] = tx
+	return true
+}
+
+// get returns the transaction prepared as id, unless it has expired.
+func (s *offlineSigning) get(id string) (*pendingTransaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, ok := s.pending[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(tx.expires) {
+		delete(s.pending, tx.id)
+		return nil, false
+	}
+	return tx, true
+}
+
+// take removes tx so that it is submitted only once. It returns false
+// when another submission has already taken it.
+func (s *offlineSigning) take(tx *pendingTransaction) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[tx.id] != tx {
+		return false
+	}
+	delete(s.pending, tx.id)
+	return true
+}
+
+// parseSigningCertificate parses the PEM certificate of an identity that
+// signs its own transactions. Fabric only accepts ECDSA keys.
+func parseSigningCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("must be a PEM-encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("is not a valid certificate: %v", err)
+	}
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok {
+		return nil, errors.New("must hold an ECDSA public key")
+	}
+	return cert, nil
+}
+
+// verifySignature checks that signature is cert's ECDSA signature of
+// payload and returns it with a low S value, which is the only form
+// Fabric peers and orderers accept.
+func verifySignature(cert *x509.Certificate, payload, signature []byte) ([]byte, error) {
+	key := cert.PublicKey.(*ecdsa.PublicKey)
+	digest := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(key, digest[:], signature) {
+		return nil, errors.New("the signature does not verify against the prepared certificate")
+	}
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+		return nil, fmt.Errorf("the signature is not DER-encoded: %w", err)
+	}
+	halfOrder := new(big.Int).Rsh(key.Curve.Params().N, 1)
+	if sig.S.Cmp(halfOrder) <= 0 {
+		return signature, nil
+	}
+	sig.S.Sub(key.Curve.Params().N, sig.S)
+	return asn1.Marshal(sig)
+}
+
+// newProposal builds the proposal to call function with args on chaincode
+// as the identity creator. The transaction id is derived from a random
+// nonce and the creator, as Fabric requires.
+func newProposal(channel, chaincode string, creator []byte, function string, args []string) (*peer.Proposal, string, error) {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	txID := sha256.Sum256(append(append([]byte{}, nonce...), creator...))
+
+	chaincodeID := &peer.ChaincodeID{Name: chaincode}
+	extension, err := proto.Marshal(&peer.ChaincodeHeaderExtension{ChaincodeId: chaincodeID})
+	if err != nil {
+		return nil, "", err
+	}
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: channel,
+		TxId:      hex.EncodeToString(txID[:]),
+		Timestamp: ptypes.TimestampNow(),
+		Extension: extension,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	signatureHeader, err := proto.Marshal(&common.SignatureHeader{Creator: creator, Nonce: nonce})
+	if err != nil {
+		return nil, "", err
+	}
+	header, err := proto.Marshal(&common.Header{ChannelHeader: channelHeader, SignatureHeader: signatureHeader})
+	if err != nil {
+		return nil, "", err
+	}
+
+	input := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		input = append(input, []byte(arg))
+	}
+	spec, err := proto.Marshal(&peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		Type:        peer.ChaincodeSpec_GOLANG,
+		ChaincodeId: chaincodeID,
+		Input:       &peer.ChaincodeInput{Args: input},
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+	payload, err := proto.Marshal(&peer.ChaincodeProposalPayload{Input: spec})
+	if err != nil {
+		return nil, "", err
+	}
+	return &peer.Proposal{Header: header, Payload: payload}, hex.EncodeToString(txID[:]), nil
+}
+
+// endorsedTransaction assembles the transaction payload of proposal from
+// its endorsements and returns it with the chaincode's response.
+func endorsedTransaction(txID string, proposal *peer.Proposal, responses []*fab.TransactionProposalResponse) ([]byte, []byte, error) {
+	if len(responses) == 0 {
+		return nil, nil, errors.New("no peer endorsed the proposal")
+	}
+	for _, r := range responses {
+		if r.ProposalResponse == nil || r.ProposalResponse.Response == nil {
+			return nil, nil, fmt.Errorf("peer %s returned an empty response", r.Endorser)
+		}
+		if s := r.ProposalResponse.Response.Status; s < int32(common.Status_SUCCESS) || s >= int32(common.Status_BAD_REQUEST) {
+			return nil, nil, status.New(status.ChaincodeStatus, s, r.ProposalResponse.Response.Message, nil)
+		}
+	}
+	tx, err := txn.New(fab.TransactionRequest{
+		Proposal:          &fab.TransactionProposal{TxnID: fab.TransactionID(txID), Proposal: proposal},
+		ProposalResponses: responses,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := proto.Marshal(tx.Transaction)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := &common.Header{}
+	if err := proto.Unmarshal(proposal.Header, header); err != nil {
+		return nil, nil, err
+	}
+	payload, err := proto.Marshal(&common.Payload{Header: header, Data: data})
+	if err != nil {
+		return nil, nil, err
+	}
+	return payload, responses[0].ProposalResponse.Response.Payload, nil
+}
+
+// PrepareTransaction serves POST /transactions/prepare, the first step of a
+// transaction whose client keeps its private key to itself. It builds the
+// proposal to call function as the identity of the given certificate and
+// returns it to be signed and sent to POST /transactions/submit. As for
+// /invoke, the function must be listed in INVOKE_ALLOWED_FUNCTIONS.
+func (wh *walletHandler) PrepareTransaction(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	if wh.offline == nil {
+		writeError(w, http.StatusServiceUnavailable, withCode(codeGatewayUnavailable, errors.New("offline signing is not available")))
+		return
+	}
+
+	var prepare PrepareRequest
+	if !readJSON(w, req, &prepare) {
+		return
+	}
+	if !validate(w, prepare) {
+		return
+	}
+	if !wh.invokeAllowed[prepare.Function] {
+		writeError(w, http.StatusForbidden, withCode(codeForbidden, fmt.Errorf("function %s may not be invoked through /transactions/prepare", prepare.Function)))
+		return
+	}
+	cert, _ := parseSigningCertificate(prepare.Certificate)
+
+	channel, chaincode := wh.channelName, wh.chaincodeName
+	if name := channelFor(req.Context()); name != "" {
+		channel = name
+	}
+	if name := chaincodeFor(req.Context()); name != "" {
+		chaincode = name
+	}
+	tx, err := newPendingProposal(channel, chaincode, prepare, cert)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to build proposal: %w", err))
+		return
+	}
+	wh.keepPending(w, tx)
+}
+
+// newPendingProposal builds the proposal prepare asks for, to be signed
+// with the private key of cert.
+func newPendingProposal(channel, chaincode string, prepare PrepareRequest, cert *x509.Certificate) (*pendingTransaction, error) {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: prepare.MSPID, IdBytes: []byte(prepare.Certificate)})
+	if err != nil {
+		return nil, err
+	}
+	proposal, txID, err := newProposal(channel, chaincode, creator, prepare.Function, prepare.Args)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(proposal)
+	if err != nil {
+		return nil, err
+	}
+	return &pendingTransaction{
+		id:          txID,
+		stage:       stageProposal,
+		channel:     channel,
+		chaincode:   chaincode,
+		certificate: cert,
+		proposal:    proposal,
+		payload:     payload,
+	}, nil
+}
+
+// keepPending stores tx until it is signed and responds with what to sign.
+func (wh *walletHandler) keepPending(w http.ResponseWriter, tx *pendingTransaction) {
+	if !wh.offline.put(tx) {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("%d transactions are already waiting for signatures", maxPreparedTransactions))
+		return
+	}
+	writeData(w, http.StatusOK, tx.prepared())
+}
+
+// SubmitSignedTransaction serves POST /transactions/submit, which takes the
+// signature of a prepared transaction's payload. A signed proposal is sent
+// to the endorsing peers and the endorsed transaction is returned to be
+// signed in turn. A signed transaction is sent to the orderer and, as for
+// other submissions, the response waits for its commit. A signature the
+// prepared certificate does not verify is refused with 400 and leaves the
+// transaction waiting.
+func (wh *walletHandler) SubmitSignedTransaction(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	if wh.offline == nil {
+		writeError(w, http.StatusServiceUnavailable, withCode(codeGatewayUnavailable, errors.New("offline signing is not available")))
+		return
+	}
+
+	var submission SignedSubmission
+	if !readJSON(w, req, &submission) {
+		return
+	}
+	if !validate(w, submission) {
+		return
+	}
+	notFound := withCode(codePreparedNotFound, fmt.Errorf("transaction %s was not prepared or has expired", submission.TransactionID))
+	tx, ok := wh.offline.get(submission.TransactionID)
+	if !ok {
+		writeError(w, http.StatusNotFound, notFound)
+		return
+	}
+	signature, err := verifySignature(tx.certificate, tx.payload, submission.Signature)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, withCode(codeSignatureInvalid, err))
+		return
+	}
+	if !wh.offline.take(tx) {
+		writeError(w, http.StatusNotFound, notFound)
+		return
+	}
+
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	if tx.stage == stageProposal {
+		responses, err := wh.offline.network.endorse(ctx, tx.channel, tx.chaincode, &peer.SignedProposal{ProposalBytes: tx.payload, Signature: signature})
+		if err != nil {
+			writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to endorse transaction: %w", err))
+			return
+		}
+		payload, result, err := endorsedTransaction(tx.id, tx.proposal, responses)
+		if err != nil {
+			writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to endorse transaction: %w", err))
+			return
+		}
+		// A copy, since a concurrent submission may still be reading tx.
+		endorsed := *tx
+		endorsed.stage, endorsed.payload, endorsed.result = stageTransaction, payload, result
+		wh.keepPending(w, &endorsed)
+		return
+	}
+
+	if err := wh.offline.network.commit(ctx, tx.channel, tx.id, &fab.SignedEnvelope{Payload: tx.payload, Signature: signature}); err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+	writeTxResult(w, http.StatusOK, tx.id, chaincodeData(tx.result))
+}
+
+// sdkOfflineNetwork sends offline-signed transactions through an SDK
+// instance of its own. The SDK needs an identity to open connections and
+// read the channel configuration; it is given the wallet user's, which
+// never signs the transactions it carries.
+type sdkOfflineNetwork struct {
+	sdk    *fabsdk.FabricSDK
+	signer mspctx.SigningIdentity
+}
+
+// newSDKOfflineNetwork connects to the network of the connection profile
+// at ccpPath as the wallet identity label.
+func newSDKOfflineNetwork(ccpPath string, wallet identityWallet, label string) (*sdkOfflineNetwork, error) {
+	id, err := wallet.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity %s: %w", label, err)
+	}
+	x509ID, ok := id.(*gateway.X509Identity)
+	if !ok {
+		return nil, fmt.Errorf("identity %s is not an X.509 identity", label)
+	}
+	sdk, err := fabsdk.New(config.FromFile(filepath.Clean(ccpPath)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SDK: %w", err)
+	}
+	client, err := mspclient.New(sdk.Context())
+	if err != nil {
+		sdk.Close()
+		return nil, fmt.Errorf("failed to create MSP client: %w", err)
+	}
+	signer, err := client.CreateSigningIdentity(mspctx.WithCert([]byte(x509ID.Certificate())), mspctx.WithPrivateKey([]byte(x509ID.Key())))
+	if err != nil {
+		sdk.Close()
+		return nil, fmt.Errorf("failed to load identity %s: %w", label, err)
+	}
+	return &sdkOfflineNetwork{sdk: sdk, signer: signer}, nil
+}
+
+func (n *sdkOfflineNetwork) close() {
+	n.sdk.Close()
+}
+
+func (n *sdkOfflineNetwork) channel(name string) (contextApi.Channel, error) {
+	return n.sdk.ChannelContext(name, fabsdk.WithIdentity(n.signer))()
+}
+
+// endorse sends proposal to the peers the channel's endorsement policy
+// for chaincode selects.
+func (n *sdkOfflineNetwork) endorse(ctx context.Context, channel, chaincode string, proposal *peer.SignedProposal) ([]*fab.TransactionProposalResponse, error) {
+	chCtx, err := n.channel(channel)
+	if err != nil {
+		return nil, err
+	}
+	selection, err := chCtx.ChannelService().Selection()
+	if err != nil {
+		return nil, err
+	}
+	peers, err := selection.GetEndorsersForChaincode([]*fab.ChaincodeCall{{ID: chaincode}})
+	if err != nil {
+		return nil, err
+	}
+
+	reqCtx, cancel := sdkcontext.NewRequest(chCtx, sdkcontext.WithParent(ctx))
+	defer cancel()
+	responses := make([]*fab.TransactionProposalResponse, 0, len(peers))
+	for _, p := range peers {
+		response, err := p.ProcessTransactionProposal(reqCtx, fab.ProcessProposalRequest{SignedProposal: proposal})
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// commit sends envelope to the channel's orderer and waits for the peers
+// to commit the transaction txID.
+func (n *sdkOfflineNetwork) commit(ctx context.Context, channel, txID string, envelope *fab.SignedEnvelope) error {
+	chCtx, err := n.channel(channel)
+	if err != nil {
+		return err
+	}
+	orderer, err := channelOrderer(chCtx)
+	if err != nil {
+		return err
+	}
+	events, err := chCtx.ChannelService().EventService()
+	if err != nil {
+		return err
+	}
+	// Register first so that the commit cannot be missed.
+	reg, statuses, err := events.RegisterTxStatusEvent(txID)
+	if err != nil {
+		return err
+	}
+	defer events.Unregister(reg)
+
+	reqCtx, cancel := sdkcontext.NewRequest(chCtx, sdkcontext.WithParent(ctx))
+	defer cancel()
+	if _, err := orderer.SendBroadcast(reqCtx, envelope); err != nil {
+		return err
+	}
+	select {
+	case event := <-statuses:
+		if event.TxValidationCode != peer.TxValidationCode_VALID {
+			return status.New(status.EventServerStatus, int32(event.TxValidationCode), fmt.Sprintf("transaction %s was invalidated", txID), nil)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// channelOrderer connects to the first of the channel's orderers that the
+// connection profile describes.
+func channelOrderer(chCtx contextApi.Channel) (fab.Orderer, error) {
+	cfg, err := chCtx.ChannelService().ChannelConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range cfg.Orderers() {
+		ordererCfg, found, ignore := chCtx.EndpointConfig().OrdererConfig(address)
+		if found && !ignore {
+			return chCtx.InfraProvider().CreateOrdererFromConfig(ordererCfg)
+		}
+	}
+	return nil, fmt.Errorf("no orderer of channel %s is in the connection profile", chCtx.ChannelID())
+}
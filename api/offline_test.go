@@ -0,0 +1,266 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// fakeOfflineNetwork endorses every proposal with a fixed response and
+// records what it was sent.
+type fakeOfflineNetwork struct {
+	response  *peer.Response
+	commitErr error
+
+	mu        sync.Mutex
+	proposals []*peer.SignedProposal
+	envelopes []*fab.SignedEnvelope
+}
+
+func (n *fakeOfflineNetwork) endorse(ctx context.Context, channel, chaincode string, proposal *peer.SignedProposal) ([]*fab.TransactionProposalResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.proposals = append(n.proposals, proposal)
+	return []*fab.TransactionProposalResponse{{
+		Endorser: "peer0.org1.example.com",
+		ProposalResponse: &peer.ProposalResponse{
+			Response:    n.response,
+			Payload:     []byte("response payload"),
+			Endorsement: &peer.Endorsement{Endorser: []byte("peer0"), Signature: []byte("endorsement")},
+		},
+	}}, nil
+}
+
+func (n *fakeOfflineNetwork) commit(ctx context.Context, channel, txID string, envelope *fab.SignedEnvelope) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.envelopes = append(n.envelopes, envelope)
+	return n.commitErr
+}
+
+// newSigner returns an ECDSA key and a self-signed PEM certificate for it.
+func newSigner(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "offline-user"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func newOfflineHandler(network offlineNetwork, ttl time.Duration) *walletHandler {
+	wh := newTestHandler(&fakeContract{})
+	wh.invokeAllowed = map[string]bool{"TransferAsset": true}
+	wh.offline = newOfflineSigning(network, ttl)
+	return wh
+}
+
+func prepareBody(function, certPEM string) string {
+	body, _ := json.Marshal(PrepareRequest{Function: function, Args: []string{"asset1", "Max"}, MSPID: "Org1MSP", Certificate: certPEM})
+	return string(body)
+}
+
+func submitBody(txID string, signature []byte) string {
+	body, _ := json.Marshal(SignedSubmission{TransactionID: txID, Signature: signature})
+	return string(body)
+}
+
+// prepared decodes the PreparedTransaction of a successful response.
+func prepared(t *testing.T, rec *httptest.ResponseRecorder, stage string) PreparedTransaction {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var tx PreparedTransaction
+	if err := json.Unmarshal(decodeResponse(t, rec).Data, &tx); err != nil {
+		t.Fatalf("data is not a PreparedTransaction: %v: %s", err, rec.Body)
+	}
+	if tx.Stage != stage {
+		t.Fatalf("stage = %q, want %q", tx.Stage, stage)
+	}
+	if digest := sha256.Sum256(tx.Payload); !bytes.Equal(tx.Digest, digest[:]) {
+		t.Errorf("digest is not the SHA-256 digest of the payload")
+	}
+	return tx
+}
+
+// TestOfflineSigning takes a transaction through both signatures and
+// checks that the network is sent the client's signatures over the
+// payloads it was given.
+func TestOfflineSigning(t *testing.T) {
+	key, certPEM := newSigner(t)
+	network := &fakeOfflineNetwork{response: &peer.Response{Status: 200, Payload: []byte(`{"owner":"Max"}`)}}
+	h := newRouter(newOfflineHandler(network, time.Minute))
+
+	proposal := prepared(t, serve(h, "POST", "/transactions/prepare", prepareBody("TransferAsset", certPEM)), stageProposal)
+	proposalSig := sign(t, key, proposal.Payload)
+	tx := prepared(t, serve(h, "POST", "/transactions/submit", submitBody(proposal.TxID, proposalSig)), stageTransaction)
+	if tx.TxID != proposal.TxID {
+		t.Errorf("txId = %q after endorsement, want %q", tx.TxID, proposal.TxID)
+	}
+	if len(network.proposals) != 1 || !bytes.Equal(network.proposals[0].ProposalBytes, proposal.Payload) {
+		t.Fatalf("endorsed %d proposals, want the prepared one", len(network.proposals))
+	}
+
+	rec := serve(h, "POST", "/transactions/submit", submitBody(tx.TxID, sign(t, key, tx.Payload)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var result struct {
+		TxID   string          `json:"txId"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(decodeResponse(t, rec).Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.TxID != tx.TxID || string(result.Result) != `{"owner":"Max"}` {
+		t.Errorf("result = %s, want the txId and the chaincode's response", rec.Body)
+	}
+	if len(network.envelopes) != 1 || !bytes.Equal(network.envelopes[0].Payload, tx.Payload) {
+		t.Fatalf("committed %d envelopes, want the endorsed transaction", len(network.envelopes))
+	}
+
+	// A transaction is submitted once.
+	expectError(t, serve(h, "POST", "/transactions/submit", submitBody(tx.TxID, sign(t, key, tx.Payload))), http.StatusNotFound, codePreparedNotFound)
+}
+
+func TestOfflineSigningFailures(t *testing.T) {
+	key, certPEM := newSigner(t)
+	otherKey, _ := newSigner(t)
+	ok := &peer.Response{Status: 200}
+
+	t.Run("function not allowed", func(t *testing.T) {
+		h := newRouter(newOfflineHandler(&fakeOfflineNetwork{response: ok}, time.Minute))
+		expectError(t, serve(h, "POST", "/transactions/prepare", prepareBody("DeleteAsset", certPEM)), http.StatusForbidden, codeForbidden)
+	})
+	t.Run("not a certificate", func(t *testing.T) {
+		h := newRouter(newOfflineHandler(&fakeOfflineNetwork{response: ok}, time.Minute))
+		resp := expectError(t, serve(h, "POST", "/transactions/prepare", prepareBody("TransferAsset", "cert")), http.StatusBadRequest, codeValidationFailed)
+		if len(resp.Errors) != 1 || resp.Errors[0].Field != "certificate" {
+			t.Errorf("errors = %v, want the certificate", resp.Errors)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		wh := newOfflineHandler(nil, time.Minute)
+		wh.offline = nil
+		expectError(t, serve(newRouter(wh), "POST", "/transactions/prepare", prepareBody("TransferAsset", certPEM)), http.StatusServiceUnavailable, codeGatewayUnavailable)
+	})
+	t.Run("unknown transaction", func(t *testing.T) {
+		h := newRouter(newOfflineHandler(&fakeOfflineNetwork{response: ok}, time.Minute))
+		expectError(t, serve(h, "POST", "/transactions/submit", submitBody("0123", []byte("sig"))), http.StatusNotFound, codePreparedNotFound)
+	})
+	t.Run("expired", func(t *testing.T) {
+		h := newRouter(newOfflineHandler(&fakeOfflineNetwork{response: ok}, time.Millisecond))
+		proposal := prepared(t, serve(h, "POST", "/transactions/prepare", prepareBody("TransferAsset", certPEM)), stageProposal)
+		time.Sleep(5 * time.Millisecond)
+		expectError(t, serve(h, "POST", "/transactions/submit", submitBody(proposal.TxID, sign(t, key, proposal.Payload))), http.StatusNotFound, codePreparedNotFound)
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		network := &fakeOfflineNetwork{response: ok}
+		h := newRouter(newOfflineHandler(network, time.Minute))
+		proposal := prepared(t, serve(h, "POST", "/transactions/prepare", prepareBody("TransferAsset", certPEM)), stageProposal)
+		expectError(t, serve(h, "POST", "/transactions/submit", submitBody(proposal.TxID, sign(t, otherKey, proposal.Payload))), http.StatusBadRequest, codeSignatureInvalid)
+		if len(network.proposals) != 0 {
+			t.Fatal("a proposal with a bad signature was sent for endorsement")
+		}
+		// The transaction is still waiting for the right signature.
+		prepared(t, serve(h, "POST", "/transactions/submit", submitBody(proposal.TxID, sign(t, key, proposal.Payload))), stageTransaction)
+	})
+	t.Run("chaincode error", func(t *testing.T) {
+		network := &fakeOfflineNetwork{response: &peer.Response{Status: 500, Message: "the asset asset1 does not exist"}}
+		h := newRouter(newOfflineHandler(network, time.Minute))
+		proposal := prepared(t, serve(h, "POST", "/transactions/prepare", prepareBody("TransferAsset", certPEM)), stageProposal)
+		expectError(t, serve(h, "POST", "/transactions/submit", submitBody(proposal.TxID, sign(t, key, proposal.Payload))), http.StatusBadRequest, codeChaincodeError)
+	})
+	t.Run("invalidated", func(t *testing.T) {
+		network := &fakeOfflineNetwork{response: ok, commitErr: errMVCCConflict}
+		h := newRouter(newOfflineHandler(network, time.Minute))
+		proposal := prepared(t, serve(h, "POST", "/transactions/prepare", prepareBody("TransferAsset", certPEM)), stageProposal)
+		tx := prepared(t, serve(h, "POST", "/transactions/submit", submitBody(proposal.TxID, sign(t, key, proposal.Payload))), stageTransaction)
+		rec := serve(h, "POST", "/transactions/submit", submitBody(tx.TxID, sign(t, key, tx.Payload)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusUnprocessableEntity, rec.Body)
+		}
+	})
+}
+
+// TestVerifySignatureLowS checks that a valid signature with a high S
+// value is accepted and passed on in the low-S form Fabric requires.
+func TestVerifySignatureLowS(t *testing.T) {
+	key, certPEM := newSigner(t)
+	cert, err := parseSigningCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("payload")
+
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sign(t, key, payload), &sig); err != nil {
+		t.Fatal(err)
+	}
+	n := key.Curve.Params().N
+	low, high := new(big.Int).Set(sig.S), new(big.Int).Sub(n, sig.S)
+	if low.Cmp(high) > 0 {
+		low, high = high, low
+	}
+	lowSig, _ := asn1.Marshal(struct{ R, S *big.Int }{sig.R, low})
+	highSig, _ := asn1.Marshal(struct{ R, S *big.Int }{sig.R, high})
+
+	for name, signature := range map[string][]byte{"low S": lowSig, "high S": highSig} {
+		t.Run(name, func(t *testing.T) {
+			got, err := verifySignature(cert, payload, signature)
+			if err != nil {
+				t.Fatalf("verifySignature: %v", err)
+			}
+			if !bytes.Equal(got, lowSig) {
+				t.Errorf("signature = %x, want the low-S form %x", got, lowSig)
+			}
+		})
+	}
+	if _, err := verifySignature(cert, []byte("other payload"), lowSig); err == nil {
+		t.Error("a signature of another payload verified")
+	}
+}
@@ -0,0 +1,444 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openAPIDocument describes every route of the API. It is served as is at
+// /openapi.json and drives validateRequests.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// swaggerPage is a Swagger UI page for openAPIDocument. The UI itself is
+// loaded from a CDN, so the page needs the browser to be online.
+//
+//go:embed swagger.html
+var swaggerPage []byte
+
+// openAPISpec is the part of an OpenAPI 3 document that request
+// validation needs.
+type openAPISpec struct {
+	Paths      map[string]openAPIPath `json:"paths"`
+	Components struct {
+		Schemas    map[string]*jsonSchema       `json:"schemas"`
+		Parameters map[string]*openAPIParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// openAPIPath holds a path's operations by lower-case method, plus the
+// "parameters" shared by all of them.
+type openAPIPath map[string]json.RawMessage
+
+type openAPIOperation struct {
+	Parameters  []*openAPIParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *jsonSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type openAPIParameter struct {
+	Ref      string      `json:"$ref"`
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Schema   *jsonSchema `json:"schema"`
+}
+
+// jsonSchema is the subset of JSON Schema used by openapi.json. A schema
+// with no type accepts any value.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	MinLength            *int                   `json:"minLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Minimum              *float64               `json:"minimum"`
+}
+
+// openAPIRoute is one operation of the document, ready to match requests.
+type openAPIRoute struct {
+	method     string
+	segments   []string
+	parameters []*openAPIParameter
+	body       *jsonSchema
+	bodyNeeded bool
+}
+
+// requestValidator checks requests against the routes of the document.
+type requestValidator struct {
+	spec   *openAPISpec
+	routes []openAPIRoute
+}
+
+func newRequestValidator(document []byte) (*requestValidator, error) {
+	v := &requestValidator{spec: &openAPISpec{}}
+	if err := json.Unmarshal(document, v.spec); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	for path, item := range v.spec.Paths {
+		var shared []*openAPIParameter
+		if raw, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("invalid parameters of %s: %w", path, err)
+			}
+		}
+		for method, raw := range item {
+			if method == "parameters" || method == "summary" || method == "description" {
+				continue
+			}
+			var op openAPIOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", method, path, err)
+			}
+			route := openAPIRoute{
+				method:   strings.ToUpper(method),
+				segments: strings.Split(strings.Trim(path, "/"), "/"),
+			}
+			for _, p := range append(append([]*openAPIParameter{}, shared...), op.Parameters...) {
+				resolved, err := v.parameter(p)
+				if err != nil {
+					return nil, err
+				}
+				route.parameters = append(route.parameters, resolved)
+			}
+			if op.RequestBody != nil {
+				if content, ok := op.RequestBody.Content["application/json"]; ok {
+					route.body = content.Schema
+					route.bodyNeeded = op.RequestBody.Required
+				}
+			}
+			v.routes = append(v.routes, route)
+		}
+	}
+
+	// Routes with more literal segments are tried first, so that
+	// /assets/bulk wins over /assets/{id}.
+	sort.SliceStable(v.routes, func(i, j int) bool {
+		return literalSegments(v.routes[i].segments) > literalSegments(v.routes[j].segments)
+	})
+	return v, nil
+}
+
+func literalSegments(segments []string) int {
+	n := 0
+	for _, s := range segments {
+		if !strings.HasPrefix(s, "{") {
+			n++
+		}
+	}
+	return n
+}
+
+// parameter resolves a reference to components/parameters.
+func (v *requestValidator) parameter(p *openAPIParameter) (*openAPIParameter, error) {
+	if p.Ref == "" {
+		return p, nil
+	}
+	name := strings.TrimPrefix(p.Ref, "#/components/parameters/")
+	if resolved, ok := v.spec.Components.Parameters[name]; ok {
+		return resolved, nil
+	}
+	return nil, fmt.Errorf("unresolved parameter reference %s", p.Ref)
+}
+
+// route finds the operation for req. It reports false for requests the
+// document does not describe, which are left for the router to refuse.
+// Routes scoped to a channel are matched without their /channels/{channel}
+// prefix.
+func (v *requestValidator) route(req *http.Request) (openAPIRoute, bool) {
+	segments := strings.Split(strings.Trim(req.URL.EscapedPath(), "/"), "/")
+	if len(segments) > 2 && segments[0] == "channels" {
+		segments = segments[2:]
+	}
+	for _, route := range v.routes {
+		if route.method != req.Method || len(route.segments) != len(segments) {
+			continue
+		}
+		match := true
+		for i, s := range route.segments {
+			if !strings.HasPrefix(s, "{") && s != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return route, true
+		}
+	}
+	return openAPIRoute{}, false
+}
+
+// validate returns the problems with req's query parameters and JSON body.
+// The body is read and replaced so that the handler can still read it.
+func (v *requestValidator) validate(req *http.Request) ([]FieldError, error) {
+	route, ok := v.route(req)
+	if !ok {
+		return nil, nil
+	}
+
+	var errs []FieldError
+	query := req.URL.Query()
+	for _, p := range route.parameters {
+		if p.In != "query" {
+			continue
+		}
+		value, present := query[p.Name]
+		if !present {
+			if p.Required {
+				errs = append(errs, FieldError{Field: p.Name, Message: "query parameter is required"})
+			}
+			continue
+		}
+		errs = append(errs, v.checkParameter(p, value[0])...)
+	}
+
+	if route.body == nil || !isJSONRequest(req) {
+		return errs, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	if len(bytes.TrimSpace(data)) == 0 {
+		if route.bodyNeeded {
+			errs = append(errs, FieldError{Field: "body", Message: "request body is required"})
+		}
+		return errs, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var body interface{}
+	if err := dec.Decode(&body); err != nil {
+		// readJSON reports malformed JSON in the handler.
+		return errs, nil
+	}
+	return append(errs, v.check(route.body, body, "")...), nil
+}
+
+// isJSONRequest reports whether req declares a JSON body, or none at all,
+// which older clients rely on.
+func isJSONRequest(req *http.Request) bool {
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+func (v *requestValidator) checkParameter(p *openAPIParameter, value string) []FieldError {
+	if p.Schema == nil {
+		return nil
+	}
+	var decoded interface{} = value
+	switch p.Schema.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return []FieldError{{Field: p.Name, Message: "must be an integer"}}
+		}
+		decoded = json.Number(value)
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return []FieldError{{Field: p.Name, Message: "must be true or false"}}
+		}
+		decoded = b
+	}
+	return v.check(p.Schema, decoded, p.Name)
+}
+
+// check validates value, decoded with json.Number for numbers, against
+// schema. field is the dotted path of value, used in the errors.
+func (v *requestValidator) check(schema *jsonSchema, value interface{}, field string) []FieldError {
+	if schema.Ref != "" {
+		resolved, ok := v.spec.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			slog.Error("unresolved schema reference in the OpenAPI document", "ref", schema.Ref)
+			return nil
+		}
+		schema = resolved
+	}
+	name := field
+	if name == "" {
+		name = "body"
+	}
+	fail := func(format string, args ...interface{}) []FieldError {
+		return []FieldError{{Field: name, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		return fail("must be one of %s", enumList(schema.Enum))
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		if schema.MinLength != nil && len(s) < *schema.MinLength {
+			return fail("must not be empty")
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fail("must be a number")
+		}
+		f, err := n.Float64()
+		if err != nil || (schema.Type == "integer" && strings.ContainsAny(n.String(), ".eE")) {
+			return fail("must be an integer")
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return fail("must be at least %v", *schema.Minimum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be true or false")
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			return fail("must have at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			return fail("must have at most %d items", *schema.MaxItems)
+		}
+		var errs []FieldError
+		if schema.Items != nil {
+			for i, item := range items {
+				errs = append(errs, v.check(schema.Items, item, joinField(field, strconv.Itoa(i)))...)
+			}
+		}
+		return errs
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		var errs []FieldError
+		for _, required := range schema.Required {
+			if _, ok := object[required]; !ok {
+				errs = append(errs, FieldError{Field: joinField(field, required), Message: "is required"})
+			}
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property, ok := schema.Properties[key]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					errs = append(errs, FieldError{Field: joinField(field, key), Message: "is not a known field"})
+				}
+				continue
+			}
+			errs = append(errs, v.check(property, object[key], joinField(field, key))...)
+		}
+		return errs
+	}
+	return nil
+}
+
+func joinField(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "." + child
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, allowed := range enum {
+		values[i] = fmt.Sprint(allowed)
+	}
+	return strings.Join(values, ", ")
+}
+
+// validateRequests refuses requests whose parameters or JSON body do not
+// match the OpenAPI document, answering 400 with every problem found. A
+// nil validator lets every request through.
+func (v *requestValidator) validateRequests(next http.HandlerFunc) http.HandlerFunc {
+	if v == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		errs, err := v.validate(req)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, bodyTooLargeError(tooLarge.Limit))
+				return
+			}
+			writeError(w, http.StatusBadRequest, fmt.Errorf("error reading request body: %w", err))
+			return
+		}
+		if len(errs) > 0 {
+			writeFieldErrors(w, "request does not match the API specification", errs)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// OpenAPI serves GET /openapi.json.
+func OpenAPI(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		methodNotAllowed(w, req, "GET")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+// Swagger serves GET /swagger, a browsable view of /openapi.json.
+func Swagger(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		methodNotAllowed(w, req, "GET")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(swaggerPage)
+}
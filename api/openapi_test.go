@@ -0,0 +1,171 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newValidatingHandler is newTestHandler with requests checked against
+// the OpenAPI document.
+func newValidatingHandler(t *testing.T, contract ContractInvoker) *walletHandler {
+	t.Helper()
+	wh := newTestHandler(contract)
+	validator, err := newRequestValidator(openAPIDocument)
+	if err != nil {
+		t.Fatalf("newRequestValidator: %v", err)
+	}
+	wh.validator = validator
+	return wh
+}
+
+// TestContentType sends a create with each kind of Content-Type. JSON, or
+// no Content-Type at all, is decoded; anything else is refused with 415
+// before the body is read.
+func TestContentType(t *testing.T) {
+	form := "asset_id=asset9&owner=Tomoko&colour=blue&size=5&appraised_value=300"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"json", "application/json", createBody, http.StatusCreated, ""},
+		{"json with charset", "application/json; charset=utf-8", createBody, http.StatusCreated, ""},
+		{"absent", "", createBody, http.StatusCreated, ""},
+		{"form", "application/x-www-form-urlencoded", form, http.StatusUnsupportedMediaType, codeUnsupportedMediaType},
+		{"text", "text/plain", createBody, http.StatusUnsupportedMediaType, codeUnsupportedMediaType},
+		{"malformed", "application/", createBody, http.StatusUnsupportedMediaType, codeUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := &fakeContract{evaluate: ledger(map[string]string{})}
+			h := newRouter(newValidatingHandler(t, contract))
+
+			req := httptest.NewRequest("POST", "/create-asset", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if tt.code != "" {
+				expectError(t, rec, tt.status, tt.code)
+				if n := contract.count("CreateAsset"); n != 0 {
+					t.Errorf("CreateAsset submitted %d times, want 0", n)
+				}
+				return
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if n := contract.count("CreateAsset"); n != 1 {
+				t.Errorf("CreateAsset submitted %d times, want 1", n)
+			}
+		})
+	}
+}
+
+// TestValidationAfterAuth checks that a request without credentials is
+// refused with 401 however wrong its body is, and that an authorized one
+// then gets the validation errors.
+func TestValidationAfterAuth(t *testing.T) {
+	wh := newValidatingHandler(t, &fakeContract{evaluate: ledger(map[string]string{})})
+	wh.auth = &apiKeyAuth{keys: [][]byte{[]byte("secret")}}
+	h := newRouter(wh)
+
+	body := `{"asset_id":7,"colour":["blue"]}`
+	expectError(t, serve(h, "POST", "/create-asset", body), http.StatusUnauthorized, codeUnauthorized)
+
+	resp := expectError(t, serve(h, "POST", "/create-asset", body, apiKeyHeader, "secret"), http.StatusBadRequest, codeValidationFailed)
+	if len(resp.Errors) == 0 {
+		t.Error("want the invalid fields listed")
+	}
+}
+
+// routePatterns returns the patterns newRouter registers, read from the
+// mux.Handle and mux.HandleFunc calls in router.go.
+func routePatterns(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "router.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patterns []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Handle" && sel.Sel.Name != "HandleFunc") {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			pattern, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patterns = append(patterns, pattern)
+		}
+		return true
+	})
+	if len(patterns) == 0 {
+		t.Fatal("found no routes in router.go")
+	}
+	return patterns
+}
+
+// TestRoutesInSpec fails when a route is registered in newRouter but not
+// described by openapi.json, or described but not registered. A prefix
+// route such as /assets/ is described by the paths below it that the
+// router sends to it.
+func TestRoutesInSpec(t *testing.T) {
+	var spec openAPISpec
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		t.Fatal(err)
+	}
+	mux := newRouter(newTestHandler(&fakeContract{}))
+
+	// routed maps each pattern to the document paths the router sends to
+	// it, with every path parameter filled in.
+	routed := make(map[string][]string)
+	for path := range spec.Paths {
+		segments := strings.Split(path, "/")
+		for i, s := range segments {
+			if strings.HasPrefix(s, "{") {
+				segments[i] = "x"
+			}
+		}
+		_, pattern := mux.Handler(httptest.NewRequest("GET", strings.Join(segments, "/"), nil))
+		if pattern == "" {
+			t.Errorf("%s is in openapi.json but no route serves it", path)
+			continue
+		}
+		routed[pattern] = append(routed[pattern], path)
+	}
+
+	for _, pattern := range routePatterns(t) {
+		if pattern == "/channels/" {
+			// It serves the other routes under a channel, which the
+			// document's description covers.
+			continue
+		}
+		if len(routed[pattern]) == 0 {
+			t.Errorf("route %s is registered in newRouter but missing from openapi.json", pattern)
+		}
+	}
+}
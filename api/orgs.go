@@ -0,0 +1,159 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// orgHeader selects the organization a request's transactions are signed
+// and endorsed as, when the API serves more than one.
+const (
+	orgHeader = "X-Fabric-Org"
+
+	codeOrgNotFound = "ORG_NOT_FOUND"
+)
+
+// fabricOrg is an organization requests may select with X-Fabric-Org: its
+// own connection profile and wallet, and the gateway connections opened
+// through them.
+type fabricOrg struct {
+	cfg        *appConfig
+	wallet     identityWallet
+	identities *identityPool
+}
+
+// orgRegistry maps organization names to their connections.
+type orgRegistry map[string]*fabricOrg
+
+// orgEntry is one organization of the ORGS_FILE.
+type orgEntry struct {
+	ConnectionProfile string `json:"connectionProfile"`
+	WalletPath        string `json:"walletPath"`
+	WalletUser        string `json:"walletUser"`
+}
+
+// loadOrgRegistry reads a JSON object of organization names to their
+// connection profile, wallet directory and wallet user, such as
+// {"org2": {"connectionProfile": "connection/connection-org2.yaml",
+// "walletPath": "wallet-org2", "walletUser": "appUser"}}, and checks that
+// every wallet holds its user. The organizations share cfg's channel,
+// chaincodes and timeouts, and connect on first use.
+func loadOrgRegistry(path string, cfg *appConfig) (orgRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read organizations file: %w", err)
+	}
+	var entries map[string]orgEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("organizations file %s is not a JSON object of organizations: %w", path, err)
+	}
+
+	orgs := make(orgRegistry, len(entries))
+	for name, entry := range entries {
+		if name == "" || entry.ConnectionProfile == "" || entry.WalletPath == "" || entry.WalletUser == "" {
+			return nil, fmt.Errorf("organizations file %s: every organization needs a name, connectionProfile, walletPath and walletUser", path)
+		}
+		if _, err := os.Stat(entry.ConnectionProfile); err != nil {
+			return nil, fmt.Errorf("organization %q: %w", name, err)
+		}
+		wallet, err := gateway.NewFileSystemWallet(entry.WalletPath)
+		if err != nil {
+			return nil, fmt.Errorf("organization %q: failed to open wallet: %w", name, err)
+		}
+		if !wallet.Exists(entry.WalletUser) {
+			return nil, fmt.Errorf("organization %q: %q is not in wallet %s", name, entry.WalletUser, entry.WalletPath)
+		}
+
+		orgCfg := *cfg
+		orgCfg.CCPPath = entry.ConnectionProfile
+		orgCfg.WalletPath = entry.WalletPath
+		orgCfg.WalletUser = entry.WalletUser
+		client, err := newFabricClient(&orgCfg, wallet)
+		if err != nil {
+			return nil, fmt.Errorf("organization %q: %w", name, err)
+		}
+		orgs[name] = &fabricOrg{
+			cfg:        &orgCfg,
+			wallet:     wallet,
+			identities: newIdentityPool(&orgCfg, client),
+		}
+	}
+	return orgs, nil
+}
+
+func (r orgRegistry) close() {
+	for _, org := range r {
+		org.identities.close()
+	}
+}
+
+type orgKey struct{}
+
+// orgFor returns the organization withIdentity selected for the request,
+// or "" for the one the API was started as.
+func orgFor(ctx context.Context) string {
+	org, _ := ctx.Value(orgKey{}).(string)
+	return org
+}
+
+// identitiesFor returns the connections of the organization the request
+// selected.
+func (wh *walletHandler) identitiesFor(ctx context.Context) *identityPool {
+	if org, ok := wh.orgs[orgFor(ctx)]; ok {
+		return org.identities
+	}
+	return wh.identities
+}
+
+// selectOrgContract binds ctx to the contract of chaincode signed as label
+// in organization name, on the channel channelScoped selected, where an
+// empty label means the organization's wallet user. Unknown organizations
+// are refused with 400.
+func (wh *walletHandler) selectOrgContract(ctx context.Context, name, label, chaincode string) (context.Context, int, error) {
+	org, ok := wh.orgs[name]
+	if !ok {
+		return nil, http.StatusBadRequest, withCode(codeOrgNotFound, fmt.Errorf("organization %q is not served by this API", name))
+	}
+	if label == "" {
+		label = org.cfg.WalletUser
+	} else if !org.wallet.Exists(label) {
+		status, err := refuseIdentity(ctx, label, fmt.Errorf("not in the wallet of %s", name))
+		return nil, status, err
+	}
+	if chaincode == wh.chaincodeName {
+		chaincode = ""
+	}
+	if chaincode != "" && !wh.chaincodes[chaincode] {
+		return nil, http.StatusNotFound, withCode(codeChaincodeNotFound, fmt.Errorf("chaincode %q is not served by this API", chaincode))
+	}
+	if chaincode != "" {
+		ctx = context.WithValue(ctx, chaincodeKey{}, chaincode)
+	} else {
+		chaincode = wh.chaincodeName
+	}
+
+	channel := channelFor(ctx)
+	if channel == "" {
+		channel = wh.channelName
+	}
+
+	contract, err := org.identities.contractOn(label, channel, chaincode)
+	if err != nil {
+		status, err := refuseIdentity(ctx, label, err)
+		return nil, status, err
+	}
+	ctx = context.WithValue(ctx, orgKey{}, name)
+	ctx = context.WithValue(ctx, identityKey{}, label)
+	return context.WithValue(ctx, contractKey{}, contract), 0, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+)
+
+// maxEndorsingPeers caps the endorsingPeers list of a request.
+const maxEndorsingPeers = 16
+
+// profilePeers returns every peer the connection profile defines, by name
+// and by the host:port of its URL, which are the two forms a request may
+// name an endorsing peer in.
+func profilePeers(ccpPath string) (map[string]bool, error) {
+	backends, err := config.FromFile(filepath.Clean(ccpPath))()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection profile: %w", err)
+	}
+	known := make(map[string]bool)
+	for _, backend := range backends {
+		value, ok := backend.Lookup("peers")
+		if !ok {
+			continue
+		}
+		peers, _ := value.(map[string]interface{})
+		for name, peer := range peers {
+			known[name] = true
+			if fields, ok := peer.(map[string]interface{}); ok {
+				if url, ok := fields["url"].(string); ok {
+					_, address, found := strings.Cut(url, "://")
+					if !found {
+						address = url
+					}
+					known[address] = true
+				}
+			}
+		}
+	}
+	return known, nil
+}
+
+// endorsingPeerErrors checks that every peer a request names is in the
+// connection profile, either as given or as a profile peer name with a
+// port added.
+func endorsingPeerErrors(peers []string, known map[string]bool) []FieldError {
+	if len(peers) > maxEndorsingPeers {
+		return []FieldError{{Field: "endorsingPeers", Message: fmt.Sprintf("must have at most %d peers", maxEndorsingPeers)}}
+	}
+	var errs []FieldError
+	for i, peer := range peers {
+		host, _, err := net.SplitHostPort(peer)
+		if known[peer] || (err == nil && known[host]) {
+			continue
+		}
+		errs = append(errs, FieldError{Field: fmt.Sprintf("endorsingPeers.%d", i), Message: fmt.Sprintf("%q is not a peer of the connection profile", peer)})
+	}
+	return errs
+}
+
+// checkEndorsingPeers responds with 400 when peers names an unknown peer.
+// Handlers must return when it reports false.
+func (wh *walletHandler) checkEndorsingPeers(w http.ResponseWriter, peers []string) bool {
+	errs := endorsingPeerErrors(peers, wh.knownPeers)
+	if len(errs) == 0 {
+		return true
+	}
+	writeFieldErrors(w, "request body failed validation", errs)
+	return false
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// contractPool holds contracts of the default identity, each on its own
+// gateway connection, so that concurrent requests do not all queue behind
+// one connection's locks. Callers borrow a contract with acquire and hand
+// it back with release; acquire blocks while every contract is lent out.
+type contractPool struct {
+	contracts chan ContractInvoker
+	owned     []*reconnectingContract
+}
+
+// newContractPool builds a pool of size contracts: first, which is the
+// contract the API already connected with, and size-1 more on gateways
+// connected as cfg.WalletUser. Each reconnects on its own when its
+// connection breaks.
+func newContractPool(cfg *appConfig, wallet identityWallet, first ContractInvoker, size int) (*contractPool, error) {
+	p := &contractPool{contracts: make(chan ContractInvoker, size)}
+	p.contracts <- first
+
+	connect := func() (*fabricConnection, error) { return connectContract(cfg, wallet) }
+	for i := 1; i < size; i++ {
+		conn, err := connect()
+		if err != nil {
+			p.close()
+			return nil, fmt.Errorf("pooled gateway %d: %w", i+1, err)
+		}
+		contract := newReconnectingContract(conn, connect)
+		p.owned = append(p.owned, contract)
+		p.contracts <- contract
+	}
+
+	slog.Info("Contract pool ready", "size", size)
+	return p, nil
+}
+
+// acquire borrows a contract, waiting until one is returned or ctx is done.
+func (p *contractPool) acquire(ctx context.Context) (ContractInvoker, error) {
+	select {
+	case contract := <-p.contracts:
+		return contract, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *contractPool) release(contract ContractInvoker) {
+	p.contracts <- contract
+}
+
+// close closes the pool's own contracts. The first contract belongs to
+// main.
+func (p *contractPool) close() {
+	for _, contract := range p.owned {
+		contract.close()
+	}
+	p.owned = nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serialContract is a contract whose calls queue behind one lock, as they
+// do behind a single gateway connection's.
+type serialContract struct {
+	mu sync.Mutex
+}
+
+func (c *serialContract) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	time.Sleep(100 * time.Microsecond)
+	return []byte(asset1), nil
+}
+
+func (c *serialContract) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	return c.EvaluateTransaction(name, args...)
+}
+
+// BenchmarkContractPool evaluates from many goroutines at once, over one
+// contract and over a pool of one contract per CPU.
+func BenchmarkContractPool(b *testing.B) {
+	size := runtime.GOMAXPROCS(0)
+	for _, bb := range []struct {
+		name string
+		size int
+	}{
+		{"single", 1},
+		{"pooled", size},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			wh := newTestHandler(&serialContract{})
+			if bb.size > 1 {
+				wh.pool = &contractPool{contracts: make(chan ContractInvoker, bb.size)}
+				for i := 0; i < bb.size; i++ {
+					wh.pool.contracts <- &serialContract{}
+				}
+			}
+			ctx := context.Background()
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := wh.evaluate(ctx, "ReadAsset", "asset1"); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
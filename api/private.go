@@ -0,0 +1,137 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+)
+
+// privateAssetTransientKey is the transient field the
+// asset-transfer-private-data chaincode reads a new asset from.
+const privateAssetTransientKey = "asset_properties"
+
+// PrivateAsset is the body of POST /private-assets. The owner is not sent:
+// the chaincode makes the submitting client the owner.
+type PrivateAsset struct {
+	AssetID        string `json:"asset_id"`
+	Colour         string `json:"colour"`
+	Size           string `json:"size"`
+	AppraisedValue string `json:"appraised_value"`
+}
+
+func (a PrivateAsset) fieldErrors() []FieldError {
+	var errs []FieldError
+	errs = requireField(errs, "asset_id", a.AssetID)
+	errs = requireField(errs, "colour", a.Colour)
+	errs = requirePositiveInt(errs, "size", a.Size)
+	errs = requirePositiveInt(errs, "appraised_value", a.AppraisedValue)
+	return errs
+}
+
+// privateAssetProperties is the asset in the shape the private-data
+// chaincode unmarshals from the transient map.
+type privateAssetProperties struct {
+	ObjectType     string `json:"objectType"`
+	AssetID        string `json:"assetID"`
+	Color          string `json:"color"`
+	Size           int    `json:"size"`
+	AppraisedValue int    `json:"appraisedValue"`
+}
+
+// transient returns the transient map for a, which must be valid.
+func (a PrivateAsset) transient() (map[string][]byte, error) {
+	size, _ := strconv.Atoi(a.Size)
+	value, _ := strconv.Atoi(a.AppraisedValue)
+	props, err := json.Marshal(privateAssetProperties{
+		ObjectType:     "asset",
+		AssetID:        a.AssetID,
+		Color:          a.Colour,
+		Size:           size,
+		AppraisedValue: value,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{privateAssetTransientKey: props}, nil
+}
+
+// clientOrgPeers reads the peers of the connection profile's client
+// organization, which private data transactions are endorsed by so that
+// the transient data is only shared with the client's own organization.
+func clientOrgPeers(ccpPath string) ([]string, error) {
+	backends, err := config.FromFile(filepath.Clean(ccpPath))()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection profile: %w", err)
+	}
+	for _, backend := range backends {
+		org, ok := backend.Lookup("client.organization")
+		if !ok {
+			continue
+		}
+		list, ok := backend.Lookup("organizations." + strings.ToLower(fmt.Sprint(org)) + ".peers")
+		if !ok {
+			return nil, fmt.Errorf("the connection profile lists no peers for organization %v", org)
+		}
+		entries, _ := list.([]interface{})
+		var peers []string
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok && name != "" {
+				peers = append(peers, name)
+			}
+		}
+		if len(peers) == 0 {
+			return nil, fmt.Errorf("the connection profile lists no peers for organization %v", org)
+		}
+		return peers, nil
+	}
+	return nil, fmt.Errorf("the connection profile has no client organization")
+}
+
+// CreatePrivateAsset serves POST /private-assets, which creates an asset
+// with the private-data chaincode. The asset travels as transient data,
+// so it is neither part of the transaction arguments nor logged, and only
+// the client organization's peers are asked to endorse it.
+func (wh *walletHandler) CreatePrivateAsset(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	var asset PrivateAsset
+	if !readJSON(w, req, &asset) {
+		return
+	}
+	if !validate(w, asset) {
+		return
+	}
+	if len(wh.orgPeers) == 0 {
+		writeError(w, http.StatusServiceUnavailable, withCode(codeGatewayUnavailable, fmt.Errorf("the client organization's peers are not known, so private data cannot be endorsed")))
+		return
+	}
+
+	transient, err := asset.transient()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	opts := txOptions{transient: transient, endorsingPeers: wh.orgPeers}
+	result, txID, err := wh.submitTxWith(ctx, "CreateAsset", opts)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+	writeTxResult(w, http.StatusCreated, txID, chaincodeData(result))
+}
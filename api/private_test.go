@@ -0,0 +1,72 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const privateAssetBody = `{"asset_id":"asset9","colour":"ultramarine","size":"5","appraised_value":"300"}`
+
+// TestCreatePrivateAsset checks that the asset is sent only in the
+// transient map, to the client organization's peers, and is not logged.
+func TestCreatePrivateAsset(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	contract := &fakeContract{submit: answering(`{"assetID":"asset9"}`)}
+	wh := newTestHandler(contract)
+	wh.orgPeers = []string{"peer0.org1.example.com"}
+
+	rec := serve(newRouter(wh), "POST", "/private-assets", privateAssetBody)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+
+	submissions := contract.submitted()
+	if len(submissions) != 1 || submissions[0].name != "CreateAsset" {
+		t.Fatalf("submissions = %v, want one CreateAsset", submissions)
+	}
+	sub := submissions[0]
+	if len(sub.args) != 0 {
+		t.Errorf("args = %q, want none", sub.args)
+	}
+	if !reflect.DeepEqual(sub.opts.endorsingPeers, wh.orgPeers) {
+		t.Errorf("endorsing peers = %v, want %v", sub.opts.endorsingPeers, wh.orgPeers)
+	}
+	if len(sub.opts.transient) != 1 {
+		t.Fatalf("transient map has %d keys, want only %s", len(sub.opts.transient), privateAssetTransientKey)
+	}
+	var props privateAssetProperties
+	if err := json.Unmarshal(sub.opts.transient[privateAssetTransientKey], &props); err != nil {
+		t.Fatalf("transient %s: %v", privateAssetTransientKey, err)
+	}
+	want := privateAssetProperties{ObjectType: "asset", AssetID: "asset9", Color: "ultramarine", Size: 5, AppraisedValue: 300}
+	if props != want {
+		t.Errorf("transient asset = %+v, want %+v", props, want)
+	}
+
+	if strings.Contains(logs.String(), "ultramarine") {
+		t.Errorf("the transient asset was logged:\n%s", logs.String())
+	}
+}
+
+func TestCreatePrivateAssetWithoutOrgPeers(t *testing.T) {
+	contract := &fakeContract{}
+	rec := serve(newRouter(newTestHandler(contract)), "POST", "/private-assets", privateAssetBody)
+	expectError(t, rec, http.StatusServiceUnavailable, codeGatewayUnavailable)
+	if n := len(contract.submitted()); n != 0 {
+		t.Errorf("%d submissions, want 0", n)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// QueryAssets serves POST /assets/query. The body is a CouchDB Mango query
+// such as {"selector":{"colour":"red"}}, which is passed unchanged to the
+// chaincode's QueryAssets function, so it only works on channels whose
+// state database is CouchDB.
+func (wh *walletHandler) QueryAssets(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+
+	var raw json.RawMessage
+	if !readJSON(w, req, &raw) {
+		return
+	}
+	var query map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &query); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("query must be a JSON object: %w", err))
+		return
+	}
+	if selector := bytes.TrimSpace(query["selector"]); len(selector) == 0 || selector[0] != '{' {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("query must have a selector object"))
+		return
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	result, err := wh.evaluate(ctx, "QueryAssets", compact.String())
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err))
+		return
+	}
+	assets, err := parseLedgerAssets(result)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("unexpected QueryAssets response: %w", err))
+		return
+	}
+	writeData(w, http.StatusOK, assets)
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	codeRateLimited = "RATE_LIMITED"
+
+	// rateLimitIdleTTL is how long a client's bucket is kept after its last
+	// request; buckets idle for longer are swept.
+	rateLimitIdleTTL = 10 * time.Minute
+)
+
+// tokenBucket holds up to burst tokens and refills at rate tokens a second.
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// bucketLimiter keeps one token bucket per client. A zero rate disables it.
+type bucketLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newBucketLimiter(rate float64, burst int) *bucketLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &bucketLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from client's bucket. When the bucket is empty it
+// reports how long until the next token arrives.
+func (l *bucketLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	return l.allowN(client, 1, now)
+}
+
+// allowN takes n tokens from client's bucket, or none when it holds fewer,
+// in which case it reports how long until it holds n.
+func (l *bucketLimiter) allowN(client string, n float64, now time.Time) (bool, time.Duration) {
+	if l == nil || l.rate <= 0 || n <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(client, now)
+
+	if b.tokens < n {
+		wait := time.Duration((n - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens -= n
+	return true, 0
+}
+
+// reserve takes a token from client's bucket even when it is empty,
+// leaving it in debt, and reports how long until the token would have
+// arrived. The debt holds back the client's other requests until the
+// bucket has refilled past it.
+func (l *bucketLimiter) reserve(client string, now time.Time) time.Duration {
+	if l == nil || l.rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(client, now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.rate * float64(time.Second))
+}
+
+// refund gives back a token taken by reserve that was not used.
+func (l *bucketLimiter) refund(client string, now time.Time) {
+	if l == nil || l.rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(client, now)
+	b.tokens = math.Min(l.burst, b.tokens+1)
+}
+
+// bucket returns client's bucket refilled up to now. l.mu must be held.
+func (l *bucketLimiter) bucket(client string, now time.Time) *tokenBucket {
+	l.sweep(now)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastSeen).Seconds()*l.rate)
+	b.lastSeen = now
+	return b
+}
+
+// sweep drops idle buckets, at most once per rateLimitIdleTTL so that it
+// does not walk the map on every request.
+func (l *bucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitIdleTTL {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if now.Sub(b.lastSeen) > rateLimitIdleTTL {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// rateLimiter limits requests per client IP, with separate limits for
+// reads (GET and HEAD) and writes. Legacy reads that use POST count as
+// writes.
+type rateLimiter struct {
+	reads          *bucketLimiter
+	writes         *bucketLimiter
+	trustedProxies []*net.IPNet
+}
+
+func newRateLimiter(cfg *appConfig) (*rateLimiter, error) {
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimiter{
+		reads:          newBucketLimiter(cfg.ReadRateLimit, cfg.ReadRateBurst),
+		writes:         newBucketLimiter(cfg.WriteRateLimit, cfg.WriteRateBurst),
+		trustedProxies: proxies,
+	}, nil
+}
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDRs.
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func (l *rateLimiter) trusted(ip net.IP) bool {
+	for _, n := range l.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address the request came from. X-Forwarded-For is
+// only believed when the connection comes from a trusted proxy, and is
+// read from the right so a client cannot spoof its way past the proxy.
+func (l *rateLimiter) clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !l.trusted(ip) {
+		return host
+	}
+
+	hops := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if !l.trusted(hop) {
+			return hop.String()
+		}
+	}
+	return host
+}
+
+// limit rejects requests over the client's limit with 429 and a
+// Retry-After header giving the seconds until a request will be accepted.
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if l == nil || req.Method == "OPTIONS" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		limiter := l.writes
+		if req.Method == "GET" || req.Method == "HEAD" {
+			limiter = l.reads
+		}
+		if ok, wait := limiter.allow(l.clientIP(req), time.Now()); !ok {
+			writeRateLimited(w, wait)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// batchPacer paces the writes of a request that creates several assets so
+// that each asset after the first, which the request itself paid for,
+// counts as a write against the client's limit. When the client's bucket
+// runs dry the batch waits for it to refill rather than failing.
+type batchPacer struct {
+	writes *bucketLimiter
+	client string
+	paid   bool
+}
+
+// pacer returns the pacer for the assets written by req.
+func (l *rateLimiter) pacer(req *http.Request) *batchPacer {
+	if l == nil {
+		return &batchPacer{}
+	}
+	return &batchPacer{writes: l.writes, client: l.clientIP(req)}
+}
+
+// wait takes a write for the next asset of the batch, waiting until the
+// client's bucket has refilled enough to pay for it. It fails at once,
+// without taking the write, when ctx would be done before then.
+func (p *batchPacer) wait(ctx context.Context) error {
+	if !p.paid {
+		p.paid = true
+		return nil
+	}
+	wait := p.writes.reserve(p.client, time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		p.writes.refund(p.client, time.Now())
+		return withCode(codeRateLimited, fmt.Errorf("rate limit exceeded, retry in %s", wait.Round(time.Millisecond)))
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		p.writes.refund(p.client, time.Now())
+		return ctx.Err()
+	}
+}
+
+// batchDuration is how long pacing n writes can hold up a batch when the
+// client's bucket is empty from the start.
+func (l *rateLimiter) batchDuration(n int) time.Duration {
+	if l == nil || l.writes == nil || l.writes.rate <= 0 || n <= 1 {
+		return 0
+	}
+	return time.Duration(float64(n-1) / l.writes.rate * float64(time.Second))
+}
+
+// writeRateLimited answers 429 with a Retry-After header giving the
+// seconds until wait has passed.
+func writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, withCode(codeRateLimited, fmt.Errorf("rate limit exceeded, retry in %s", wait.Round(time.Millisecond))))
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// errNetworkUnavailable is returned by calls made while a broken gateway
+// connection is being re-established.
+var errNetworkUnavailable = withCode(codeGatewayUnavailable, errors.New("fabric network unavailable"))
+
+// fabricConnection is a gateway connection and the default chaincode's
+// contract on it.
+type fabricConnection struct {
+	gw       *gateway.Gateway
+	network  *gateway.Network
+	contract *gateway.Contract
+	// owned is false for the connection main opened, which the event
+	// listeners also use and main closes.
+	owned bool
+
+	// calls counts the calls in flight on the connection. Once it is
+	// retired no more start, and the last call to finish closes it.
+	mu      sync.Mutex
+	calls   int
+	retired bool
+	closed  bool
+}
+
+// acquire counts a call in flight on conn, and fails once conn is retired.
+func (conn *fabricConnection) acquire() bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.retired {
+		return false
+	}
+	conn.calls++
+	return true
+}
+
+func (conn *fabricConnection) release() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.calls--
+	conn.closeIfIdle()
+}
+
+// retire stops new calls on conn and closes it once the calls in flight
+// finish.
+func (conn *fabricConnection) retire() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.retired = true
+	conn.closeIfIdle()
+}
+
+// closeIfIdle closes a retired connection with no calls in flight, unless
+// main owns it. Callers hold conn.mu.
+func (conn *fabricConnection) closeIfIdle() {
+	if !conn.retired || conn.calls > 0 || !conn.owned || conn.closed {
+		return
+	}
+	conn.closed = true
+	if conn.gw != nil {
+		conn.gw.Close()
+	}
+}
+
+// reconnectingContract is a contract of the default identity that
+// re-establishes its gateway connection when a call fails because the
+// connection broke, for instance after a peer restart. The first attempt
+// is made by the failing call, which an evaluation then retries once;
+// when it fails too, calls fail fast with errNetworkUnavailable while the
+// connection is retried in the background with backoff.
+type reconnectingContract struct {
+	connect func() (*fabricConnection, error)
+
+	mu          sync.Mutex // held while reconnecting
+	current     atomic.Pointer[fabricConnection]
+	unavailable atomic.Bool
+	done        chan struct{}
+}
+
+func newReconnectingContract(conn *fabricConnection, connect func() (*fabricConnection, error)) *reconnectingContract {
+	c := &reconnectingContract{connect: connect, done: make(chan struct{})}
+	c.current.Store(conn)
+	return c
+}
+
+// connectContract opens a gateway connection as cfg.WalletUser and gets
+// the default chaincode's contract on it.
+func connectContract(cfg *appConfig, wallet identityWallet) (*fabricConnection, error) {
+	gw, err := connectGateway(cfg, wallet, cfg.WalletUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to gateway: %w", err)
+	}
+	network, err := gw.GetNetwork(cfg.ChannelName)
+	if err != nil {
+		gw.Close()
+		return nil, fmt.Errorf("failed to get network: %w", err)
+	}
+	return &fabricConnection{gw: gw, network: network, contract: network.GetContract(cfg.ChaincodeName), owned: true}, nil
+}
+
+// connection returns the current connection with a call counted in flight
+// on it, which the caller releases when the call is done.
+func (c *reconnectingContract) connection() (*fabricConnection, error) {
+	for {
+		if c.unavailable.Load() {
+			return nil, errNetworkUnavailable
+		}
+		// A connection is retired after its replacement is stored, so
+		// loading again finds the new one, unless the contract is closed.
+		if conn := c.current.Load(); conn.acquire() {
+			return conn, nil
+		}
+		select {
+		case <-c.done:
+			return nil, errNetworkUnavailable
+		default:
+		}
+	}
+}
+
+func (c *reconnectingContract) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	conn, err := c.connection()
+	if err != nil {
+		return nil, err
+	}
+	result, err := conn.contract.EvaluateTransaction(name, args...)
+	conn.release()
+	if !isConnectivityError(err) {
+		return result, err
+	}
+	if err := c.reconnect(conn); err != nil {
+		return nil, err
+	}
+	if conn, err = c.connection(); err != nil {
+		return nil, err
+	}
+	defer conn.release()
+	return conn.contract.EvaluateTransaction(name, args...)
+}
+
+func (c *reconnectingContract) SubmitTransaction(name string, args ...string) ([]byte, error) {
+	result, _, err := c.submitWithTxID(name, txOptions{}, args...)
+	return result, err
+}
+
+// submitWithTxID is submitWithTxID on the current connection. A submission
+// is not retried here: the connectivity error it returns is retryable, so
+// the retry policy submits again on the new connection.
+func (c *reconnectingContract) submitWithTxID(name string, opts txOptions, args ...string) ([]byte, string, error) {
+	conn, err := c.connection()
+	if err != nil {
+		return nil, "", err
+	}
+	result, txID, err := submitWithTxID(conn.contract, name, opts, args...)
+	conn.release()
+	if isConnectivityError(err) {
+		c.reconnect(conn)
+	}
+	return result, txID, err
+}
+
+// reconnect replaces broken with a new connection, unless another call
+// already did. When that fails, reconnecting continues in the background
+// and errNetworkUnavailable is returned.
+func (c *reconnectingContract) reconnect(broken *fabricConnection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.unavailable.Load() {
+		return errNetworkUnavailable
+	}
+	if c.current.Load() != broken {
+		return nil
+	}
+	slog.Warn("Gateway connection lost, reconnecting")
+	if err := c.replace(); err != nil {
+		slog.Error("Reconnecting to the Fabric network failed, retrying in the background", "error", err)
+		c.unavailable.Store(true)
+		go c.reconnectInBackground()
+		return errNetworkUnavailable
+	}
+	return nil
+}
+
+// replace swaps in a new connection. The old one is closed once the calls
+// still in flight on it finish. Callers hold c.mu.
+func (c *reconnectingContract) replace() error {
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	c.current.Swap(conn).retire()
+	return nil
+}
+
+func (c *reconnectingContract) reconnectInBackground() {
+	backoff := time.Second
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(backoff):
+		}
+
+		c.mu.Lock()
+		err := c.replace()
+		if err == nil {
+			c.unavailable.Store(false)
+		}
+		c.mu.Unlock()
+		if err == nil {
+			slog.Info("Reconnected to the Fabric network")
+			return
+		}
+		slog.Warn("Fabric network is still unreachable", "retry_in", backoff, "error", err)
+		backoff = min(backoff*2, startupMaxBackoff)
+	}
+}
+
+// blockEvents is the eventSource of the block tracker: the network of the
+// current connection.
+func (c *reconnectingContract) blockEvents() (blockEventSource, func()) {
+	conn := c.current.Load()
+	return conn.network, func() { c.reconnect(conn) }
+}
+
+// chaincodeEvents is the eventSource of the event hub: the default
+// chaincode's contract on the current connection.
+func (c *reconnectingContract) chaincodeEvents() (chaincodeEventSource, func()) {
+	conn := c.current.Load()
+	return conn.contract, func() { c.reconnect(conn) }
+}
+
+// close stops reconnecting and closes the connection, once its calls in
+// flight finish, unless main owns it.
+func (c *reconnectingContract) close() {
+	close(c.done)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current.Load().retire()
+}
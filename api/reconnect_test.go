@@ -0,0 +1,109 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestReplaceWaitsForCalls checks that a reconnect closes the old gateway
+// only once the calls already running on it have finished, and that calls
+// starting meanwhile use the new one.
+func TestReplaceWaitsForCalls(t *testing.T) {
+	old := &fabricConnection{owned: true}
+	fresh := &fabricConnection{owned: true}
+	c := newReconnectingContract(old, func() (*fabricConnection, error) { return fresh, nil })
+
+	inFlight, err := c.connection()
+	if err != nil || inFlight != old {
+		t.Fatalf("connection() = %p, %v, want the old connection", inFlight, err)
+	}
+	if err := c.reconnect(old); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	if old.closed {
+		t.Fatal("the old gateway was closed with a call still running on it")
+	}
+
+	next, err := c.connection()
+	if err != nil || next != fresh {
+		t.Fatalf("connection() = %p, %v, want the new connection", next, err)
+	}
+	next.release()
+
+	inFlight.release()
+	if !old.closed {
+		t.Error("the old gateway was not closed after its last call finished")
+	}
+	if fresh.closed {
+		t.Error("the new gateway was closed")
+	}
+}
+
+// TestCloseWaitsForCalls checks that closing the contract leaves a running
+// call its gateway, and that later calls fail instead of starting.
+func TestCloseWaitsForCalls(t *testing.T) {
+	conn := &fabricConnection{owned: true}
+	c := newReconnectingContract(conn, nil)
+
+	inFlight, err := c.connection()
+	if err != nil {
+		t.Fatalf("connection: %v", err)
+	}
+	c.close()
+	if conn.closed {
+		t.Fatal("the gateway was closed with a call still running on it")
+	}
+	if _, err := c.connection(); !errors.Is(err, errNetworkUnavailable) {
+		t.Errorf("connection() after close = %v, want %v", err, errNetworkUnavailable)
+	}
+	inFlight.release()
+	if !conn.closed {
+		t.Error("the gateway was not closed after its last call finished")
+	}
+}
+
+// TestMainConnectionIsNotClosed checks that the connection main opened is
+// left for main to close.
+func TestMainConnectionIsNotClosed(t *testing.T) {
+	conn := &fabricConnection{}
+	c := newReconnectingContract(conn, func() (*fabricConnection, error) { return &fabricConnection{owned: true}, nil })
+	if err := c.reconnect(conn); err != nil {
+		t.Fatalf("reconnect: %v", err)
+	}
+	if conn.closed {
+		t.Error("main's connection was closed")
+	}
+}
+
+// TestEventSourcesReportBrokenConnection checks that an event listener
+// reporting its connection broken replaces it, once, and that the next
+// registration goes to the new connection.
+func TestEventSourcesReportBrokenConnection(t *testing.T) {
+	old := &fabricConnection{owned: true}
+	fresh := &fabricConnection{owned: true}
+	connects := 0
+	c := newReconnectingContract(old, func() (*fabricConnection, error) {
+		connects++
+		return fresh, nil
+	})
+
+	_, brokenBlocks := c.blockEvents()
+	_, brokenEvents := c.chaincodeEvents()
+	brokenBlocks()
+	brokenEvents()
+	if connects != 1 {
+		t.Errorf("connected %d times, want 1", connects)
+	}
+	if c.current.Load() != fresh {
+		t.Error("the broken connection was not replaced")
+	}
+	if !old.closed {
+		t.Error("the broken connection was not closed")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"google.golang.org/grpc/codes"
+)
+
+// retryPolicy retries submissions that failed for reasons that a second
+// attempt can fix, backing off exponentially with jitter between attempts.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+// do calls attempt until it succeeds, fails with an error that is not
+// retryable, ctx is done or maxAttempts is reached. The final error says
+// how many attempts were made.
+func (p retryPolicy) do(ctx context.Context, name string, attempt func() error) error {
+	delay := p.backoff
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		if n >= p.maxAttempts || !isRetryable(err) {
+			if n > 1 {
+				return fmt.Errorf("gave up after %d attempts: %w", n, err)
+			}
+			return err
+		}
+
+		// Full jitter spreads out clients that conflicted with each other,
+		// so they do not collide again on the next attempt.
+		wait := time.Duration(rand.Int63n(int64(delay) + 1))
+		slog.WarnContext(ctx, "retrying transaction", "function", name, "attempt", n, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %d attempts: %w", n, ctx.Err())
+		}
+		if delay *= 2; delay > p.maxBackoff {
+			delay = p.maxBackoff
+		}
+	}
+}
+
+// isRetryable reports whether err is an MVCC or phantom read conflict, or
+// a transient failure to reach or agree with the endorsing peers.
+// Chaincode errors, such as an asset already existing, are never retried.
+func isRetryable(err error) bool {
+	s, ok := sdkStatus(err)
+	if !ok {
+		return false
+	}
+
+	switch s.Group {
+	case status.EventServerStatus:
+		code := peer.TxValidationCode(s.Code)
+		return code == peer.TxValidationCode_MVCC_READ_CONFLICT || code == peer.TxValidationCode_PHANTOM_READ_CONFLICT
+	case status.GRPCTransportStatus:
+		return codes.Code(s.Code) == codes.Unavailable
+	case status.EndorserClientStatus, status.ClientStatus:
+		return s.Code == status.ConnectionFailed.ToInt32() || s.Code == status.EndorsementMismatch.ToInt32()
+	}
+	return false
+}
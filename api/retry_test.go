@@ -0,0 +1,105 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+)
+
+var errMVCCConflict = status.New(status.EventServerStatus, int32(peer.TxValidationCode_MVCC_READ_CONFLICT), "MVCC read conflict", nil)
+
+// flaky returns a contract function that fails with err for its first n
+// calls and succeeds after that.
+func flaky(n int, err error) func(string, ...string) ([]byte, error) {
+	calls := 0
+	return func(string, ...string) ([]byte, error) {
+		if calls++; calls <= n {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		maxAttempts int
+		attempts    int
+		wantErr     bool
+	}{
+		{"first attempt succeeds", 0, errMVCCConflict, 3, 1, false},
+		{"succeeds after conflicts", 2, errMVCCConflict, 3, 3, false},
+		{"succeeds after unreachable peer", 1, errPeerUnreachable, 3, 2, false},
+		{"gives up at max attempts", 5, errMVCCConflict, 3, 3, true},
+		{"chaincode errors are not retried", 1, chaincodeError("the asset asset1 already exists"), 3, 1, true},
+		{"unknown errors are not retried", 1, errSDKBroken, 3, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := retryPolicy{maxAttempts: tt.maxAttempts, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+			call := flaky(tt.failures, tt.err)
+			attempts := 0
+			err := p.do(context.Background(), "CreateAsset", func() error {
+				attempts++
+				_, err := call("CreateAsset")
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want it to wrap %v", err, tt.err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyStopsWithContext(t *testing.T) {
+	p := retryPolicy{maxAttempts: 5, backoff: time.Hour, maxBackoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	err := p.do(ctx, "CreateAsset", func() error {
+		attempts++
+		return errMVCCConflict
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's error", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
+
+// TestSubmitRetries checks that a handler's submission is retried until a
+// conflicting contract lets it through.
+func TestSubmitRetries(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{}), submit: flaky(2, errMVCCConflict)}
+	wh := newTestHandler(contract)
+	wh.retry = retryPolicy{maxAttempts: 3, backoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	rec := serve(newRouter(wh), "POST", "/create-asset", createBody)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	if n := contract.count("CreateAsset"); n != 3 {
+		t.Errorf("CreateAsset submitted %d times, want 3", n)
+	}
+}
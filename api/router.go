@@ -0,0 +1,64 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newRouter returns a mux with every API route registered on wh. Building
+// a fresh mux, rather than using http.DefaultServeMux, lets tests serve the
+// routes with httptest and keeps importers free of route collisions.
+func newRouter(wh *walletHandler) *http.ServeMux {
+	auth := wh.auth
+	// route puts h behind guard, the route's auth check. Only requests it
+	// lets through are checked against the OpenAPI document and bound to
+	// the identity they ask for, so that callers without credentials learn
+	// nothing from validation errors and cannot make the API connect.
+	route := func(guard func(http.HandlerFunc) http.Handler, h http.HandlerFunc) http.Handler {
+		return guard(wh.validator.validateRequests(wh.withIdentity(h)))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/create-asset", route(auth.mutating, wh.idempotent(wh.CreateAsset)))
+	mux.Handle("/transaction", route(auth.mutating, wh.StartTransaction))
+	mux.Handle("/assets", route(auth.reading, wh.GetAllAssets))
+	mux.Handle("/assets/", route(auth.byMethod, wh.AssetByID))
+	mux.Handle("/assets/bulk", route(auth.mutating, wh.BulkCreateAssets))
+	mux.Handle("/assets/batch-get", route(auth.reading, wh.BatchGetAssets))
+	mux.Handle("/assets/export", route(auth.reading, wh.ExportAssets))
+	mux.Handle("/assets/import", route(auth.mutating, wh.ImportAssets))
+	mux.Handle("/assets/query", route(auth.reading, wh.QueryAssets))
+	mux.Handle("/invoke", route(auth.mutating, wh.Invoke))
+	mux.Handle("/private-assets", route(auth.mutating, wh.CreatePrivateAsset))
+	mux.Handle("/transactions/prepare", route(auth.mutating, wh.PrepareTransaction))
+	mux.Handle("/transactions/submit", route(auth.mutating, wh.SubmitSignedTransaction))
+	mux.Handle("/asset", route(auth.reading, wh.GetSingleAsset))
+	mux.Handle("/asset/delete", route(auth.mutating, wh.DeleteAsset))
+	mux.Handle("/asset/update", route(auth.mutating, wh.UpdateAsset))
+	mux.Handle("/asset/history", route(auth.reading, wh.AssetHistory))
+	mux.Handle("/asset/exists", route(auth.reading, wh.AssetExists))
+	mux.Handle("/asset/transfer/history", route(auth.mutating, wh.TransferWithHistory))
+	mux.Handle("/ledger/status", route(auth.reading, wh.LedgerStatus))
+	mux.Handle("/submissions/", route(auth.reading, wh.SubmissionStatus))
+	mux.Handle("/events", route(auth.reading, wh.Events))
+	mux.Handle("/enroll", route(auth.admin, wh.Enroll))
+	mux.Handle("/identities", route(auth.admin, wh.RegisterIdentity))
+	mux.Handle("/wallet/identities", route(auth.admin, wh.WalletIdentities))
+	mux.Handle("/wallet/identities/", route(auth.admin, wh.WalletIdentities))
+	mux.Handle("/admin/init-ledger", route(auth.admin, wh.InitLedger))
+	mux.HandleFunc("/health", wh.Health)
+	mux.HandleFunc("/healthz", wh.Healthz)
+	mux.HandleFunc("/readyz", wh.Readyz)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/openapi.json", OpenAPI)
+	mux.HandleFunc("/swagger", Swagger)
+	mux.Handle("/channels/", wh.channelScoped(mux))
+	return mux
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// sqlWalletMigrations create and evolve the wallet table. Each runs once,
+// in order, and the number applied is recorded in wallet_schema_version.
+var sqlWalletMigrations = []string{
+	`CREATE TABLE wallet_identities (
+		label    TEXT PRIMARY KEY,
+		identity TEXT NOT NULL
+	)`,
+}
+
+// sqlWallet keeps wallet identities in a SQL database as the SDK's JSON
+// identity format, so that every replica of the API sees the identities
+// enrolled on any of them. It works with drivers whose SQL accepts $n
+// placeholders and ON CONFLICT, such as PostgreSQL's and SQLite's. The
+// driver must be linked into the binary with a blank import.
+type sqlWallet struct {
+	db *sql.DB
+}
+
+// openSQLWallet connects to the wallet database and migrates it.
+func openSQLWallet(driver, dsn string) (*sqlWallet, error) {
+	if !sqlDriverLinked(driver) {
+		return nil, fmt.Errorf("no database/sql driver named %q is linked into this binary; add a blank import of it", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wallet database: %w", err)
+	}
+	if err := migrateSQLWallet(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlWallet{db: db}, nil
+}
+
+func sqlDriverLinked(driver string) bool {
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateSQLWallet applies the migrations the database has not seen yet,
+// each in a transaction with its version bump. When replicas start
+// together, the one that loses the race fails to start instead of applying
+// a migration twice.
+func migrateSQLWallet(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS wallet_schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("failed to create wallet schema version table: %w", err)
+	}
+	for {
+		done, err := applyNextMigration(db)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func applyNextMigration(db *sql.DB) (done bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to migrate wallet database: %w", err)
+	}
+	defer func() {
+		if err != nil || done {
+			tx.Rollback()
+		}
+	}()
+
+	var version int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM wallet_schema_version`).Scan(&version); err != nil {
+		return false, fmt.Errorf("failed to read wallet schema version: %w", err)
+	}
+	if version >= len(sqlWalletMigrations) {
+		return true, nil
+	}
+	if _, err := tx.Exec(sqlWalletMigrations[version]); err != nil {
+		return false, fmt.Errorf("wallet migration %d failed: %w", version+1, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO wallet_schema_version (version) VALUES ($1)`, version+1); err != nil {
+		return false, fmt.Errorf("failed to record wallet migration %d: %w", version+1, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit wallet migration %d: %w", version+1, err)
+	}
+	slog.Info("Migrated wallet database", "version", version+1)
+	return false, nil
+}
+
+// Put stores id under label, replacing any identity already there.
+func (w *sqlWallet) Put(label string, id gateway.Identity) error {
+	x509ID, ok := id.(*gateway.X509Identity)
+	if !ok {
+		return fmt.Errorf("identity %s is not an X.509 identity", label)
+	}
+	content, err := json.Marshal(x509ID)
+	if err != nil {
+		return err
+	}
+	_, err = w.db.Exec(`INSERT INTO wallet_identities (label, identity) VALUES ($1, $2)
+		ON CONFLICT (label) DO UPDATE SET identity = excluded.identity`, label, string(content))
+	return err
+}
+
+func (w *sqlWallet) Get(label string) (gateway.Identity, error) {
+	var content string
+	err := w.db.QueryRow(`SELECT identity FROM wallet_identities WHERE label = $1`, label).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("identity %s is not in the wallet", label)
+	}
+	if err != nil {
+		return nil, err
+	}
+	id := &gateway.X509Identity{}
+	if err := json.Unmarshal([]byte(content), id); err != nil {
+		return nil, fmt.Errorf("identity %s is corrupt: %w", label, err)
+	}
+	return id, nil
+}
+
+func (w *sqlWallet) Remove(label string) error {
+	_, err := w.db.Exec(`DELETE FROM wallet_identities WHERE label = $1`, label)
+	return err
+}
+
+// Exists reports whether label is in the wallet. Like the SDK's wallets it
+// cannot return an error, so a failed query is logged and reported as a
+// missing identity.
+func (w *sqlWallet) Exists(label string) bool {
+	var one int
+	err := w.db.QueryRow(`SELECT 1 FROM wallet_identities WHERE label = $1`, label).Scan(&one)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("wallet lookup failed", "label", label, "error", err)
+	}
+	return err == nil
+}
+
+func (w *sqlWallet) List() ([]string, error) {
+	rows, err := w.db.Query(`SELECT label FROM wallet_identities ORDER BY label`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var labels []string
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
@@ -0,0 +1,348 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// fakeSQLDriver is the database/sql driver the SQL wallet is tested with.
+// It understands the statements sqlWallet issues and nothing else, and
+// keeps one database per DSN for the life of the test binary.
+const fakeSQLDriver = "walletdb"
+
+func init() {
+	sql.Register(fakeSQLDriver, &walletDBDriver{})
+}
+
+type walletDBDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*walletDB
+}
+
+func (d *walletDBDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dbs == nil {
+		d.dbs = make(map[string]*walletDB)
+	}
+	db, ok := d.dbs[dsn]
+	if !ok {
+		db = &walletDB{identities: make(map[string]string)}
+		d.dbs[dsn] = db
+	}
+	return &walletDBConn{db: db}, nil
+}
+
+type walletDB struct {
+	mu         sync.Mutex
+	versions   []int64
+	migrated   bool
+	identities map[string]string
+}
+
+// walletDBConn runs statements directly against its database. Transactions
+// are not isolated: the wallet only needs them to commit.
+type walletDBConn struct {
+	db *walletDB
+}
+
+func (c *walletDBConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("walletdb: prepared statements are not supported")
+}
+
+func (c *walletDBConn) Close() error              { return nil }
+func (c *walletDBConn) Begin() (driver.Tx, error) { return walletDBTx{}, nil }
+
+type walletDBTx struct{}
+
+func (walletDBTx) Commit() error   { return nil }
+func (walletDBTx) Rollback() error { return nil }
+
+func (c *walletDBConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	query = strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS wallet_schema_version "):
+	case strings.HasPrefix(query, "CREATE TABLE wallet_identities "):
+		if db.migrated {
+			return nil, fmt.Errorf("walletdb: table wallet_identities already exists")
+		}
+		db.migrated = true
+	case query == "INSERT INTO wallet_schema_version (version) VALUES ($1)":
+		db.versions = append(db.versions, args[0].Value.(int64))
+	case query == "INSERT INTO wallet_identities (label, identity) VALUES ($1, $2) ON CONFLICT (label) DO UPDATE SET identity = excluded.identity":
+		if !db.migrated {
+			return nil, fmt.Errorf("walletdb: no such table: wallet_identities")
+		}
+		db.identities[args[0].Value.(string)] = args[1].Value.(string)
+	case query == "DELETE FROM wallet_identities WHERE label = $1":
+		if !db.migrated {
+			return nil, fmt.Errorf("walletdb: no such table: wallet_identities")
+		}
+		delete(db.identities, args[0].Value.(string))
+	default:
+		return nil, fmt.Errorf("walletdb: unsupported statement %q", query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *walletDBConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	db := c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "SELECT COALESCE(MAX(version), 0) FROM wallet_schema_version" {
+		var version int64
+		for _, v := range db.versions {
+			if v > version {
+				version = v
+			}
+		}
+		return &walletDBRows{column: "version", values: []driver.Value{version}}, nil
+	}
+	if !db.migrated {
+		return nil, fmt.Errorf("walletdb: no such table: wallet_identities")
+	}
+
+	switch query {
+	case "SELECT identity FROM wallet_identities WHERE label = $1":
+		rows := &walletDBRows{column: "identity"}
+		if identity, ok := db.identities[args[0].Value.(string)]; ok {
+			rows.values = append(rows.values, identity)
+		}
+		return rows, nil
+	case "SELECT 1 FROM wallet_identities WHERE label = $1":
+		rows := &walletDBRows{column: "1"}
+		if _, ok := db.identities[args[0].Value.(string)]; ok {
+			rows.values = append(rows.values, int64(1))
+		}
+		return rows, nil
+	case "SELECT label FROM wallet_identities ORDER BY label":
+		rows := &walletDBRows{column: "label"}
+		labels := make([]string, 0, len(db.identities))
+		for label := range db.identities {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			rows.values = append(rows.values, label)
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("walletdb: unsupported query %q", query)
+}
+
+// walletDBRows is a single-column result.
+type walletDBRows struct {
+	column string
+	values []driver.Value
+}
+
+func (r *walletDBRows) Columns() []string { return []string{r.column} }
+func (r *walletDBRows) Close() error      { return nil }
+
+func (r *walletDBRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+// walletStores opens an empty wallet of each type, as newWallet does, for
+// the tests every store must pass.
+func walletStores(t *testing.T) map[string]identityWallet {
+	t.Helper()
+	stores := make(map[string]identityWallet)
+	for _, walletType := range []string{walletTypeFilesystem, walletTypeMemory, walletTypeSQL} {
+		cfg := &appConfig{
+			WalletType:     walletType,
+			WalletPath:     t.TempDir(),
+			WalletDBDriver: fakeSQLDriver,
+			WalletDBDSN:    t.Name(),
+		}
+		wallet, err := newWallet(cfg)
+		if err != nil {
+			t.Fatalf("newWallet(%s): %v", walletType, err)
+		}
+		stores[walletType] = wallet
+	}
+	return stores
+}
+
+// newTestIdentity returns an X.509 identity of mspID with a self-signed
+// certificate for localhost.
+func newTestIdentity(t *testing.T, mspID string) *gateway.X509Identity {
+	t.Helper()
+	certFile, keyFile, _ := writeSelfSignedCert(t, t.TempDir())
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gateway.NewX509Identity(mspID, string(cert), string(key))
+}
+
+// TestWalletStores runs the same Put/Get/Exists/List/Remove checks against
+// every wallet store.
+func TestWalletStores(t *testing.T) {
+	user1, user2 := newTestIdentity(t, "Org1MSP"), newTestIdentity(t, "Org2MSP")
+	for name, wallet := range walletStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if wallet.Exists("user1") {
+				t.Error("Exists(user1) in an empty wallet")
+			}
+			if _, err := wallet.Get("user1"); err == nil {
+				t.Error("Get(user1) from an empty wallet succeeded")
+			}
+			if labels, err := wallet.List(); err != nil || len(labels) != 0 {
+				t.Errorf("List() = %v, %v, want no labels", labels, err)
+			}
+
+			for label, id := range map[string]*gateway.X509Identity{"user1": user1, "user2": user2} {
+				if err := wallet.Put(label, id); err != nil {
+					t.Fatalf("Put(%s): %v", label, err)
+				}
+			}
+			if !wallet.Exists("user1") {
+				t.Error("Exists(user1) = false after Put")
+			}
+			id, err := wallet.Get("user2")
+			if err != nil {
+				t.Fatalf("Get(user2): %v", err)
+			}
+			got, ok := id.(*gateway.X509Identity)
+			if !ok || got.MspID != "Org2MSP" || got.Certificate() != user2.Certificate() || got.Key() != user2.Key() {
+				t.Errorf("Get(user2) = %+v, want the identity put", id)
+			}
+			labels, err := wallet.List()
+			sort.Strings(labels)
+			if err != nil || !reflect.DeepEqual(labels, []string{"user1", "user2"}) {
+				t.Errorf("List() = %v, %v, want [user1 user2]", labels, err)
+			}
+
+			if err := wallet.Remove("user1"); err != nil {
+				t.Fatalf("Remove(user1): %v", err)
+			}
+			if wallet.Exists("user1") {
+				t.Error("Exists(user1) after Remove")
+			}
+			if labels, err := wallet.List(); err != nil || !reflect.DeepEqual(labels, []string{"user2"}) {
+				t.Errorf("List() = %v, %v, want [user2]", labels, err)
+			}
+			if err := wallet.Remove("user1"); err != nil {
+				t.Errorf("Remove(user1) of a missing identity: %v", err)
+			}
+		})
+	}
+}
+
+// TestWalletEndpointsAcrossStores checks that the enrollment and wallet
+// management endpoints answer the same with every wallet store.
+func TestWalletEndpointsAcrossStores(t *testing.T) {
+	appUser, user2 := newTestIdentity(t, "Org1MSP"), newTestIdentity(t, "Org1MSP")
+	for name, wallet := range walletStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for label, id := range map[string]*gateway.X509Identity{"appUser": appUser, "user2": user2} {
+				if err := wallet.Put(label, id); err != nil {
+					t.Fatalf("Put(%s): %v", label, err)
+				}
+			}
+			wh := newTestHandler(&fakeContract{})
+			wh.auth = &apiKeyAuth{keys: [][]byte{[]byte("secret")}}
+			wh.wallet = wallet
+			wh.ca = &caEnroller{canRegister: true}
+			h := newRouter(wh)
+
+			rec := serve(h, "GET", "/wallet/identities", "", apiKeyHeader, "secret")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /wallet/identities: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var identities []WalletIdentity
+			if err := json.Unmarshal(decodeResponse(t, rec).Data, &identities); err != nil {
+				t.Fatal(err)
+			}
+			if len(identities) != 2 || identities[0].Label != "appUser" || !identities[0].InUse ||
+				identities[1].Label != "user2" || identities[1].InUse || identities[1].Subject != "CN=localhost" {
+				t.Errorf("identities = %+v, want appUser in use and user2", identities)
+			}
+
+			rec = serve(h, "POST", "/enroll", `{"username":"user2","secret":"pw"}`, apiKeyHeader, "secret")
+			expectError(t, rec, http.StatusConflict, codeUserExists)
+			rec = serve(h, "POST", "/identities", `{"label":"user2","secret":"pw"}`, apiKeyHeader, "secret")
+			expectError(t, rec, http.StatusConflict, codeUserExists)
+
+			rec = serve(h, "DELETE", "/wallet/identities/appUser", "", apiKeyHeader, "secret")
+			expectError(t, rec, http.StatusConflict, codeIdentityInUse)
+			if rec := serve(h, "DELETE", "/wallet/identities/user2", "", apiKeyHeader, "secret"); rec.Code != http.StatusNoContent {
+				t.Fatalf("DELETE user2: status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+			}
+			rec = serve(h, "GET", "/wallet/identities/user2", "", apiKeyHeader, "secret")
+			expectError(t, rec, http.StatusNotFound, codeIdentityNotFound)
+			rec = serve(h, "DELETE", "/wallet/identities/user2", "", apiKeyHeader, "secret")
+			expectError(t, rec, http.StatusNotFound, codeIdentityNotFound)
+			if wallet.Exists("user2") || !wallet.Exists("appUser") {
+				t.Error("the wallet does not hold only appUser after the delete")
+			}
+		})
+	}
+}
+
+// TestSQLWalletSharedAcrossReplicas opens the same database twice, as two
+// replicas do, and checks that migrations run once and identities put by
+// one are seen by the other.
+func TestSQLWalletSharedAcrossReplicas(t *testing.T) {
+	first, err := openSQLWallet(fakeSQLDriver, t.Name())
+	if err != nil {
+		t.Fatalf("openSQLWallet: %v", err)
+	}
+	second, err := openSQLWallet(fakeSQLDriver, t.Name())
+	if err != nil {
+		t.Fatalf("openSQLWallet again: %v", err)
+	}
+
+	if err := first.Put("user1", newTestIdentity(t, "Org1MSP")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !second.Exists("user1") {
+		t.Error("an identity put on one replica is missing on the other")
+	}
+	if err := second.Remove("user1"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if first.Exists("user1") {
+		t.Error("an identity removed on one replica is still on the other")
+	}
+}
+
+func TestOpenSQLWalletWithoutDriver(t *testing.T) {
+	if _, err := openSQLWallet("nosuchdriver", "dsn"); err == nil || !strings.Contains(err.Error(), "blank import") {
+		t.Errorf("openSQLWallet with an unlinked driver: err = %v, want a blank import hint", err)
+	}
+}
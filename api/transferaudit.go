@@ -0,0 +1,92 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// TransferRecord is the data of a /asset/transfer/history response: the
+// transfer's transaction, the owner before it and the asset after it.
+type TransferRecord struct {
+	TxID          string `json:"txId,omitempty"`
+	AssetID       string `json:"asset_id"`
+	PreviousOwner string `json:"previous_owner"`
+	Asset         Asset  `json:"asset"`
+}
+
+// TransferWithHistory serves POST /asset/transfer/history, which transfers
+// an asset like /transaction and returns a before and after record of it,
+// so that auditors need no second call. Both reads bypass the caches.
+func (wh *walletHandler) TransferWithHistory(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		methodNotAllowed(w, req, "POST")
+		return
+	}
+	ctx, cancel := wh.requestContext(req)
+	defer cancel()
+
+	var transaction PostTransaction
+	if !readJSON(w, req, &transaction) {
+		return
+	}
+	if !validate(w, transaction) || !wh.checkEndorsingPeers(w, transaction.EndorsingPeers) {
+		return
+	}
+
+	wh.forgetAsset(ctx, transaction.AssetID)
+	exists, err := wh.assetExists(ctx, transaction.AssetID)
+	if err != nil {
+		writeAssetCheckError(w, transaction.AssetID, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, assetNotFoundError(transaction.AssetID))
+		return
+	}
+	before, status, err := wh.readAssetState(ctx, transaction.AssetID)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	opts := txOptions{transient: transientData(transaction.Transient), endorsingPeers: transaction.EndorsingPeers}
+	_, txID, err := wh.submitTxWith(ctx, "TransferAsset", opts, transaction.AssetID, transaction.Owner)
+	if err != nil {
+		writeError(w, transactionErrorStatus(err), fmt.Errorf("failed to submit transaction: %w", err))
+		return
+	}
+
+	after, status, err := wh.readAssetState(ctx, transaction.AssetID)
+	if err != nil {
+		writeError(w, status, fmt.Errorf("transaction %s was committed but the new state could not be read: %w", txID, err))
+		return
+	}
+	writeData(w, http.StatusOK, TransferRecord{
+		TxID:          txID,
+		AssetID:       transaction.AssetID,
+		PreviousOwner: before.Owner,
+		Asset:         after,
+	})
+}
+
+// readAssetState evaluates ReadAsset for id on the ledger, without the
+// asset cache, and returns the status to respond with when it fails.
+func (wh *walletHandler) readAssetState(ctx context.Context, id string) (Asset, int, error) {
+	result, err := wh.evaluate(ctx, "ReadAsset", id)
+	if err != nil {
+		return Asset{}, transactionErrorStatus(err), fmt.Errorf("failed to evaluate transaction: %w", err)
+	}
+	var record ledgerRecord
+	if err := json.Unmarshal(result, &record); err != nil {
+		return Asset{}, http.StatusBadGateway, fmt.Errorf("unexpected ReadAsset response: %w", err)
+	}
+	return record.asset(), 0, nil
+}
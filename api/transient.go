@@ -0,0 +1,72 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Limits on the transient data a create or transfer request may carry.
+const (
+	maxTransientEntries    = 16
+	maxTransientKeyBytes   = 128
+	maxTransientValueBytes = 16 * 1024
+)
+
+// CreateAssetRequest is the body of POST /create-asset: an asset and,
+// optionally, transient data for the chaincode and the peers to endorse
+// it.
+type CreateAssetRequest struct {
+	Asset
+	Transient      map[string]string `json:"transient,omitempty"`
+	EndorsingPeers []string          `json:"endorsingPeers,omitempty"`
+}
+
+func (r CreateAssetRequest) fieldErrors() []FieldError {
+	return append(r.Asset.fieldErrors(), transientErrors(r.Transient)...)
+}
+
+// transientErrors checks transient data against the size limits.
+func transientErrors(transient map[string]string) []FieldError {
+	if len(transient) > maxTransientEntries {
+		return []FieldError{{Field: "transient", Message: fmt.Sprintf("must have at most %d entries", maxTransientEntries)}}
+	}
+	keys := make([]string, 0, len(transient))
+	for key := range transient {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []FieldError
+	for _, key := range keys {
+		switch {
+		case key == "":
+			errs = append(errs, FieldError{Field: "transient", Message: "keys must not be empty"})
+		case len(key) > maxTransientKeyBytes:
+			errs = append(errs, FieldError{Field: "transient", Message: fmt.Sprintf("keys must be at most %d bytes", maxTransientKeyBytes)})
+		case len(transient[key]) > maxTransientValueBytes:
+			errs = append(errs, FieldError{Field: "transient." + key, Message: fmt.Sprintf("must be at most %d bytes", maxTransientValueBytes)})
+		}
+	}
+	return errs
+}
+
+// transientData returns the transient map that sends transient with a
+// transaction, or nil when it is empty. Values reach the chaincode as
+// their UTF-8 bytes; base64 is not decoded, so binary data stays encoded
+// and the chaincode decodes it itself.
+func transientData(transient map[string]string) map[string][]byte {
+	if len(transient) == 0 {
+		return nil
+	}
+	data := make(map[string][]byte, len(transient))
+	for key, value := range transient {
+		data[key] = []byte(value)
+	}
+	return data
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withTransient returns body, a JSON object, with a transient field added.
+func withTransient(body string, transient map[string]string) string {
+	data, _ := json.Marshal(transient)
+	return strings.TrimSuffix(body, "}") + `,"transient":` + string(data) + "}"
+}
+
+const transferBody = `{"asset_id":"asset1","owner":"Max"}`
+
+// TestTransientPassthrough checks that create and transfer send the
+// transient field as transient data, as is, and keep it out of the
+// transaction arguments.
+func TestTransientPassthrough(t *testing.T) {
+	// Values are passed on as their bytes, so base64 stays encoded.
+	transient := map[string]string{"quote": "42", "blob": "aGVsbG8="}
+	want := map[string][]byte{"quote": []byte("42"), "blob": []byte("aGVsbG8=")}
+	tests := []struct {
+		name      string
+		target    string
+		body      string
+		status    int
+		function  string
+		args      []string
+		transient map[string][]byte
+	}{
+		{"create", "/create-asset", withTransient(createBody, transient), http.StatusCreated,
+			"CreateAsset", []string{"asset9", "blue", "5", "Tomoko", "300"}, want},
+		{"transfer", "/transaction", withTransient(transferBody, transient), http.StatusOK,
+			"TransferAsset", []string{"asset1", "Max"}, want},
+		{"create without transient", "/create-asset", createBody, http.StatusCreated,
+			"CreateAsset", []string{"asset9", "blue", "5", "Tomoko", "300"}, nil},
+		{"transfer without transient", "/transaction", transferBody, http.StatusOK,
+			"TransferAsset", []string{"asset1", "Max"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contract := &fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})}
+			rec := serve(newRouter(newTestHandler(contract)), "POST", tt.target, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			submissions := contract.submitted()
+			if len(submissions) != 1 || submissions[0].name != tt.function {
+				t.Fatalf("submissions = %v, want one %s", submissions, tt.function)
+			}
+			if !reflect.DeepEqual(submissions[0].args, tt.args) {
+				t.Errorf("args = %q, want %q", submissions[0].args, tt.args)
+			}
+			if !reflect.DeepEqual(submissions[0].opts.transient, tt.transient) {
+				t.Errorf("transient = %q, want %q", submissions[0].opts.transient, tt.transient)
+			}
+		})
+	}
+}
+
+// TestTransientLimits checks that transient data over the limits is
+// refused before anything is submitted.
+func TestTransientLimits(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxTransientEntries; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "v"
+	}
+	tests := []struct {
+		name      string
+		transient map[string]string
+		field     string
+	}{
+		{"too many entries", tooMany, "transient"},
+		{"empty key", map[string]string{"": "v"}, "transient"},
+		{"long key", map[string]string{strings.Repeat("k", maxTransientKeyBytes+1): "v"}, "transient"},
+		{"long value", map[string]string{"quote": strings.Repeat("v", maxTransientValueBytes+1)}, "transient.quote"},
+	}
+	for _, tt := range tests {
+		for _, route := range []struct{ target, body string }{
+			{"/create-asset", createBody},
+			{"/transaction", transferBody},
+		} {
+			t.Run(tt.name+" "+route.target, func(t *testing.T) {
+				contract := &fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})}
+				rec := serve(newRouter(newTestHandler(contract)), "POST", route.target, withTransient(route.body, tt.transient))
+				resp := expectError(t, rec, http.StatusBadRequest, codeValidationFailed)
+				if len(resp.Errors) != 1 || resp.Errors[0].Field != tt.field {
+					t.Errorf("errors = %v, want one for %s", resp.Errors, tt.field)
+				}
+				if n := len(contract.submitted()); n != 0 {
+					t.Errorf("%d submissions, want 0", n)
+				}
+			})
+		}
+	}
+}
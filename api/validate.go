@@ -0,0 +1,105 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes why one field of a request body is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	return e.Field + " " + e.Message
+}
+
+// validator is implemented by request bodies that can check their own
+// fields. fieldErrors returns every problem found, not just the first.
+type validator interface {
+	fieldErrors() []FieldError
+}
+
+func (a Asset) fieldErrors() []FieldError {
+	var errs []FieldError
+	errs = requireField(errs, "asset_id", a.AssetID)
+	errs = requireField(errs, "owner", a.Owner)
+	errs = requireField(errs, "colour", a.Colour)
+	errs = requirePositiveInt(errs, "size", a.Size)
+	errs = requirePositiveInt(errs, "appraised_value", a.AppraisedValue)
+	return errs
+}
+
+// validate returns an error naming the first invalid field of a, or nil
+// when every field is valid.
+func (a Asset) validate() error {
+	if errs := a.fieldErrors(); len(errs) > 0 {
+		return errors.New(errs[0].String())
+	}
+	return nil
+}
+
+func (t PostTransaction) fieldErrors() []FieldError {
+	var errs []FieldError
+	errs = requireField(errs, "asset_id", t.AssetID)
+	errs = requireField(errs, "owner", t.Owner)
+	return append(errs, transientErrors(t.Transient)...)
+}
+
+func (p PostAsset) fieldErrors() []FieldError {
+	return requireField(nil, "id", p.Id)
+}
+
+func requireField(errs []FieldError, field, value string) []FieldError {
+	if strings.TrimSpace(value) == "" {
+		errs = append(errs, FieldError{Field: field, Message: "must not be empty"})
+	}
+	return errs
+}
+
+// requirePositiveInt checks value exactly as it will be sent to the
+// chaincode, which parses it with strconv.Atoi and so rejects surrounding
+// whitespace.
+func requirePositiveInt(errs []FieldError, field, value string) []FieldError {
+	if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+		errs = append(errs, FieldError{Field: field, Message: "must be a positive integer"})
+	}
+	return errs
+}
+
+// validate checks v and, if any field is invalid, responds with 400, a
+// message naming the first invalid field and the full list of field
+// errors. Handlers must return when it reports false.
+func validate(w http.ResponseWriter, v validator) bool {
+	errs := v.fieldErrors()
+	if len(errs) == 0 {
+		return true
+	}
+	writeFieldErrors(w, "request body failed validation: "+errs[0].String(), errs)
+	return false
+}
+
+// writeFieldErrors responds with 400 and the list of invalid fields.
+func writeFieldErrors(w http.ResponseWriter, message string, errs []FieldError) {
+	requestID := w.Header().Get(requestIDHeader)
+	slog.Error("request failed", "request_id", requestID, "status", http.StatusBadRequest, "invalid_fields", errs)
+	writeResponse(w, http.StatusBadRequest, APIResponse{
+		Success: false,
+		Error: &APIError{
+			Code:      codeValidationFailed,
+			Message:   message,
+			RequestID: requestID,
+		},
+		Errors: errs,
+	})
+}
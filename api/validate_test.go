@@ -0,0 +1,108 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func validAsset() Asset {
+	return Asset{AssetID: "asset9", Owner: "Tomoko", Colour: "blue", Size: "5", AppraisedValue: "300"}
+}
+
+func TestAssetValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Asset)
+		want   string
+	}{
+		{"valid", func(*Asset) {}, ""},
+		{"missing asset_id", func(a *Asset) { a.AssetID = "" }, "asset_id must not be empty"},
+		{"blank asset_id", func(a *Asset) { a.AssetID = "  " }, "asset_id must not be empty"},
+		{"missing owner", func(a *Asset) { a.Owner = "" }, "owner must not be empty"},
+		{"missing colour", func(a *Asset) { a.Colour = "" }, "colour must not be empty"},
+		{"missing size", func(a *Asset) { a.Size = "" }, "size must be a positive integer"},
+		{"missing appraised_value", func(a *Asset) { a.AppraisedValue = "" }, "appraised_value must be a positive integer"},
+		{"first of several", func(a *Asset) { a.Owner, a.Size = "", "" }, "owner must not be empty"},
+		{"all missing", func(a *Asset) { *a = Asset{} }, "asset_id must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset := validAsset()
+			tt.change(&asset)
+			err := asset.validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestCreateNamesFirstInvalidField checks that a create missing a field is
+// refused with 400 and a message naming it, without submitting.
+func TestCreateNamesFirstInvalidField(t *testing.T) {
+	contract := &fakeContract{evaluate: ledger(map[string]string{})}
+	body := strings.Replace(createBody, `"owner":"Tomoko"`, `"owner":""`, 1)
+
+	resp := expectError(t, serve(newRouter(newTestHandler(contract)), "POST", "/create-asset", body), http.StatusBadRequest, codeValidationFailed)
+	if !strings.HasSuffix(resp.Error.Message, "owner must not be empty") {
+		t.Errorf("message = %q, want it to name the owner", resp.Error.Message)
+	}
+	if n := contract.count("CreateAsset"); n != 0 {
+		t.Errorf("CreateAsset submitted %d times, want 0", n)
+	}
+}
+
+// TestNumericFields checks size and appraised_value the way the chaincode
+// parses them, with strconv.Atoi.
+func TestNumericFields(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"1", true},
+		{"300", true},
+		{"007", true},
+		{"+5", true},
+		{"", false},
+		{"0", false},
+		{"-5", false},
+		{"abc", false},
+		{"5.0", false},
+		{"1e3", false},
+		{" 5", false},
+		{"5 ", false},
+		{"99999999999999999999", false},
+	}
+	for _, tt := range tests {
+		for _, field := range []string{"size", "appraised_value"} {
+			t.Run(field+"="+tt.value, func(t *testing.T) {
+				asset := validAsset()
+				if field == "size" {
+					asset.Size = tt.value
+				} else {
+					asset.AppraisedValue = tt.value
+				}
+				errs := asset.fieldErrors()
+				if tt.valid && len(errs) > 0 {
+					t.Errorf("fieldErrors() = %v, want none", errs)
+				}
+				if !tt.valid && (len(errs) != 1 || errs[0].Field != field) {
+					t.Errorf("fieldErrors() = %v, want %s rejected", errs, field)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+const (
+	codeIdentityNotFound = "IDENTITY_NOT_FOUND"
+	codeIdentityInUse    = "IDENTITY_IN_USE"
+)
+
+// Wallet types selected with WALLET_TYPE.
+const (
+	walletTypeFilesystem = "filesystem"
+	walletTypeMemory     = "memory"
+	walletTypeSQL        = "sql"
+)
+
+// identityWallet is the wallet the API keeps its identities in: one of the
+// SDK's wallets, or sqlWallet. gateway.WithIdentity accepts any of them.
+type identityWallet interface {
+	Put(label string, id gateway.Identity) error
+	Get(label string) (gateway.Identity, error)
+	Remove(label string) error
+	Exists(label string) bool
+	List() ([]string, error)
+}
+
+var (
+	_ identityWallet = (*gateway.Wallet)(nil)
+	_ identityWallet = (*sqlWallet)(nil)
+)
+
+// newWallet opens the wallet cfg.WalletType names. An in-memory wallet
+// starts empty and forgets identities enrolled at runtime on exit, which
+// suits read-only containers, CI and demos. A SQL wallet is shared by every
+// replica connected to the same database.
+func newWallet(cfg *appConfig) (identityWallet, error) {
+	switch cfg.WalletType {
+	case walletTypeMemory:
+		slog.Warn("Using an in-memory wallet; enrolled identities are lost on exit")
+		return gateway.NewInMemoryWallet(), nil
+	case walletTypeSQL:
+		return openSQLWallet(cfg.WalletDBDriver, cfg.WalletDBDSN)
+	}
+	return gateway.NewFileSystemWallet(cfg.WalletPath)
+}
+
+// openWallet opens the wallet and stores the wallet user in it when it is
+// missing, as it always is from an in-memory wallet.
+func openWallet(cfg *appConfig) (identityWallet, error) {
+	wallet, err := newWallet(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+	if !wallet.Exists(cfg.WalletUser) {
+		if err := populateWallet(wallet, cfg); err != nil {
+			return nil, fmt.Errorf("failed to populate wallet contents: %w", err)
+		}
+	}
+	return wallet, nil
+}
+
+// WalletIdentity describes a wallet identity by its certificate. The
+// private key is never included.
+type WalletIdentity struct {
+	Label     string    `json:"label"`
+	MspID     string    `json:"mspId"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Serial    string    `json:"serial,omitempty"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	InUse     bool      `json:"inUse"`
+}
+
+// WalletIdentities serves /wallet/identities and /wallet/identities/{label}.
+func (wh *walletHandler) WalletIdentities(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/wallet/identities" {
+		if req.Method != "GET" {
+			methodNotAllowed(w, req, "GET")
+			return
+		}
+		wh.listIdentities(w)
+		return
+	}
+
+	segments, err := pathSegments(req, "/wallet/identities/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(segments) != 1 || segments[0] == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s", req.URL.Path))
+		return
+	}
+	label := segments[0]
+
+	switch req.Method {
+	case "GET":
+		identity, err := wh.describeIdentity(label)
+		if err != nil {
+			writeError(w, identityErrorStatus(err), err)
+			return
+		}
+		writeData(w, http.StatusOK, identity)
+	case "DELETE":
+		wh.removeIdentity(w, label)
+	default:
+		methodNotAllowed(w, req, "GET", "DELETE")
+	}
+}
+
+func (wh *walletHandler) listIdentities(w http.ResponseWriter) {
+	labels, err := wh.wallet.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to list wallet: %w", err))
+		return
+	}
+	sort.Strings(labels)
+
+	identities := []WalletIdentity{}
+	for _, label := range labels {
+		identity, err := wh.describeIdentity(label)
+		if err != nil {
+			writeError(w, identityErrorStatus(err), err)
+			return
+		}
+		identities = append(identities, *identity)
+	}
+	writeData(w, http.StatusOK, identities)
+}
+
+// removeIdentity deletes label from the wallet and answers 204. The
+// identity the API connected with, and any other with an open gateway
+// connection, is refused with 409.
+func (wh *walletHandler) removeIdentity(w http.ResponseWriter, label string) {
+	if !wh.wallet.Exists(label) {
+		writeError(w, http.StatusNotFound, identityNotFoundError(label))
+		return
+	}
+	if wh.identityInUse(label) {
+		writeError(w, http.StatusConflict, withCode(codeIdentityInUse, fmt.Errorf("identity %s is used by an open gateway connection", label)))
+		return
+	}
+
+	if err := wh.wallet.Remove(label); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to remove %s: %w", label, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// identityInUse reports whether a gateway connection is signing as label.
+func (wh *walletHandler) identityInUse(label string) bool {
+	return label == wh.walletUser || (wh.identities != nil && wh.identities.connected(label))
+}
+
+func (wh *walletHandler) describeIdentity(label string) (*WalletIdentity, error) {
+	if !wh.wallet.Exists(label) {
+		return nil, identityNotFoundError(label)
+	}
+	id, err := wh.wallet.Get(label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity %s: %w", label, err)
+	}
+	x509ID, ok := id.(*gateway.X509Identity)
+	if !ok {
+		return nil, fmt.Errorf("identity %s is not an X.509 identity", label)
+	}
+
+	block, _ := pem.Decode([]byte(x509ID.Certificate()))
+	if block == nil {
+		return nil, fmt.Errorf("identity %s has no PEM certificate", label)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("identity %s has an invalid certificate: %w", label, err)
+	}
+
+	return &WalletIdentity{
+		Label:     label,
+		MspID:     x509ID.MspID,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		Serial:    cert.SerialNumber.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		InUse:     wh.identityInUse(label),
+	}, nil
+}
+
+func identityNotFoundError(label string) error {
+	return withCode(codeIdentityNotFound, fmt.Errorf("identity %s is not in the wallet", label))
+}
+
+func identityErrorStatus(err error) int {
+	var coded *codedError
+	if errors.As(err, &coded) && coded.code == codeIdentityNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
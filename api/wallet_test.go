@@ -0,0 +1,100 @@
+/*
+Copyright 2020 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBootWithMemoryWallet starts the API as main does with
+// WALLET_TYPE=memory, with the wallet user's credentials from the
+// environment or from an MSP directory, and serves requests against a
+// mocked contract. Nothing is written to the filesystem wallet path.
+func TestBootWithMemoryWallet(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeSelfSignedCert(t, dir)
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msp := filepath.Join(dir, "msp")
+	for _, sub := range []string{"signcerts", "keystore"} {
+		if err := os.MkdirAll(filepath.Join(msp, sub), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(msp, "signcerts", "cert.pem"), certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(msp, "keystore", "priv_sk"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"PEM environment", map[string]string{"WALLET_CERT_PEM": string(certPEM), "WALLET_KEY_PEM": string(keyPEM)}},
+		{"MSP directory", map[string]string{"CREDENTIAL_PATH": msp}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walletPath := filepath.Join(t.TempDir(), "wallet")
+			t.Setenv("WALLET_TYPE", walletTypeMemory)
+			t.Setenv("WALLET_PATH", walletPath)
+			t.Setenv("WALLET_USER", "appUser")
+			t.Setenv("API_KEY", "secret")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := loadConfig(nil)
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			wallet, err := openWallet(cfg)
+			if err != nil {
+				t.Fatalf("openWallet: %v", err)
+			}
+			auth, err := newAPIKeyAuth(cfg)
+			if err != nil {
+				t.Fatalf("newAPIKeyAuth: %v", err)
+			}
+			wh := newTestHandler(&fakeContract{evaluate: ledger(map[string]string{"asset1": asset1})})
+			wh.wallet, wh.auth, wh.walletUser = wallet, auth, cfg.WalletUser
+			h := newRouter(wh)
+
+			if rec := serve(h, "GET", "/assets/asset1", "", apiKeyHeader, "secret"); rec.Code != http.StatusOK {
+				t.Errorf("GET /assets/asset1: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			rec := serve(h, "GET", "/wallet/identities", "", apiKeyHeader, "secret")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET /wallet/identities: status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+			var identities []WalletIdentity
+			if err := json.Unmarshal(decodeResponse(t, rec).Data, &identities); err != nil {
+				t.Fatal(err)
+			}
+			if len(identities) != 1 || identities[0].Label != "appUser" || !identities[0].InUse {
+				t.Errorf("identities = %+v, want appUser in use", identities)
+			}
+
+			if _, err := os.Stat(walletPath); !os.IsNotExist(err) {
+				t.Errorf("the filesystem wallet path was created: %v", err)
+			}
+		})
+	}
+}